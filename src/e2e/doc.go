@@ -0,0 +1,24 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+// Package e2e holds the end-to-end tests: the game is built, started
+// on a pseudo-terminal and played through it, and what it draws is
+// read back with a VT100 emulator. Run them with go test e2e, or skip
+// them with -short.
+package e2e
@@ -0,0 +1,513 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package e2e
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"leaderboard"
+	"space"
+	"telnet"
+	"vt100"
+	"web"
+)
+
+const (
+	SHIP_BASE       = "╚═╩═══════╩═╝"
+	GAME_OVER       = "GAME OVER"
+	PLAY_TIMEOUT    = 30 * time.Second
+)
+
+// shipColumn is where the base of the ship is drawn, -1 when it is not.
+func shipColumn(s *vt100.Screen) int {
+	_, col, ok := s.Find(SHIP_BASE)
+	if !ok { return -1 }
+	return col
+}
+
+func TestTitleQuit(t *testing.T) {
+	g := start(t)
+	g.waitText("▶ START", WAIT_TIMEOUT)
+	if !g.screen.AltScreen() || g.screen.CursorVisible() { t.Error("the title is not on the alternate screen with the cursor hidden") }
+
+	g.send("q")
+	if code := g.exitCode(WAIT_TIMEOUT); code != 0 { t.Errorf("exit code %d, want 0", code) }
+	if g.screen.AltScreen() || !g.screen.CursorVisible() { t.Error("the terminal was not given back") }
+}
+
+func TestShipMoves(t *testing.T) {
+	g := start(t, "play", "--no-title", "--seed", "1")
+	g.waitFor("the ship", WAIT_TIMEOUT, func(s *vt100.Screen) bool { return shipColumn(s) >= 0 })
+
+	from := shipColumn(g.screen)
+	g.send("aaa")
+	g.waitFor("the ship to move 3 left", WAIT_TIMEOUT, func(s *vt100.Screen) bool { return shipColumn(s) == from - 3 })
+	g.send("x")
+	g.waitFor("the ship to jump right", WAIT_TIMEOUT, func(s *vt100.Screen) bool { return shipColumn(s) == from + 7 })
+
+	g.send("q")
+	g.exitCode(WAIT_TIMEOUT)
+}
+
+// The rounds are deterministic: the first invader always comes down
+// the middle of the screen, and this shot at this tick gets it.
+const KILL_REPLAY = `SYSTEMINVADERS-REPLAY 2
+seed 1
+difficulty EASY
+size 35 100
+1 97
+2 32
+`
+
+func TestKillScores(t *testing.T) {
+	replay := filepath.Join(t.TempDir(), "kill.replay")
+	if err := os.WriteFile(replay, []byte(KILL_REPLAY), 0644); err != nil { t.Fatal(err) }
+
+	log := filepath.Join(t.TempDir(), "game.log")
+	g := start(t, "replay", "--log", log, replay)
+	g.waitText("SCORE: 0 ", WAIT_TIMEOUT)
+	g.waitText("SCORE: 10 ", WAIT_TIMEOUT)
+	g.send("p")
+	g.waitText("PAUSED", WAIT_TIMEOUT)
+
+	g.send("q")
+	if code := g.exitCode(WAIT_TIMEOUT); code != 0 { t.Errorf("exit code %d, want 0", code) }
+
+	text, err := os.ReadFile(log)
+	if err != nil { t.Fatal(err) }
+	for _, want := range []string{ `"msg":"round"`, `"msg":"score"`, `"msg":"log closed"` } {
+		if !strings.Contains(string(text), want) { t.Errorf("the log has no %s:\n%s", want, text) }
+	}
+}
+
+func TestGameOver(t *testing.T) {
+	g := start(t, "play", "--no-title", "--seed", "1", "--difficulty", "hard")
+	g.waitText(GAME_OVER, PLAY_TIMEOUT)
+	g.waitText("AGAIN <r>", WAIT_TIMEOUT)
+
+	g.send("q")
+	if code := g.exitCode(WAIT_TIMEOUT); code != 0 { t.Errorf("exit code %d, want 0", code) }
+}
+
+// A round recorded as it is played verifies, and a replay that claims
+// another score does not.
+func TestVerify(t *testing.T) {
+	replay := filepath.Join(t.TempDir(), "round.replay")
+	g := start(t, "play", "--no-title", "--seed", "1", "--difficulty", "hard", "--record", replay)
+	g.waitText("SCORE: 0 ", WAIT_TIMEOUT)
+	g.send("  a a  ss  ")
+	g.waitText(GAME_OVER, PLAY_TIMEOUT)
+	g.send("q")
+	if code := g.exitCode(WAIT_TIMEOUT); code != 0 { t.Fatalf("exit code %d, want 0", code) }
+
+	out, err := exec.Command(binary, "verify", replay).CombinedOutput()
+	if err != nil || !strings.Contains(string(out), " points, level 1, ") { t.Fatalf("verify: %v\n%s", err, out) }
+	cmd := exec.Command(binary, "verify", "--level", "7", replay)
+	if cmd.Run(); cmd.ProcessState.ExitCode() != space.VERIFY_ERROR { t.Error("a wrong level was verified") }
+
+	text, err := os.ReadFile(replay)
+	if err != nil { t.Fatal(err) }
+	lines := strings.Split(strings.TrimSpace(string(text)), "\n")
+	var end space.ReplayEnd
+	if _, err := fmt.Sscanf(lines[len(lines) - 1], "end %d %d %d %s", &end.Tick, &end.Points, &end.Level, &end.Cause); err != nil {
+		t.Fatalf("no end in the replay: %v", err)
+	}
+	lines[len(lines) - 1] = fmt.Sprintf("end %d %d %d %s", end.Tick, end.Points + 1000, end.Level, end.Cause)
+	if err := os.WriteFile(replay, []byte(strings.Join(lines, "\n") + "\n"), 0644); err != nil { t.Fatal(err) }
+
+	cmd = exec.Command(binary, "verify", replay)
+	out, _ = cmd.CombinedOutput()
+	if code := cmd.ProcessState.ExitCode(); code != space.VERIFY_ERROR || !strings.Contains(string(out), "claimed") {
+		t.Errorf("a forged replay ended with %d:\n%s", code, out)
+	}
+}
+
+// A round left with the quit key is saved and resumed where it was, and
+// a save of another version is refused.
+func TestSaveResume(t *testing.T) {
+	save := filepath.Join(t.TempDir(), "round.save")
+	g := start(t, "play", "--no-title", "--seed", "1", "--difficulty", "hard", "--save", save)
+	g.waitText("TIME: 00:02", WAIT_TIMEOUT)
+	g.send("q")
+	if code := g.exitCode(WAIT_TIMEOUT); code != 0 { t.Fatalf("exit code %d, want 0", code) }
+
+	text, err := os.ReadFile(save)
+	if err != nil { t.Fatal(err) }
+	if !strings.HasPrefix(string(text), space.SAVE_MAGIC + " 1\ndifficulty HARD\n") { t.Fatalf("the save starts with %.40q", text) }
+
+	g = start(t, "play", "--resume", save)
+	g.waitText("SCORE: ", WAIT_TIMEOUT)
+	if g.screen.Contains("TIME: 00:00") || g.screen.Contains("TIME: 00:01") { t.Errorf("the round started over:\n%s", g.dump()) }
+	g.send("q")
+	if code := g.exitCode(WAIT_TIMEOUT); code != 0 { t.Fatalf("exit code %d, want 0", code) }
+
+	old := strings.Replace(string(text), space.SAVE_MAGIC + " 1", space.SAVE_MAGIC + " 0", 1)
+	if err := os.WriteFile(save, []byte(old), 0644); err != nil { t.Fatal(err) }
+	g = start(t, "play", "--resume", save)
+	if code := g.exitCode(WAIT_TIMEOUT); code != space.FILE_ERROR { t.Errorf("an old save exited with %d", code) }
+	if !g.screen.Contains("saved in version 0") { t.Errorf("no error for an old save:\n%s", g.dump()) }
+}
+
+// A new game starts in the same process, on a clean playfield.
+func TestRestartAfterGameOver(t *testing.T) {
+	g := start(t, "play", "--no-title", "--seed", "1", "--difficulty", "hard")
+	g.waitText("AGAIN <r>", PLAY_TIMEOUT)
+
+	g.send("r")
+	g.waitFor("a new game", WAIT_TIMEOUT, func(s *vt100.Screen) bool {
+		return !s.Contains(GAME_OVER) && s.Contains("SCORE: 0 ") && shipColumn(s) >= 0
+	})
+
+	g.send("q")
+	if code := g.exitCode(WAIT_TIMEOUT); code != 0 { t.Errorf("exit code %d, want 0", code) }
+}
+
+// Errors are reported on the user's screen, with the exit code of
+// their class.
+func TestTerminalTooSmall(t *testing.T) {
+	g := startSized(t, TERM_ROWS, 60, "play", "--no-title")
+	if code := g.exitCode(WAIT_TIMEOUT); code != 2 { t.Errorf("exit code %d, want 2", code) }
+	if !g.screen.Contains("Terminal Size Error: the terminal is 60x35") || g.screen.AltScreen() {
+		t.Errorf("the error is not on the main screen:\n%s", g.dump())
+	}
+}
+
+// ships returns the columns of the ship bases on the screen.
+func ships(s *vt100.Screen) []int {
+	var cols []int
+	for _, line := range s.Lines() {
+		for i, runes := 0, []rune(line); i + len([]rune(SHIP_BASE)) <= len(runes); i++ {
+			if string(runes[i:i + len([]rune(SHIP_BASE))]) == SHIP_BASE { cols = append(cols, i) }
+		}
+	}
+	return cols
+}
+
+func freePort(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Skipf("no loopback: %v", err) }
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// The second player joins from another terminal: both see the two
+// ships, and the one of the client moves with its keys.
+func TestCoop(t *testing.T) {
+	addr := freePort(t)
+	host := start(t, "play", "--no-title", "--seed", "1", "--host", addr)
+	host.waitText("WAITING FOR PLAYER 2", WAIT_TIMEOUT)
+
+	client := start(t, "join", addr)
+	two := func(s *vt100.Screen) bool { return len(ships(s)) == 2 }
+	host.waitFor("two ships on the host", WAIT_TIMEOUT, two)
+	client.waitFor("two ships on the client", WAIT_TIMEOUT, two)
+
+	mate := ships(host.screen)[0]
+	client.send("s")
+	host.waitFor("the ship of the client to move", WAIT_TIMEOUT, func(s *vt100.Screen) bool {
+		cols := ships(s)
+		return len(cols) == 2 && cols[0] == mate + 1
+	})
+	client.waitText("P2: 0", WAIT_TIMEOUT)
+
+	client.send("q")
+	if code := client.exitCode(WAIT_TIMEOUT); code != 0 { t.Errorf("client exit code %d, want 0", code) }
+	host.waitFor("the ship of the client to go", WAIT_TIMEOUT, func(s *vt100.Screen) bool { return len(ships(s)) == 1 })
+
+	host.send("q")
+	if code := host.exitCode(WAIT_TIMEOUT); code != 0 { t.Errorf("host exit code %d, want 0", code) }
+}
+
+// startServer runs the game server with args until the end of the
+// test, once it accepts connections on addr.
+func startServer(t *testing.T, addr string, args ...string) *exec.Cmd {
+	t.Helper()
+	if testing.Short() { t.Skip("end-to-end test") }
+	server := exec.Command(binary, args...)
+	server.Env = append(os.Environ(), "HOME=" + t.TempDir())
+	if err := server.Start(); err != nil { t.Fatal(err) }
+	t.Cleanup(func() {
+		server.Process.Kill()
+		server.Wait()
+	})
+
+	for deadline := time.Now().Add(WAIT_TIMEOUT); ; time.Sleep(WAIT_POLL) {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return server
+		}
+		if time.Now().After(deadline) { t.Fatal("the server does not accept connections") }
+	}
+}
+
+// sshLogin logs in to the server at addr as user with the OpenSSH
+// client, on a pty of rows x cols.
+func sshLogin(t *testing.T, client, addr string, rows, cols int, user string) *game {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(addr)
+	return spawn(t, rows, cols, client, "-tt", "-F", "/dev/null", "-p", port, "-o", "StrictHostKeyChecking=no",
+	             "-o", "UserKnownHostsFile=/dev/null", "-o", "LogLevel=ERROR", user + "@" + host)
+}
+
+// Players log in to the server with the OpenSSH client, each one to a
+// game of their own on the terminal of the session.
+func TestServeSSH(t *testing.T) {
+	if testing.Short() { t.Skip("end-to-end test") }
+	client, err := exec.LookPath("ssh")
+	if err != nil { t.Skip("no ssh client") }
+
+	addr := freePort(t)
+	server := startServer(t, addr, "serve", "--ssh", addr, "--difficulty", "easy")
+
+	alice := sshLogin(t, client, addr, TERM_ROWS, TERM_COLS, "alice")
+	bob := sshLogin(t, client, addr, TERM_ROWS, 60, "bob")
+	alice.waitText("▶ START", WAIT_TIMEOUT)
+	if !alice.screen.AltScreen() { t.Error("the title is not on the alternate screen") }
+	bob.waitText("Terminal Size Error", WAIT_TIMEOUT)
+	if code := bob.exitCode(WAIT_TIMEOUT); code != 2 { t.Errorf("a small terminal ended with %d, want 2", code) }
+
+	alice.send("q")
+	if code := alice.exitCode(WAIT_TIMEOUT); code != 0 { t.Errorf("exit code %d, want 0", code) }
+	if alice.screen.AltScreen() { t.Error("the terminal was not given back") }
+
+	server.Process.Signal(syscall.SIGTERM)
+	if err := server.Wait(); err != nil { t.Errorf("the server stopped with %v", err) }
+}
+
+// telnetLogin connects to the telnet server at addr like a client on
+// an xterm of TERM_COLS x TERM_ROWS: it agrees to the options and puts
+// what the server draws on the screen of the game it returns, whose
+// done is closed with the connection.
+func telnetLogin(t *testing.T, addr string) (*game, net.Conn) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil { t.Fatal(err) }
+	t.Cleanup(func() { conn.Close() })
+
+	g := &game{ t: t, screen: vt100.New(TERM_ROWS, TERM_COLS), done: make(chan struct{}) }
+	conn.Write([]byte{ telnet.IAC, telnet.WILL, telnet.OPT_TTYPE, telnet.IAC, telnet.WILL, telnet.OPT_NAWS,
+	                   telnet.IAC, telnet.SB, telnet.OPT_NAWS, 0, TERM_COLS, 0, TERM_ROWS, telnet.IAC, telnet.SE,
+	                   telnet.IAC, telnet.DO, telnet.OPT_ECHO, telnet.IAC, telnet.DO, telnet.OPT_SGA })
+
+	go func() {
+		defer close(g.done)
+		r := bufio.NewReader(conn)
+		for {
+			c, err := r.ReadByte()
+			if err != nil { return }
+			if c != telnet.IAC {
+				g.screen.Write([]byte{ c })
+				continue
+			}
+
+			switch command, _ := r.ReadByte(); command {
+				case telnet.IAC:
+					g.screen.Write([]byte{ c })
+				case telnet.SB:
+					sub, _ := r.ReadBytes(telnet.SE)
+					if bytes.HasPrefix(sub, []byte{ telnet.OPT_TTYPE, telnet.TTYPE_SEND }) {
+						reply := append([]byte{ telnet.IAC, telnet.SB, telnet.OPT_TTYPE, telnet.TTYPE_IS }, TERM_TYPE...)
+						conn.Write(append(reply, telnet.IAC, telnet.SE))
+					}
+				case telnet.WILL, telnet.WONT, telnet.DO, telnet.DONT:
+					r.ReadByte()
+			}
+		}
+	}()
+	return g, conn
+}
+
+// A player on a telnet client gets a game on a terminal of the type and
+// size it told, and the connection ends when they quit.
+func TestServeTelnet(t *testing.T) {
+	addr := freePort(t)
+	startServer(t, addr, "serve", "--telnet", addr)
+
+	g, conn := telnetLogin(t, addr)
+	g.waitText("▶ START", WAIT_TIMEOUT)
+	if !g.screen.AltScreen() { t.Error("the title is not on the alternate screen") }
+
+	conn.Write([]byte("q"))
+	select {
+		case <- g.done:
+		case <- time.After(WAIT_TIMEOUT):
+			t.Fatalf("the connection was not closed, the screen is:\n%s", g.dump())
+	}
+	if g.screen.AltScreen() { t.Error("the terminal was not given back") }
+}
+
+// browserLogin opens the WebSocket of the page of the server at addr,
+// as the browser of player does; the keys go with send.
+func browserLogin(t *testing.T, addr, player string) (g *game, send func(keys string)) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil { t.Fatal(err) }
+	t.Cleanup(func() { conn.Close() })
+
+	fmt.Fprintf(conn, "GET %s?rows=%d&cols=%d&name=%s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\n" +
+	            "Connection: Upgrade\r\nSec-WebSocket-Key: c3lzdGVtSW52YWRlcnMhIQ==\r\nSec-WebSocket-Version: 13\r\n\r\n",
+	            web.PLAY_PATH, TERM_ROWS, TERM_COLS, player, addr)
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil { t.Fatal(err) }
+	if resp.StatusCode != http.StatusSwitchingProtocols { t.Fatalf("the server answered %s", resp.Status) }
+
+	g = &game{ t: t, screen: vt100.New(TERM_ROWS, TERM_COLS), done: make(chan struct{}) }
+	go func() {
+		defer close(g.done)
+		for {
+			var head [2]byte
+			if _, err := io.ReadFull(r, head[:]); err != nil { return }
+			size := int64(head[1] & 0x7f)
+			if size >= 126 {
+				ext := make([]byte, 2 + 6 * (size - 126))
+				io.ReadFull(r, ext)
+				size = 0
+				for _, b := range ext {
+					size = size << 8 | int64(b)
+				}
+			}
+			if head[0] & 0x0f == web.OP_CLOSE { return }
+			if _, err := io.CopyN(g.screen, r, size); err != nil { return }
+		}
+	}()
+
+	send = func(keys string) {
+		frame := append([]byte{ 0x80 | web.OP_BINARY, 0x80 | byte(len(keys)) }, 0, 0, 0, 0)
+		conn.Write(append(frame, keys...))
+	}
+	return g, send
+}
+
+// A player in a browser gets a game on the terminal of the page, and
+// the WebSocket is closed when they quit.
+func TestServeHTTP(t *testing.T) {
+	addr := freePort(t)
+	startServer(t, addr, "serve", "--http", addr)
+
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK { t.Errorf("the page is %s", resp.Status) }
+
+	g, send := browserLogin(t, addr, "alice")
+	g.waitText("▶ START", WAIT_TIMEOUT)
+	if !g.screen.AltScreen() { t.Error("the title is not on the alternate screen") }
+
+	send("q")
+	select {
+		case <- g.done:
+		case <- time.After(WAIT_TIMEOUT):
+			t.Fatalf("the WebSocket was not closed, the screen is:\n%s", g.dump())
+	}
+	if g.screen.AltScreen() { t.Error("the terminal was not given back") }
+}
+
+// A score posted to the leaderboard with the replay of its round gets
+// in the table of the server.
+func TestServeLeaderboard(t *testing.T) {
+	addr := freePort(t)
+	startServer(t, addr, "serve", "--leaderboard", addr)
+	replay, err := os.ReadFile("../leaderboard/testdata/round.replay")
+	if err != nil { t.Fatal(err) }
+
+	body := fmt.Sprintf(`{"name":"alice","points":30,"level":1,"replay":%q}`, replay)
+	resp, err := http.Post("http://" + addr + leaderboard.SCORES_PATH, "application/json", strings.NewReader(body))
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated { t.Fatalf("the score was refused: %s", resp.Status) }
+
+	resp, err = http.Get("http://" + addr + leaderboard.SCORES_PATH)
+	if err != nil { t.Fatal(err) }
+	table, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(table), `"name":"alice","points":30`) { t.Errorf("the table is %s", table) }
+}
+
+// dial connects to addr like nc would, the screen of the game it
+// returns showing what comes from the server.
+func dial(t *testing.T, addr string) (*game, net.Conn) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil { t.Fatal(err) }
+	t.Cleanup(func() { conn.Close() })
+
+	g := &game{ t: t, screen: vt100.New(TERM_ROWS, TERM_COLS), done: make(chan struct{}) }
+	go func() {
+		io.Copy(g.screen, conn)
+		close(g.done)
+	}()
+	return g, conn
+}
+
+// Spectators watch a game of the server, one with nc and one with ssh,
+// with the name of the player over it, until the player quits.
+func TestServeSpectate(t *testing.T) {
+	if testing.Short() { t.Skip("end-to-end test") }
+	client, err := exec.LookPath("ssh")
+	if err != nil { t.Skip("no ssh client") }
+
+	addr, spectate := freePort(t), freePort(t)
+	startServer(t, addr, "serve", "--ssh", addr, "--spectate", spectate)
+
+	nc, conn := dial(t, spectate)
+	nc.waitText("No game in progress", WAIT_TIMEOUT)
+	alice := sshLogin(t, client, addr, TERM_ROWS, TERM_COLS, "alice")
+	alice.waitText("▶ START", WAIT_TIMEOUT)
+
+	nc, conn = dial(t, spectate)
+	nc.waitText("1. alice", WAIT_TIMEOUT)
+	conn.Write([]byte("1\n"))
+	bob := sshLogin(t, client, addr, TERM_ROWS, TERM_COLS, "watch")
+	bob.waitText("1. alice, 1 watching", WAIT_TIMEOUT)
+	bob.send("1")
+	for _, g := range []*game{ nc, bob } {
+		g.waitFor("the game with the name of the player", WAIT_TIMEOUT, func(s *vt100.Screen) bool {
+			return s.Contains("▶ START") && strings.HasPrefix(s.Line(0), " alice ")
+		})
+	}
+
+	alice.send("s")
+	for _, g := range []*game{ nc, bob } {
+		g.waitFor("the move of the player", WAIT_TIMEOUT, func(s *vt100.Screen) bool { return s.Contains("▶ DIFFICULTY") })
+	}
+	bob.send("1")
+	if !alice.screen.Contains("▶ DIFFICULTY") { t.Error("the keys of the spectator reached the game") }
+
+	alice.send("q")
+	alice.send("q")
+	if code := alice.exitCode(WAIT_TIMEOUT); code != 0 { t.Errorf("exit code %d, want 0", code) }
+	nc.waitText("The game is over.", WAIT_TIMEOUT)
+	bob.send("q")
+	bob.send("q")
+	if code := bob.exitCode(WAIT_TIMEOUT); code != 0 { t.Errorf("the spectator ended with %d, want 0", code) }
+}
@@ -0,0 +1,182 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package e2e
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"terminal"
+	"vt100"
+)
+
+const (
+	TERM_ROWS       = 35
+	TERM_COLS       = 100
+	TERM_TYPE       = "xterm"
+	WAIT_POLL       = 20 * time.Millisecond
+	WAIT_TIMEOUT    = 10 * time.Second
+	KEY_GAP         = 80 * time.Millisecond
+)
+
+var binary string
+
+// TestMain builds the game once for all the tests.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "e2e")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	binary = filepath.Join(dir, "systemInvaders")
+
+	build := exec.Command("go", "build", "-o", binary, "main")
+	build.Stdout, build.Stderr = os.Stderr, os.Stderr
+	if err := build.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, "cannot build the game:", err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// A game is the program running on a pty, with its screen.
+type game struct {
+	t       *testing.T
+	cmd     *exec.Cmd
+	master  *os.File
+	screen  *vt100.Screen
+	done    chan struct{}
+	err     error
+}
+
+// start launches the game with args on a TERM_COLS x TERM_ROWS pty, as
+// the session leader with the pty as controlling terminal, and a home
+// directory of its own for the scores and settings.
+func start(t *testing.T, args ...string) *game {
+	t.Helper()
+	return startSized(t, TERM_ROWS, TERM_COLS, args...)
+}
+
+// startSized starts the game on a pty of rows x cols.
+func startSized(t *testing.T, rows, cols int, args ...string) *game {
+	t.Helper()
+	return spawn(t, rows, cols, binary, args...)
+}
+
+// spawn starts the program at path on a pty of rows x cols, as the
+// game would be.
+func spawn(t *testing.T, rows, cols int, path string, args ...string) *game {
+	t.Helper()
+	if testing.Short() { t.Skip("end-to-end test") }
+
+	master, slave, err := terminal.OpenPty()
+	if err != nil { t.Skipf("no pseudo-terminal: %v", err) }
+	defer slave.Close()
+	if err := terminal.SetSize(int(master.Fd()), rows, cols); err != nil { t.Fatal(err) }
+
+	g := &game{ t: t, master: master, screen: vt100.New(rows, cols), done: make(chan struct{}) }
+	g.cmd = exec.Command(path, args...)
+	g.cmd.Stdin, g.cmd.Stdout, g.cmd.Stderr = slave, slave, slave
+	g.cmd.Env = append(os.Environ(), "TERM=" + TERM_TYPE, "HOME=" + t.TempDir())
+	g.cmd.SysProcAttr = &syscall.SysProcAttr{ Setsid: true, Setctty: true, Ctty: 0 }
+	if err := g.cmd.Start(); err != nil { t.Fatal(err) }
+
+	go g.read()
+	t.Cleanup(g.stop)
+	return g
+}
+
+// read feeds the emulator until the game is gone, the pty reporting
+// EIO once the last slave descriptor is closed.
+func (g *game) read() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := g.master.Read(buf)
+		g.screen.Write(buf[:n])
+		if err != nil { break }
+	}
+	g.err = g.cmd.Wait()
+	close(g.done)
+}
+
+func (g *game) stop() {
+	select {
+		case <- g.done:
+		default:
+			g.cmd.Process.Kill()
+			<- g.done
+	}
+	g.master.Close()
+}
+
+// send types keys one at a time, as a player would.
+func (g *game) send(keys string) {
+	g.t.Helper()
+	for i := 0; i < len(keys); i++ {
+		if _, err := g.master.Write([]byte{ keys[i] }); err != nil { g.t.Fatal(err) }
+		time.Sleep(KEY_GAP)
+	}
+}
+
+// waitFor polls the screen until cond holds, failing the test with a
+// dump of the screen after timeout.
+func (g *game) waitFor(what string, timeout time.Duration, cond func(s *vt100.Screen) bool) {
+	g.t.Helper()
+	for deadline := time.Now().Add(timeout); !cond(g.screen); {
+		if time.Now().After(deadline) { g.t.Fatalf("timed out waiting for %s, the screen is:\n%s", what, g.dump()) }
+		time.Sleep(WAIT_POLL)
+	}
+}
+
+func (g *game) waitText(text string, timeout time.Duration) {
+	g.t.Helper()
+	g.waitFor(fmt.Sprintf("%q", text), timeout, func(s *vt100.Screen) bool { return s.Contains(text) })
+}
+
+// exitCode waits for the game to end.
+func (g *game) exitCode(timeout time.Duration) int {
+	g.t.Helper()
+	select {
+		case <- g.done:
+		case <- time.After(timeout):
+			g.t.Fatalf("the game did not exit, the screen is:\n%s", g.dump())
+	}
+	if exit, ok := g.err.(*exec.ExitError); ok { return exit.ExitCode() }
+	if g.err != nil { g.t.Fatal(g.err) }
+	return 0
+}
+
+func (g *game) dump() string {
+	lines := g.screen.Lines()
+	for i := range lines {
+		lines[i] = fmt.Sprintf("%2d|%s", i, lines[i])
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,264 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+// Package leaderboard serves the high-score table as JSON over HTTP.
+// A score is only taken with the replay of its round, which is played
+// again to check it, so that nobody can post a score they did not make.
+package leaderboard
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"space"
+)
+
+const (
+	SCORES_PATH     = "/scores"
+	MAX_BODY        = 1 << 20
+	MAX_NAME        = 32
+	HEADER_TIMEOUT  = 10 * time.Second
+	REPLAYS_SUFFIX  = ".replays"
+)
+
+// An Entry is a score of the table.
+type Entry struct {
+	Name    string     `json:"name"`
+	Points  int        `json:"points"`
+	Level   int        `json:"level"`
+	Date    time.Time  `json:"date"`
+}
+
+// A Submission is a score posted to the table with the replay of its
+// round, the file written by play --record.
+type Submission struct {
+	Name    string  `json:"name"`
+	Points  int     `json:"points"`
+	Level   int     `json:"level"`
+	Replay  string  `json:"replay"`
+}
+
+// A Server serves the table of the file Path: GET /scores lists it,
+// best first, POST /scores adds a Submission once its replay scored
+// what it claims. The replays are played again a few at a time, and
+// each one only makes one score: the hashes of those taken are kept in
+// the file Path+REPLAYS_SUFFIX.
+type Server struct {
+	Path      string
+	Log       *slog.Logger
+
+	once      sync.Once
+	http      *http.Server
+	verifying chan struct{}
+	taking    sync.Mutex
+}
+
+func (s *Server) init() {
+	mux := http.NewServeMux()
+	mux.HandleFunc(SCORES_PATH, s.serveScores)
+	s.http      = &http.Server{ Handler: mux, ReadHeaderTimeout: HEADER_TIMEOUT }
+	s.verifying = make(chan struct{}, runtime.NumCPU())
+	if s.Log == nil { s.Log = slog.New(slog.DiscardHandler) }
+}
+
+// Serve accepts the connections on ln until it is closed.
+func (s *Server) Serve(ln net.Listener) error {
+	s.once.Do(s.init)
+	return s.http.Serve(ln)
+}
+
+// Close stops the server and drops its connections.
+func (s *Server) Close() {
+	s.once.Do(s.init)
+	s.http.Close()
+}
+
+// ServeHTTP serves the API, as an http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.once.Do(s.init)
+	s.http.Handler.ServeHTTP(w, r)
+}
+
+func (s *Server) serveScores(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			s.list(w)
+		case http.MethodPost:
+			s.submit(w, r)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			reply(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+func (s *Server) list(w http.ResponseWriter) {
+	scores, err := space.LoadScores(s.Path)
+	if err != nil {
+		s.Log.Error("scores", "err", err)
+		reply(w, http.StatusInternalServerError, errors.New("the table cannot be read"))
+		return
+	}
+
+	entries := []Entry{}
+	for _, score := range scores {
+		entries = append(entries, Entry{ score.Name, score.Points, score.Level, score.Date.UTC() })
+	}
+	reply(w, http.StatusOK, entries)
+}
+
+// submit plays the replay of a submission again and takes its score if
+// it is the one claimed.
+func (s *Server) submit(w http.ResponseWriter, r *http.Request) {
+	var sub Submission
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, MAX_BODY))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&sub); err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			reply(w, http.StatusRequestEntityTooLarge, fmt.Errorf("the submission is over %d bytes", MAX_BODY))
+			return
+		}
+		reply(w, http.StatusBadRequest, fmt.Errorf("bad submission: %v", err))
+		return
+	}
+	if err := checkName(sub.Name); err != nil {
+		reply(w, http.StatusBadRequest, err)
+		return
+	}
+	replay, err := space.ReadReplay(strings.NewReader(sub.Replay), "replay")
+	if err != nil {
+		reply(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.verifying <- struct{}{}
+	verdict, err := space.Verify(replay)
+	<- s.verifying
+	if err == nil { err = verdict.Mismatch(replay.End) }
+
+	log := s.Log.With("player", sub.Name, "points", sub.Points, "level", sub.Level, "addr", r.RemoteAddr)
+	switch {
+		case err != nil:
+			log.Warn("score refused", "err", err)
+			reply(w, http.StatusUnprocessableEntity, err)
+			return
+		case verdict.Points != sub.Points || verdict.Level != sub.Level:
+			log.Warn("score refused", "replayed points", verdict.Points, "replayed level", verdict.Level)
+			reply(w, http.StatusUnprocessableEntity, fmt.Errorf("the replay scores %d at level %d, not %d at level %d",
+			                                                   verdict.Points, verdict.Level, sub.Points, sub.Level))
+			return
+		case verdict.Points == 0:
+			reply(w, http.StatusUnprocessableEntity, errors.New("the replay scores nothing"))
+			return
+	}
+
+	hash := replayHash(replay, verdict)
+	s.taking.Lock()
+	defer s.taking.Unlock()
+	if taken, err := s.taken(hash); err != nil || taken {
+		s.refuseTaken(w, err)
+		return
+	}
+	score := space.Score{ Points: sub.Points, Level: sub.Level, Date: time.Now().UTC(), Name: sub.Name }
+	err = space.SaveScore(s.Path, score)
+	if err == nil { err = s.take(hash) }
+	if err != nil {
+		log.Error("scores", "err", err)
+		reply(w, http.StatusInternalServerError, errors.New("the table cannot be written"))
+		return
+	}
+	log.Info("score taken", "ticks", verdict.Ticks)
+	reply(w, http.StatusCreated, Entry{ score.Name, score.Points, score.Level, score.Date })
+}
+
+// replayHash identifies the round of a replay: the same seed,
+// difficulty and size and the same keys play the same game. Only the
+// keys the verdict played count, so that adding keys after the end
+// does not make another round.
+func replayHash(replay *space.Replay, verdict space.Verdict) string {
+	level, _ := space.DifficultyByName(replay.Difficulty)
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n%s\n%d %d\n", replay.Seed, space.Difficulties[level].Name, replay.Rows, replay.Cols)
+	for _, key := range replay.Keys[:verdict.Keys] { fmt.Fprintf(h, "%d %d\n", key.Tick, key.Key) }
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// taken tells whether the replay of hash already made a score.
+func (s *Server) taken(hash string) (bool, error) {
+	data, err := os.ReadFile(s.Path + REPLAYS_SUFFIX)
+	if errors.Is(err, fs.ErrNotExist) { return false, nil }
+	if err != nil { return false, err }
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == hash { return true, nil }
+	}
+	return false, nil
+}
+
+// take records that the replay of hash made a score.
+func (s *Server) take(hash string) error {
+	file, err := os.OpenFile(s.Path + REPLAYS_SUFFIX, os.O_WRONLY | os.O_CREATE | os.O_APPEND, 0644)
+	if err != nil { return err }
+	_, err = fmt.Fprintln(file, hash)
+	if cerr := file.Close(); err == nil { err = cerr }
+	return err
+}
+
+// refuseTaken answers a replay that already made a score, or the error
+// that kept from knowing.
+func (s *Server) refuseTaken(w http.ResponseWriter, err error) {
+	if err != nil {
+		s.Log.Error("replays", "err", err)
+		reply(w, http.StatusInternalServerError, errors.New("the replays cannot be read"))
+		return
+	}
+	reply(w, http.StatusConflict, errors.New("the replay already made a score"))
+}
+
+// checkName takes the names that fit in the table: printable, without
+// tabs, and not too long.
+func checkName(name string) error {
+	if strings.TrimSpace(name) == "" { return errors.New("the name is missing") }
+	if len([]rune(name)) > MAX_NAME { return fmt.Errorf("the name is longer than %d characters", MAX_NAME) }
+	for _, r := range name {
+		if !unicode.IsPrint(r) { return fmt.Errorf("the name has the character %q", r) }
+	}
+	return nil
+}
+
+// reply sends v as JSON, an error as {"error": "..."}.
+func reply(w http.ResponseWriter, status int, v any) {
+	if err, ok := v.(error); ok { v = map[string]string{ "error": err.Error() } }
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
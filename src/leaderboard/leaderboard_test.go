@@ -0,0 +1,98 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package leaderboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The round of testdata/round.replay and its score.
+const (
+	REPLAY_FILE   = "testdata/round.replay"
+	REPLAY_POINTS = 30
+	REPLAY_LEVEL  = 1
+)
+
+func post(t *testing.T, url string, sub Submission) (int, map[string]any) {
+	t.Helper()
+	body, _ := json.Marshal(sub)
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil { t.Fatal(err) }
+	defer resp.Body.Close()
+
+	var reply map[string]any
+	json.NewDecoder(resp.Body).Decode(&reply)
+	return resp.StatusCode, reply
+}
+
+// Only the scores that their replay makes again get in the table.
+func TestScores(t *testing.T) {
+	replay, err := os.ReadFile(REPLAY_FILE)
+	if err != nil { t.Fatal(err) }
+	server := httptest.NewServer(&Server{ Path: filepath.Join(t.TempDir(), "scores") })
+	defer server.Close()
+	url := server.URL + SCORES_PATH
+	padded := string(replay) + "999999 63\n"
+	renamed := strings.Replace(string(replay), "difficulty NORMAL", "difficulty normal", 1)
+
+	for _, c := range []struct {
+		sub     Submission
+		status  int
+	}{
+		{ Submission{ "alice", REPLAY_POINTS * 10, REPLAY_LEVEL, string(replay) }, http.StatusUnprocessableEntity },
+		{ Submission{ "alice", REPLAY_POINTS, REPLAY_LEVEL + 1, string(replay) }, http.StatusUnprocessableEntity },
+		{ Submission{ "alice", REPLAY_POINTS, REPLAY_LEVEL, "not a replay" }, http.StatusBadRequest },
+		{ Submission{ "al\tice", REPLAY_POINTS, REPLAY_LEVEL, string(replay) }, http.StatusBadRequest },
+		{ Submission{ "", REPLAY_POINTS, REPLAY_LEVEL, string(replay) }, http.StatusBadRequest },
+		{ Submission{ "alice", REPLAY_POINTS, REPLAY_LEVEL, string(replay) }, http.StatusCreated },
+		{ Submission{ "alice", REPLAY_POINTS, REPLAY_LEVEL, string(replay) }, http.StatusConflict },
+		{ Submission{ "bob", REPLAY_POINTS, REPLAY_LEVEL, string(replay) }, http.StatusConflict },
+		{ Submission{ "carol", REPLAY_POINTS, REPLAY_LEVEL, padded }, http.StatusConflict },
+		{ Submission{ "dave", REPLAY_POINTS, REPLAY_LEVEL, renamed }, http.StatusConflict },
+	} {
+		if status, reply := post(t, url, c.sub); status != c.status {
+			t.Errorf("%q %d at level %d got %d %v, want %d", c.sub.Name, c.sub.Points, c.sub.Level, status, reply, c.status)
+		}
+	}
+
+	resp, err := http.Get(url)
+	if err != nil { t.Fatal(err) }
+	var entries []Entry
+	err = json.NewDecoder(resp.Body).Decode(&entries)
+	resp.Body.Close()
+	if err != nil { t.Fatal(err) }
+	if len(entries) != 1 || entries[0].Name != "alice" || entries[0].Points != REPLAY_POINTS || entries[0].Date.IsZero() {
+		t.Errorf("the table is %+v", entries)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, url, nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed { t.Errorf("DELETE got %s", resp.Status) }
+}
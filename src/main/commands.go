@@ -0,0 +1,348 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"space"
+)
+
+const (
+	BENCH_FRAMES = 2000
+	BENCH_ROWS   = space.MIN_ROWS + 10
+	BENCH_COLS   = space.MIN_COLS + 50
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{ "play",   "play the game (default)",            playCommand },
+		{ "replay", "play back a game recorded with --record", replayCommand },
+		{ "verify", "play a replay again to check its score", verifyCommand },
+		{ "join",   "join a co-op game hosted with --host", joinCommand },
+		{ "versus", "play a match against another player", versusCommand },
+		{ "scores", "print the high-score table",         scoresCommand },
+		{ "serve",  "host games for remote players",      serveCommand },
+		{ "bench",  "measure the rendering speed",        benchCommand },
+	}
+}
+
+func dispatch(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		switch {
+			case len(args) > 0 && isHelp(args[0]):
+				usage(os.Stdout)
+				return space.NO_ERROR
+			case len(args) > 0 && (args[0] == "--version" || args[0] == "-version"):
+				fmt.Printf("%s %s\n", programName(), space.VERSION)
+				return space.NO_ERROR
+		}
+		return playCommand(args)
+	}
+
+	for _, c := range commands {
+		if c.name == args[0] { return c.run(args[1:]) }
+	}
+	if args[0] == "help" {
+		usage(os.Stdout)
+		return space.NO_ERROR
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: unknown command %q\n\n", programName(), args[0])
+	usage(os.Stderr)
+	return space.USAGE_ERROR
+}
+
+func usage(out *os.File) {
+	fmt.Fprintf(out, "Usage: %s [command] [flags]\n\nCommands:\n", programName())
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-8s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(out, "\nRun '%s <command> --help' for the flags of a command, '%s --version' for the version.\n",
+	            programName(), programName())
+}
+
+func isHelp(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+func programName() string {
+	return filepath.Base(os.Args[0])
+}
+
+// newFlags returns a flag set for the command whose --help prints
+// the synopsis followed by the flags.
+func newFlags(name, synopsis string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s %s\n\nFlags:\n", programName(), name, synopsis)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parse handles --help and flag errors, returning the exit code to
+// use when the command must not go on.
+func parse(flags *flag.FlagSet, args []string) (int, bool) {
+	switch err := flags.Parse(args); {
+		case err == flag.ErrHelp:
+			return space.NO_ERROR, false
+		case err != nil:
+			return space.USAGE_ERROR, false
+	}
+	return space.NO_ERROR, true
+}
+
+// displayFlags are shared by the commands that open the game screen.
+func displayFlags(flags *flag.FlagSet, opts *space.Options) {
+	flags.StringVar(&opts.ConfigPath, "config", "", "read and save the settings in `file` (default " + space.ConfigPath() + ")")
+	flags.StringVar(&opts.Theme, "theme", "", "color `theme`: " + themeNames())
+	flags.IntVar(&opts.FPS, "fps", 0, fmt.Sprintf("frames per second, %d to %d", space.MIN_FPS, space.MAX_FPS))
+	flags.BoolVar(&opts.NoBell, "no-bell", false, "do not ring the terminal bell")
+	flags.BoolVar(&opts.Debug, "debug", false, "show the debug overlay, toggled with the debug key")
+	logFlags(flags, opts)
+}
+
+func logFlags(flags *flag.FlagSet, opts *space.Options) {
+	flags.StringVar(&opts.Log, "log", "", "append a JSON log of the game to `file`")
+	flags.StringVar(&opts.LogLevel, "log-level", space.LOG_LEVEL, "least `level` logged: debug, info, warn or error")
+}
+
+func playCommand(args []string) int {
+	var opts space.Options
+
+	flags := newFlags("play", "[flags]")
+	displayFlags(flags, &opts)
+	flags.Int64Var(&opts.Seed, "seed", 0, "random `seed`, to play the same game again (default random)")
+	flags.StringVar(&opts.Difficulty, "difficulty", "", "`level`: " + difficultyNames())
+	flags.BoolVar(&opts.NoTitle, "no-title", false, "skip the title screen and start playing")
+	flags.StringVar(&opts.Record, "record", "", "record the game to `file`, to watch it with replay")
+	flags.StringVar(&opts.Save, "save", "", "save the round to `file` when quitting it with the quit key")
+	resume := flags.String("resume", "", "resume the round saved in `file`")
+	flags.StringVar(&opts.Host, "host", "", "host a co-op game on `address`, as :7777, for a second player to join")
+	flags.StringVar(&opts.Spectate, "spectate", "", "let anyone watch the game from `address`, as :2424, with nc or telnet")
+
+	if code, ok := parse(flags, args); !ok { return code }
+	if flags.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "play: unexpected argument %q\n", flags.Arg(0))
+		return space.USAGE_ERROR
+	}
+	if opts.Host != "" && opts.Record != "" {
+		fmt.Fprintln(os.Stderr, "play: a co-op game cannot be recorded")
+		return space.USAGE_ERROR
+	}
+	if opts.Host != "" && (opts.Save != "" || *resume != "") {
+		fmt.Fprintln(os.Stderr, "play: a co-op game cannot be saved")
+		return space.USAGE_ERROR
+	}
+	if *resume != "" && opts.Record != "" {
+		fmt.Fprintln(os.Stderr, "play: a resumed game cannot be recorded")
+		return space.USAGE_ERROR
+	}
+
+	if *resume != "" {
+		saved, err := space.LoadSave(*resume)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "play: %v\n", err)
+			return space.FILE_ERROR
+		}
+		opts.Resume = saved
+	}
+
+	return play(opts)
+}
+
+func replayCommand(args []string) int {
+	var opts space.Options
+
+	flags := newFlags("replay", "[flags] FILE")
+	displayFlags(flags, &opts)
+
+	if code, ok := parse(flags, args); !ok { return code }
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return space.USAGE_ERROR
+	}
+
+	replay, err := space.LoadReplay(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "replay: %v\n", err)
+		return space.FILE_ERROR
+	}
+	opts.Replay = replay
+
+	return play(opts)
+}
+
+// verifyCommand plays a replay again, headless, and checks that it
+// makes the score it claims, and the one given on the command line.
+func verifyCommand(args []string) int {
+	flags  := newFlags("verify", "[flags] FILE")
+	points := flags.Int("points", -1, "check that the round scores `n` points")
+	level  := flags.Int("level", -1, "check that the round ends at `level`")
+
+	if code, ok := parse(flags, args); !ok { return code }
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return space.USAGE_ERROR
+	}
+
+	path := flags.Arg(0)
+	replay, err := space.LoadReplay(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verify: %v\n", err)
+		return space.FILE_ERROR
+	}
+	verdict, err := space.Verify(replay)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verify: %s: %v\n", path, err)
+		return space.VERIFY_ERROR
+	}
+	fmt.Printf("%s: %d points, level %d, %s after %v\n", path, verdict.Points, verdict.Level,
+	           space.Causes[verdict.Cause], time.Duration(verdict.Ticks) * space.TICK)
+
+	given := space.ReplayEnd{ Points: *points, Level: *level, Cause: verdict.Cause }
+	if given.Points < 0 { given.Points = verdict.Points }
+	if given.Level < 0 { given.Level = verdict.Level }
+	for _, claimed := range []*space.ReplayEnd{ replay.End, &given } {
+		if err := verdict.Mismatch(claimed); err != nil {
+			fmt.Fprintf(os.Stderr, "verify: %s: %v\n", path, err)
+			return space.VERIFY_ERROR
+		}
+	}
+	return space.NO_ERROR
+}
+
+func joinCommand(args []string) int {
+	var opts space.Options
+
+	flags := newFlags("join", "[flags] HOST:PORT")
+	flags.StringVar(&opts.ConfigPath, "config", "", "read the keys in `file` (default " + space.ConfigPath() + ")")
+	logFlags(flags, &opts)
+
+	if code, ok := parse(flags, args); !ok { return code }
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return space.USAGE_ERROR
+	}
+
+	addr := flags.Arg(0)
+	return run(opts, func(game *space.Playground) error { return game.Join(addr) })
+}
+
+func versusCommand(args []string) int {
+	var opts space.Options
+
+	flags := newFlags("versus", "[flags] --host ADDRESS | HOST:PORT")
+	displayFlags(flags, &opts)
+	flags.StringVar(&opts.Host, "host", "", "host the match on `address`, as :7777, for the other player to join")
+	flags.IntVar(&opts.Rounds, "rounds", space.VERSUS_ROUNDS, "best of `n` rounds, set by the host")
+	flags.Int64Var(&opts.Seed, "seed", 0, "random `seed` of the first round, set by the host (default random)")
+	flags.StringVar(&opts.Difficulty, "difficulty", "", "`level`, set by the host: " + difficultyNames())
+
+	if code, ok := parse(flags, args); !ok { return code }
+	switch {
+		case opts.Host == "" && flags.NArg() == 1:
+			opts.Rival = flags.Arg(0)
+		case opts.Host == "" || flags.NArg() > 0:
+			flags.Usage()
+			return space.USAGE_ERROR
+	}
+	if opts.Rounds < 1 {
+		fmt.Fprintln(os.Stderr, "versus: the match needs at least one round")
+		return space.USAGE_ERROR
+	}
+
+	return run(opts, (*space.Playground).Versus)
+}
+
+func scoresCommand(args []string) int {
+	flags := newFlags("scores", "[flags]")
+	file  := flags.String("file", space.ScoresPath(), "high-score `file`")
+
+	if code, ok := parse(flags, args); !ok { return code }
+
+	scores, err := space.LoadScores(*file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "scores: %v\n", err)
+		return space.FILE_ERROR
+	}
+	if len(scores) == 0 {
+		fmt.Println("No scores yet")
+		return space.NO_ERROR
+	}
+
+	for i, s := range scores {
+		fmt.Printf("%2d. %-16s %*d  level %-3d %s\n", i + 1, s.Name, space.MAX_SCORE_LEN, s.Points, s.Level,
+		           s.Date.Local().Format("2006-01-02 15:04"))
+	}
+	return space.NO_ERROR
+}
+
+func benchCommand(args []string) int {
+	flags  := newFlags("bench", "[flags]")
+	frames := flags.Int("frames", BENCH_FRAMES, "number of `frames` to render")
+	rows   := flags.Int("rows", BENCH_ROWS, "screen `rows`")
+	cols   := flags.Int("cols", BENCH_COLS, "screen `columns`")
+	seed   := flags.Int64("seed", 1, "random `seed`")
+
+	if code, ok := parse(flags, args); !ok { return code }
+	if *rows < space.MIN_ROWS || *cols < space.MIN_COLS || *frames < 1 {
+		fmt.Fprintf(os.Stderr, "bench: the screen must be at least %dx%d and frames positive\n",
+		            space.MIN_COLS, space.MIN_ROWS)
+		return space.USAGE_ERROR
+	}
+
+	result := space.Bench(*rows, *cols, *frames, *seed)
+	perFrame := result.Elapsed / time.Duration(result.Frames)
+	fmt.Printf("%d frames of %dx%d in %v: %v per frame, %.0f fps, %d bytes per frame\n",
+	           result.Frames, *cols, *rows, result.Elapsed.Round(time.Microsecond), perFrame,
+	           float64(time.Second) / float64(perFrame), result.Bytes / result.Frames)
+	return space.NO_ERROR
+}
+
+func difficultyNames() string {
+	var names []string
+	for _, d := range space.Difficulties {
+		names = append(names, strings.ToLower(d.Name))
+	}
+	return strings.Join(names, ", ")
+}
+
+func themeNames() string {
+	var names []string
+	for _, t := range space.Themes {
+		names = append(names, strings.ToLower(t.Name))
+	}
+	return strings.Join(names, ", ")
+}
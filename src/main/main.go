@@ -19,22 +19,34 @@
 
 package main
 
-import "space"
+import (
+	"os"
+	"space"
+)
 
 func main(){
-	var play space.Playground
-
-	play.InitPlayground()
+	os.Exit(dispatch(os.Args[1:]))
+}
 
-	defer play.CanonicMode()
-	play.RawMode()
+// play runs the game; the terminal is given back before an error is
+// reported.
+func play(opts space.Options) int {
+	return run(opts, (*space.Playground).Play)
+}
 
-	go play.Events()
+// run sets the terminal up for the game and hands it to f.
+func run(opts space.Options, f func(game *space.Playground) error) int {
+	var game space.Playground
 
-	play.InitScreen()
-	play.MoveSprite(space.DIR_LEFT)
+	if err := game.InitPlayground(opts); err != nil {
+		game.CloseLog(err)
+		return space.Report(os.Stderr, err)
+	}
 
-	go play.DeployEnemies(space.STD_ENEMY_GROUP)
+	err := game.RawMode()
+	if err == nil { err = f(&game) }
+	game.CanonicMode()
+	game.CloseLog(err)
 
-	for { play.ActionKey() }
+	return space.Report(os.Stderr, err)
 }
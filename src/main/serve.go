@@ -0,0 +1,255 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"leaderboard"
+	"space"
+	"ssh"
+	"telnet"
+	"web"
+)
+
+const HOST_KEY_FILE = ".systemInvaders.hostkey"
+
+func serveCommand(args []string) int {
+	var opts space.Options
+
+	flags := newFlags("serve", "[flags] --ssh ADDRESS | --telnet ADDRESS | --http ADDRESS | --leaderboard ADDRESS")
+	displayFlags(flags, &opts)
+	flags.StringVar(&opts.Difficulty, "difficulty", "", "`level`: " + difficultyNames())
+	sshAddr    := flags.String("ssh", "", "accept SSH connections on `address`, as :2222")
+	hostKey    := flags.String("host-key", hostKeyPath(), "SSH host key `file`, made the first time")
+	telnetAddr := flags.String("telnet", "", "accept telnet connections on `address`, as :2323")
+	httpAddr   := flags.String("http", "", "serve the game to browsers on `address`, as :8080")
+	boardAddr  := flags.String("leaderboard", "", "serve the high-score table as JSON on `address`, as :8081")
+	flags.StringVar(&opts.Spectate, "spectate", "", "let anyone watch the games from `address`, as :2424, with nc or telnet")
+
+	if code, ok := parse(flags, args); !ok { return code }
+	if *sshAddr == "" && *telnetAddr == "" && *httpAddr == "" && *boardAddr == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return space.USAGE_ERROR
+	}
+
+	log, logFile, err := space.OpenLog(opts.Log, opts.LogLevel)
+	if err != nil { return space.Report(os.Stderr, err) }
+	if logFile != nil { defer logFile.Close() }
+	opts.Log = ""
+	if _, err := opts.Config(); err != nil { return space.Report(os.Stderr, err) }
+	h := &host{ opts: opts, log: log }
+
+	var services []service
+	defer func() {
+		for _, s := range services {
+			s.ln.Close()
+		}
+	}()
+
+	if *sshAddr != "" {
+		key, err := ssh.LoadHostKey(*hostKey)
+		if err != nil { return space.Report(os.Stderr, &space.Error{ Code: space.FILE_ERROR, Err: err }) }
+		ln, err := net.Listen("tcp", *sshAddr)
+		if err != nil { return space.Report(os.Stderr, &space.Error{ Code: space.NET_ERROR, Err: err }) }
+
+		server := &ssh.Server{ HostKey: key, Handler: h.serveSSH }
+		services = append(services, service{ ln, server })
+		fmt.Fprintf(os.Stderr, "serve: SSH on %s, host key %s\n", ln.Addr(), ssh.Fingerprint(key))
+		log.Info("serving", "ssh", ln.Addr().String(), "host key", ssh.Fingerprint(key))
+	}
+	if *telnetAddr != "" {
+		ln, err := net.Listen("tcp", *telnetAddr)
+		if err != nil { return space.Report(os.Stderr, &space.Error{ Code: space.NET_ERROR, Err: err }) }
+
+		server := &telnet.Server{ Handler: h.serveTelnet }
+		services = append(services, service{ ln, server })
+		fmt.Fprintf(os.Stderr, "serve: telnet on %s\n", ln.Addr())
+		log.Info("serving", "telnet", ln.Addr().String())
+	}
+	if *httpAddr != "" {
+		ln, err := net.Listen("tcp", *httpAddr)
+		if err != nil { return space.Report(os.Stderr, &space.Error{ Code: space.NET_ERROR, Err: err }) }
+
+		server := &web.Server{ Handler: h.serveWeb }
+		services = append(services, service{ ln, server })
+		fmt.Fprintf(os.Stderr, "serve: browsers on http://%s/\n", ln.Addr())
+		log.Info("serving", "http", ln.Addr().String())
+	}
+	if *boardAddr != "" {
+		ln, err := net.Listen("tcp", *boardAddr)
+		if err != nil { return space.Report(os.Stderr, &space.Error{ Code: space.NET_ERROR, Err: err }) }
+
+		server := &leaderboard.Server{ Path: space.ScoresPath(), Log: log }
+		services = append(services, service{ ln, server })
+		fmt.Fprintf(os.Stderr, "serve: leaderboard on http://%s%s\n", ln.Addr(), leaderboard.SCORES_PATH)
+		log.Info("serving", "leaderboard", ln.Addr().String())
+	}
+	if opts.Spectate != "" {
+		ln, err := net.Listen("tcp", opts.Spectate)
+		if err != nil { return space.Report(os.Stderr, &space.Error{ Code: space.NET_ERROR, Err: err }) }
+
+		services = append(services, service{ ln, newSpectateServer(h) })
+		fmt.Fprintf(os.Stderr, "serve: spectators on %s\n", ln.Addr())
+		log.Info("serving", "spectate", ln.Addr().String())
+	}
+
+	return serve(log, services)
+}
+
+// A service is a server of games with the listener of its connections.
+type service struct {
+	ln      net.Listener
+	server  interface {
+		Serve(ln net.Listener) error
+		Close()
+	}
+}
+
+// serve runs the services until one of them fails or the process is
+// told to stop, which ends the games in progress.
+func serve(log *slog.Logger, services []service) int {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	failed := make(chan error, len(services))
+	for _, s := range services {
+		go func(s service) { failed <- s.server.Serve(s.ln) }(s)
+	}
+
+	code := space.NO_ERROR
+	select {
+		case sig := <- signals:
+			log.Info("signal", "signal", sig.String())
+		case err := <- failed:
+			log.Error("server stopped", "err", err)
+			code = space.Report(os.Stderr, &space.Error{ Code: space.NET_ERROR, Err: err })
+	}
+	for _, s := range services {
+		s.ln.Close()
+		s.server.Close()
+	}
+	return code
+}
+
+// A host is what the sessions of the server share: the options of the
+// games, the log and the games in progress.
+type host struct {
+	opts    space.Options
+	log     *slog.Logger
+	games   games
+}
+
+// serveSSH plays a game on the terminal of an SSH session, or shows
+// one to a spectator, who logs in as SPECTATOR_USER.
+func (h *host) serveSSH(s *ssh.Session) int {
+	log := h.log.With("player", s.User, "addr", s.RemoteAddr.String())
+	if s.User == SPECTATOR_USER {
+		log.Info("spectator")
+		h.games.watch(context.Background(), s)
+		return space.NO_ERROR
+	}
+	if s.Term == "" {
+		fmt.Fprintln(crlf{ s }, "The game needs a terminal: connect with ssh -t")
+		return space.USAGE_ERROR
+	}
+	remote := space.Remote{ Conn: s, Term: s.Term, Size: s.Size, Player: s.User, Log: log }
+	return h.playRemote(remote, s.Resized())
+}
+
+// serveTelnet plays a game on the terminal of a telnet connection; the
+// player has no name but the address.
+func (h *host) serveTelnet(s *telnet.Session) {
+	name, _, _ := net.SplitHostPort(s.RemoteAddr.String())
+	remote := space.Remote{ Conn: s, Term: s.Term, Size: s.Size, Player: name,
+	                        Log: h.log.With("player", name, "addr", s.RemoteAddr.String()) }
+	h.playRemote(remote, s.Resized())
+}
+
+// serveWeb plays a game on the terminal of a page; the player is named
+// in the address of the page, or after the address of the browser.
+func (h *host) serveWeb(s *web.Session) {
+	name := s.Player
+	if name == "" { name, _, _ = net.SplitHostPort(s.RemoteAddr.String()) }
+	remote := space.Remote{ Conn: s, Term: s.Term, Size: s.Size, Player: name,
+	                        Log: h.log.With("player", name, "addr", s.RemoteAddr.String()) }
+	h.playRemote(remote, s.Resized())
+}
+
+// playRemote plays a game on the remote terminal r, resized when told
+// so by resized, for the spectators to watch; an error is reported on
+// the terminal.
+func (h *host) playRemote(r space.Remote, resized <-chan struct{}) int {
+	r.Log.Info("session started", "term", r.Term)
+
+	var game space.Playground
+	err := game.InitRemote(h.opts, r)
+	if err == nil { err = game.RawMode() }
+	if err == nil {
+		h.games.add(game.Spectators())
+		defer h.games.remove(game.Spectators())
+
+		done := make(chan struct{})
+		go func() {
+			for {
+				select {
+					case <- resized:
+						game.Resize()
+					case <- done:
+						return
+				}
+			}
+		}()
+		err = game.Play()
+		close(done)
+	}
+	game.CanonicMode()
+
+	code := space.Report(crlf{ r.Conn }, err)
+	r.Log.Info("session ended", "exit", code)
+	return code
+}
+
+// crlf ends the lines with CR LF, for a terminal in raw mode.
+type crlf struct {
+	io.Writer
+}
+
+func (w crlf) Write(b []byte) (int, error) {
+	_, err := w.Writer.Write(bytes.ReplaceAll(b, []byte("\n"), []byte("\r\n")))
+	return len(b), err
+}
+
+func hostKeyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil { home = "." }
+	return filepath.Join(home, HOST_KEY_FILE)
+}
@@ -0,0 +1,176 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"space"
+)
+
+const (
+	SPECTATOR_USER = "watch"
+	MAX_PICK       = 9
+)
+
+// games are the games in progress on the server, for the spectators.
+type games struct {
+	mu    sync.Mutex
+	list  []*space.Broadcast
+}
+
+func (g *games) add(b *space.Broadcast) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.list = append(g.list, b)
+}
+
+func (g *games) remove(b *space.Broadcast) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i := range g.list {
+		if g.list[i] == b {
+			g.list = append(g.list[:i], g.list[i + 1:]...)
+			return
+		}
+	}
+}
+
+func (g *games) all() []*space.Broadcast {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]*space.Broadcast(nil), g.list...)
+}
+
+// watch lets a spectator pick one of the games in progress and shows
+// it to them until it is over or they press q, then again, until they
+// leave. Nothing they type reaches the game.
+func (g *games) watch(ctx context.Context, conn io.ReadWriter) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	out := crlf{ conn }
+
+	keys := make(chan byte)
+	go func() {
+		defer close(keys)
+		k := make([]byte, 1)
+		for {
+			n, err := conn.Read(k)
+			if err != nil { return }
+			if n == 0 { continue }
+			select {
+				case keys <- k[0]:
+				case <- ctx.Done():
+					return
+			}
+		}
+	}()
+
+	for {
+		list := g.all()
+		if len(list) == 0 {
+			fmt.Fprintln(out, "No game in progress, come back later.")
+			return
+		}
+		if len(list) > MAX_PICK { list = list[:MAX_PICK] }
+
+		fmt.Fprintln(out, "Games in progress:")
+		for i, b := range list {
+			fmt.Fprintf(out, "  %d. %s, %d watching\n", i + 1, b.Player(), b.Viewers())
+		}
+		fmt.Fprint(out, "Watch which one? q to leave: ")
+
+		var pick *space.Broadcast
+		for pick == nil {
+			k, ok := <- keys
+			switch {
+				case !ok || k == 'q':
+					return
+				case k >= '1' && int(k - '0') <= len(list):
+					pick = list[k - '1']
+			}
+		}
+
+		if !show(ctx, conn, pick, keys) { return }
+	}
+}
+
+// show shows the game b until it is over or the spectator presses q;
+// false tells that the spectator is gone.
+func show(ctx context.Context, conn io.Writer, b *space.Broadcast, keys <-chan byte) bool {
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	done := make(chan error, 1)
+	go func() { done <- b.Watch(ctx, conn) }()
+	for {
+		select {
+			case k, ok := <- keys:
+				if ok && k != 'q' { continue }
+				stop()
+				<- done
+				return ok
+			case err := <- done:
+				return err == nil
+		}
+	}
+}
+
+// A spectateServer shows the games of the server to anyone who connects
+// with nc or telnet.
+type spectateServer struct {
+	h       *host
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func newSpectateServer(h *host) *spectateServer {
+	s := &spectateServer{ h: h }
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s
+}
+
+func (s *spectateServer) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil { return err }
+
+		s.h.log.Info("spectator", "addr", conn.RemoteAddr().String())
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			defer context.AfterFunc(s.ctx, func() { conn.Close() })()
+			s.h.games.watch(s.ctx, conn)
+		}()
+	}
+}
+
+// Close drops the spectators.
+func (s *spectateServer) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
@@ -0,0 +1,175 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package sound
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	SAMPLE_RATE     = 8000
+	SAMPLE_BITS     = 8
+	SILENCE         = 0x80
+	AMPLITUDE       = 48
+	WAV_HEADER_LEN  = 44
+	WAV_STREAM_LEN  = 0x7FFFFFFF
+	NOISE_SEED      = 0xACE1
+)
+
+// A tone is a square wave sliding from freq to end, or white noise.
+type tone struct {
+	freq, end  float64
+	ms         int
+	noise      bool
+}
+
+var voices = [NUM_EVENTS][]tone{
+	FIRE:       { { 1200, 600, 60, false } },
+	ENEMY_HIT:  { { 0, 0, 120, true } },
+	BOSS_HIT:   { { 0, 0, 150, true }, { 400, 80, 300, false } },
+	PLAYER_HIT: { { 110, 70, 250, false } },
+	POWER_UP:   { { 523, 523, 80, false }, { 659, 659, 80, false }, { 784, 784, 120, false } },
+	GAME_OVER:  { { 392, 392, 250, false }, { 330, 330, 250, false }, { 262, 196, 500, false } },
+}
+
+// PCM synthesizes the events as 8 bit mono WAV audio and writes it to
+// a file or to the standard input of a player command such as aplay.
+type PCM struct {
+	out     io.WriteCloser
+	cmd     *exec.Cmd
+	noise   uint16
+	written int
+	err     error
+}
+
+// StartPCM runs command, split on blanks, and streams the audio to it.
+// The command output is discarded to keep it off the game screen.
+func StartPCM(command string) (*PCM, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 { return nil, errors.New("empty sound command") }
+
+	cmd := exec.Command(args[0], args[1:]...)
+	in, err := cmd.StdinPipe()
+	if err != nil { return nil, err }
+	if err = cmd.Start(); err != nil { return nil, err }
+
+	pcm, err := NewPCM(in)
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, err
+	}
+	pcm.cmd = cmd
+	return pcm, nil
+}
+
+// CreatePCM writes the audio to a WAV file at path.
+func CreatePCM(path string) (*PCM, error) {
+	file, err := os.Create(path)
+	if err != nil { return nil, err }
+	return NewPCM(file)
+}
+
+func NewPCM(out io.WriteCloser) (*PCM, error) {
+	pcm := &PCM{ out: out, noise: NOISE_SEED }
+	if err := pcm.header(WAV_STREAM_LEN); err != nil { return nil, err }
+	return pcm, nil
+}
+
+// Play writes the samples of e; after a write error the backend goes
+// quiet, the error is reported by Close.
+func (p *PCM) Play(e Event) {
+	if p.err != nil { return }
+	samples := p.Samples(e)
+	_, p.err = p.out.Write(samples)
+	p.written += len(samples)
+}
+
+// Samples renders the sound of e.
+func (p *PCM) Samples(e Event) []byte {
+	var samples []byte
+	if e < 0 || e >= NUM_EVENTS { return samples }
+
+	for _, t := range voices[e] {
+		n := SAMPLE_RATE * t.ms / 1000
+		phase := 0.0
+		for i := 0; i < n; i++ {
+			var high bool
+			if t.noise {
+				p.noise ^= p.noise << 7
+				p.noise ^= p.noise >> 9
+				p.noise ^= p.noise << 8
+				high = p.noise & 1 == 1
+			} else {
+				freq := t.freq + (t.end - t.freq) * float64(i) / float64(n)
+				phase += freq / SAMPLE_RATE
+				high = phase - float64(int(phase)) < 0.5
+			}
+			if high {
+				samples = append(samples, SILENCE + AMPLITUDE)
+			} else {
+				samples = append(samples, SILENCE - AMPLITUDE)
+			}
+		}
+	}
+	return samples
+}
+
+// Close ends the stream; a WAV file gets its real length written back.
+func (p *PCM) Close() error {
+	if file, ok := p.out.(*os.File); ok && p.cmd == nil && p.err == nil {
+		if _, err := file.Seek(0, io.SeekStart); err == nil { p.err = p.header(p.written) }
+	}
+
+	err := p.out.Close()
+	if p.cmd != nil {
+		if waitErr := p.cmd.Wait(); err == nil { err = waitErr }
+	}
+	if p.err != nil { return p.err }
+	return err
+}
+
+func (p *PCM) header(dataLen int) error {
+	var h [WAV_HEADER_LEN]byte
+
+	riffLen := dataLen + WAV_HEADER_LEN - 8
+	if dataLen >= WAV_STREAM_LEN - WAV_HEADER_LEN { riffLen = WAV_STREAM_LEN }
+
+	copy(h[0:], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:], uint32(riffLen))
+	copy(h[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(h[16:], 16)
+	binary.LittleEndian.PutUint16(h[20:], 1)
+	binary.LittleEndian.PutUint16(h[22:], 1)
+	binary.LittleEndian.PutUint32(h[24:], SAMPLE_RATE)
+	binary.LittleEndian.PutUint32(h[28:], SAMPLE_RATE * SAMPLE_BITS / 8)
+	binary.LittleEndian.PutUint16(h[32:], SAMPLE_BITS / 8)
+	binary.LittleEndian.PutUint16(h[34:], SAMPLE_BITS)
+	copy(h[36:], "data")
+	binary.LittleEndian.PutUint32(h[40:], uint32(dataLen))
+
+	_, err := p.out.Write(h[:])
+	return err
+}
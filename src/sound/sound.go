@@ -0,0 +1,157 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+// Package sound turns game events into sounds. Events are posted on a
+// Bus, which routes each kind of event to its own Backend.
+package sound
+
+import (
+	"io"
+	"strings"
+	"sync"
+)
+
+type Event int
+
+const (
+	FIRE        Event = iota
+	ENEMY_HIT
+	BOSS_HIT
+	PLAYER_HIT
+	POWER_UP
+	GAME_OVER
+	NUM_EVENTS
+)
+
+const (
+	BELL            = '\U00000007'
+	BUS_QUEUE       = 32
+	BACKEND_BELL    = "bell"
+	BACKEND_SILENT  = "silent"
+	BACKEND_PCM     = "pcm"
+)
+
+var EventNames = [NUM_EVENTS]string{
+	FIRE:       "fire",
+	ENEMY_HIT:  "enemy-hit",
+	BOSS_HIT:   "boss-hit",
+	PLAYER_HIT: "player-hit",
+	POWER_UP:   "power-up",
+	GAME_OVER:  "game-over",
+}
+
+var BackendNames = []string{ BACKEND_BELL, BACKEND_SILENT, BACKEND_PCM }
+
+func (e Event) String() string {
+	if e < 0 || e >= NUM_EVENTS { return "unknown" }
+	return EventNames[e]
+}
+
+func EventByName(name string) (Event, bool) {
+	for e, n := range EventNames {
+		if n == name { return Event(e), true }
+	}
+	return NUM_EVENTS, false
+}
+
+func ValidBackend(name string) bool {
+	for _, n := range BackendNames {
+		if strings.EqualFold(n, name) { return true }
+	}
+	return false
+}
+
+// A Backend makes the sound of an event. Play is only called by the
+// bus goroutine, so backends need no locking of their own.
+type Backend interface {
+	Play(e Event)
+	Close() error
+}
+
+// Bus queues events from any goroutine and plays them in order on its
+// own goroutine, so that a slow backend never stalls the game.
+type Bus struct {
+	mu       sync.Mutex
+	routes   [NUM_EVENTS]Backend
+	queue    chan Event
+	done     chan struct{}
+}
+
+func NewBus() *Bus {
+	b := &Bus{ queue: make(chan Event, BUS_QUEUE), done: make(chan struct{}) }
+	for e := range b.routes {
+		b.routes[e] = Silent{}
+	}
+	go b.run()
+	return b
+}
+
+// Route sends every future e to backend.
+func (b *Bus) Route(e Event, backend Backend) {
+	b.mu.Lock()
+	b.routes[e] = backend
+	b.mu.Unlock()
+}
+
+// Emit posts e; when the queue is full the event is dropped rather
+// than blocking the caller.
+func (b *Bus) Emit(e Event) {
+	if e < 0 || e >= NUM_EVENTS { return }
+	select {
+		case b.queue <- e:
+		default:
+	}
+}
+
+// Close stops the bus after the queued events are played.
+func (b *Bus) Close() {
+	close(b.queue)
+	<- b.done
+}
+
+func (b *Bus) run() {
+	defer close(b.done)
+	for e := range b.queue {
+		b.mu.Lock()
+		backend := b.routes[e]
+		b.mu.Unlock()
+		backend.Play(e)
+	}
+}
+
+// Silent plays nothing.
+type Silent struct{}
+
+func (Silent) Play(e Event)  {}
+func (Silent) Close() error  { return nil }
+
+// Bell rings the terminal bell, twice for the explosions.
+type Bell struct {
+	Out io.Writer
+}
+
+func (b Bell) Play(e Event) {
+	rings := 1
+	switch e {
+		case ENEMY_HIT, BOSS_HIT, GAME_OVER: rings = 2
+	}
+	io.WriteString(b.Out, strings.Repeat(string(BELL), rings))
+}
+
+func (b Bell) Close() error { return nil }
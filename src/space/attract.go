@@ -0,0 +1,60 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+const (
+	DEMO_STEP       = TIMER_LEVEL_A
+	DEMO_FIRE_STEPS = 4
+	DEMO_HELP       = "DEMO - press any key to return to the title screen"
+)
+
+// autopilot plays the attract mode demo, a move every DEMO_STEP: it
+// chases the lowest thing on the playfield and fires when lined up
+// under it.
+func (p *Playground) autopilot() {
+	if p.stop { return }
+	if p.reload > 0 { p.reload-- }
+
+	target := p.demoTarget()
+	gun    := p.curCol + COL_START_LIMIT
+	switch {
+		case target < 0:
+		case target < gun:
+			p.MoveSprite(DIR_LEFT)
+		case target > gun:
+			p.MoveSprite(DIR_RIGHT)
+		case p.reload == 0:
+			p.reload = DEMO_FIRE_STEPS
+			p.deployMissile()
+	}
+}
+
+func (p *Playground) demoTarget() int {
+	for row := p.termRow - SPRITE_BEGIN - 2; row >= 0; row-- {
+		for col, r := range p.screen[row] {
+			switch r {
+				case SPACE_CHARAC, ENEMY_MISSILE, MISSILE_HEAD, MISSILE_BODY, MISSILE_TRAIL_A, MISSILE_TRAIL_B:
+				default:
+					return col + EN_MISS_ADJ
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,66 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+import (
+	"bytes"
+	"time"
+)
+
+const BENCH_INVADERS = STD_ENEMY_GROUP
+
+type BenchResult struct {
+	Frames   int
+	Bytes    int
+	Elapsed  time.Duration
+}
+
+// Bench measures drawing and encoding frames of a rows x cols screen
+// with a moving ship and falling invaders, without any terminal.
+func Bench(rows, cols, frames int, seed int64) BenchResult {
+	var (
+		p       Playground
+		frame   bytes.Buffer
+		result  BenchResult
+		invader = []rune("\U00002554\U00002550\U00002566\U00002550\U00002557")
+	)
+
+	p.headless(rows, cols, seed)
+
+	start := time.Now()
+	for i := 0; i < frames; i++ {
+		p.clearScreen()
+		for j := 0; j < BENCH_INVADERS; j++ {
+			copy(p.screen[(i + j) % (rows - SPRITE_BEGIN)][p.rng.Intn(cols - INVASOR_COLS):], invader)
+		}
+		for r := range p.sprite {
+			copy(p.screen[rows - (SPRITE_BEGIN - r)][(p.curCol + i) % (cols - SPRITE_COLS):], p.sprite[r])
+		}
+		p.score += STD_ENEM_POINT
+		p.drawHud()
+
+		p.frame(&frame)
+		result.Bytes += frame.Len()
+	}
+	result.Frames  = frames
+	result.Elapsed = time.Since(start)
+
+	return result
+}
@@ -0,0 +1,108 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+import (
+	"fmt"
+
+	"terminfo"
+)
+
+const (
+	STD_TERM        = "vt100"
+	MIN_COLORS      = 8
+	COLOR_NONE      = -1
+	COLOR_GREEN     = 2
+	COLOR_YELLOW    = 3
+	COLOR_BLUE      = 4
+	COLOR_MAGENTA   = 5
+	COLOR_CYAN      = 6
+)
+
+// MateTheme colors the ship of the second player of a co-op game.
+var MateTheme = Theme{ "MATE", COLOR_MAGENTA, COLOR_NONE, true, false }
+
+// LabelTheme shows the name of the player to the spectators.
+var LabelTheme = Theme{ "LABEL", COLOR_NONE, COLOR_NONE, true, true }
+
+// termCaps holds the control sequences of the terminal in use, looked
+// up once in the terminfo database.
+type termCaps struct {
+	name                      string
+	home, clear, sgr0, cup    string
+	civis, cnorm              string
+	smcup, rmcup              string
+	themes                    [len(Themes)]string
+	mate, label               string
+}
+
+// loadCaps describes term; the game needs at least a way to clear the
+// screen and to bring the cursor home, whatever else is missing.
+func loadCaps(term string) (*termCaps, error) {
+	if term == "" { term = STD_TERM }
+
+	ti, err := terminfo.LoadOrFallback(term)
+	if err != nil { return nil, err }
+
+	c := &termCaps{
+		name:   term,
+		home:   ti.String("home"),
+		clear:  ti.String("clear"),
+		sgr0:   ti.String("sgr0"),
+		civis:  ti.String("civis"),
+		cnorm:  ti.String("cnorm"),
+		smcup:  ti.String("smcup"),
+		rmcup:  ti.String("rmcup"),
+		cup:    ti.String("cup"),
+	}
+	if c.home == "" && ti.String("cup") != "" { c.home = terminfo.Tparm(ti.String("cup"), 0, 0) }
+	if c.home == "" || c.clear == "" {
+		return nil, fmt.Errorf("%s: the terminal cannot clear the screen and move the cursor", term)
+	}
+
+	for i := range Themes {
+		c.themes[i] = themeColors(ti, Themes[i])
+	}
+	c.mate  = themeColors(ti, MateTheme)
+	c.label = themeColors(ti, LabelTheme)
+	return c, nil
+}
+
+// themeColors encodes a theme for ti: without colors only the bold and
+// reverse attributes are kept.
+func themeColors(ti *terminfo.Terminfo, t Theme) string {
+	var s string
+	if t.Bold    { s += ti.String("bold") }
+	if t.Reverse { s += ti.String("rev") }
+	if ti.Number("colors") < MIN_COLORS { return s }
+
+	if t.Fg != COLOR_NONE && ti.String("setaf") != "" { s += terminfo.Tparm(ti.String("setaf"), t.Fg) }
+	if t.Bg != COLOR_NONE && ti.String("setab") != "" { s += terminfo.Tparm(ti.String("setab"), t.Bg) }
+	return s
+}
+
+// termCaps resolves the terminal type term for the playground and
+// refuses to start on a terminal the game cannot draw on.
+func (p *Playground) termCaps(term string) error {
+	caps, err := loadCaps(term)
+	if err != nil { return &Error{ TERM_ERROR, err } }
+	p.caps = caps
+	return nil
+}
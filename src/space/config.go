@@ -0,0 +1,307 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"sound"
+)
+
+const (
+	CONFIG_FILE     = ".systemInvaders.conf"
+	CONFIG_COMMENT  = '#'
+	CONFIG_SEP      = "="
+	KEY_PREFIX      = "key."
+	SOUND_PREFIX    = "sound."
+	SOUND_COMMAND   = "aplay -q"
+	SPACE_KEY_NAME  = "space"
+)
+
+// KeyMap binds every game action to a key.
+type KeyMap struct {
+	Left, Right,
+	JumpLeft, JumpRight,
+	Fire, Quit, Restart,
+	Debug                     byte
+}
+
+// Config holds the runtime options. It is read from the config file
+// at startup and written back by the settings screen.
+type Config struct {
+	Difficulty  string
+	Theme       string
+	Sound       bool
+	Sounds      [sound.NUM_EVENTS]string
+	SoundCmd    string
+	SoundFile   string
+	FPS         int
+	Keys        KeyMap
+}
+
+var keyActions = [...]struct {
+	name  string
+	label string
+	key   func(k *KeyMap) *byte
+}{
+	{ "left",      "move left",  func(k *KeyMap) *byte { return &k.Left } },
+	{ "right",     "move right", func(k *KeyMap) *byte { return &k.Right } },
+	{ "jumpleft",  "jump left",  func(k *KeyMap) *byte { return &k.JumpLeft } },
+	{ "jumpright", "jump right", func(k *KeyMap) *byte { return &k.JumpRight } },
+	{ "fire",      "fire",       func(k *KeyMap) *byte { return &k.Fire } },
+	{ "quit",      "quit",       func(k *KeyMap) *byte { return &k.Quit } },
+	{ "restart",   "new game",   func(k *KeyMap) *byte { return &k.Restart } },
+	{ "debug",     "debug info", func(k *KeyMap) *byte { return &k.Debug } },
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Difficulty: Difficulties[DIFF_NORMAL].Name,
+		Theme:      Themes[THEME_CLASSIC].Name,
+		Sound:      true,
+		Sounds:     [sound.NUM_EVENTS]string{ sound.BACKEND_BELL, sound.BACKEND_BELL, sound.BACKEND_BELL,
+		                                      sound.BACKEND_BELL, sound.BACKEND_BELL, sound.BACKEND_BELL },
+		SoundCmd:   SOUND_COMMAND,
+		FPS:        STD_FPS,
+		Keys:       KeyMap{ Left: 'a', Right: 's', JumpLeft: 'z', JumpRight: 'x',
+		                    Fire: ' ', Quit: 'q', Restart: 'r', Debug: 'd' },
+	}
+}
+
+func ConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil { home = "." }
+	return filepath.Join(home, CONFIG_FILE)
+}
+
+// LoadConfig reads "name = value" lines over the defaults. A missing
+// file yields the defaults; an unknown name or a bad value is an error.
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) { return config, nil }
+	if err != nil { return config, err }
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == CONFIG_COMMENT { continue }
+
+		fields := strings.SplitN(text, CONFIG_SEP, 2)
+		if len(fields) != 2 { return config, fmt.Errorf("%s:%d: missing %q", path, line, CONFIG_SEP) }
+
+		name, value := strings.TrimSpace(fields[0]), strings.TrimSpace(fields[1])
+		if err = config.set(name, value); err != nil { return config, fmt.Errorf("%s:%d: %v", path, line, err) }
+	}
+
+	return config, scanner.Err()
+}
+
+func (c *Config) set(name, value string) error {
+	switch name {
+		case "difficulty":
+			if _, ok := DifficultyByName(value); !ok { return fmt.Errorf("unknown difficulty %q", value) }
+			c.Difficulty = value
+		case "theme":
+			if _, ok := ThemeByName(value); !ok { return fmt.Errorf("unknown theme %q", value) }
+			c.Theme = value
+		case "sound":
+			switch strings.ToLower(value) {
+				case "on":  c.Sound = true
+				case "off": c.Sound = false
+				default:    return fmt.Errorf("sound must be on or off, not %q", value)
+			}
+		case "fps":
+			fps, err := strconv.Atoi(value)
+			if err != nil || fps < MIN_FPS || fps > MAX_FPS {
+				return fmt.Errorf("fps must be between %d and %d", MIN_FPS, MAX_FPS)
+			}
+			c.FPS = fps
+		case SOUND_PREFIX + "command":
+			c.SoundCmd = value
+		case SOUND_PREFIX + "file":
+			c.SoundFile = value
+		default:
+			if event, ok := sound.EventByName(strings.TrimPrefix(name, SOUND_PREFIX)); ok && strings.HasPrefix(name, SOUND_PREFIX) {
+				if !sound.ValidBackend(value) {
+					return fmt.Errorf("sound backend must be one of %s, not %q", strings.Join(sound.BackendNames, ", "), value)
+				}
+				c.Sounds[event] = strings.ToLower(value)
+				return nil
+			}
+			for _, action := range keyActions {
+				if name != KEY_PREFIX + action.name { continue }
+				key, err := parseKey(value)
+				if err != nil { return err }
+				*action.key(&c.Keys) = key
+				return nil
+			}
+			return fmt.Errorf("unknown setting %q", name)
+	}
+	return nil
+}
+
+// Save writes the whole configuration, replacing the file atomically.
+func (c Config) Save(path string) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil { return err }
+
+	writer := bufio.NewWriter(file)
+	fmt.Fprintf(writer, "%c SystemInvaders settings\n", CONFIG_COMMENT)
+	fmt.Fprintf(writer, "difficulty %s %s\n", CONFIG_SEP, c.Difficulty)
+	fmt.Fprintf(writer, "theme %s %s\n", CONFIG_SEP, c.Theme)
+	fmt.Fprintf(writer, "sound %s %s\n", CONFIG_SEP, strings.ToLower(onOff(c.Sound)))
+	for e, backend := range c.Sounds {
+		fmt.Fprintf(writer, "%s%s %s %s\n", SOUND_PREFIX, sound.Event(e), CONFIG_SEP, backend)
+	}
+	fmt.Fprintf(writer, "%scommand %s %s\n", SOUND_PREFIX, CONFIG_SEP, c.SoundCmd)
+	if c.SoundFile != "" { fmt.Fprintf(writer, "%sfile %s %s\n", SOUND_PREFIX, CONFIG_SEP, c.SoundFile) }
+	fmt.Fprintf(writer, "fps %s %d\n", CONFIG_SEP, c.FPS)
+	for _, action := range keyActions {
+		fmt.Fprintf(writer, "%s%s %s %s\n", KEY_PREFIX, action.name, CONFIG_SEP, keyName(*action.key(&c.Keys)))
+	}
+
+	if err = writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil { return err }
+
+	return os.Rename(tmp, path)
+}
+
+// edit takes the settings that differ between before and after from
+// after.
+func (c *Config) edit(before, after Config) {
+	if after.Difficulty != before.Difficulty { c.Difficulty = after.Difficulty }
+	if after.Theme != before.Theme { c.Theme = after.Theme }
+	if after.Sound != before.Sound { c.Sound = after.Sound }
+	if after.FPS != before.FPS { c.FPS = after.FPS }
+	if after.SoundCmd != before.SoundCmd { c.SoundCmd = after.SoundCmd }
+	if after.SoundFile != before.SoundFile { c.SoundFile = after.SoundFile }
+	for e := range after.Sounds {
+		if after.Sounds[e] != before.Sounds[e] { c.Sounds[e] = after.Sounds[e] }
+	}
+	for _, action := range keyActions {
+		if key := *action.key(&after.Keys); key != *action.key(&before.Keys) { *action.key(&c.Keys) = key }
+	}
+}
+
+func parseKey(value string) (byte, error) {
+	if value == SPACE_KEY_NAME { return ' ', nil }
+	if len(value) != 1 || value[0] <= ' ' || value[0] > '~' {
+		return 0, fmt.Errorf("key must be a single printable character or %q, not %q", SPACE_KEY_NAME, value)
+	}
+	return value[0], nil
+}
+
+func keyName(key byte) string {
+	if key == ' ' { return SPACE_KEY_NAME }
+	return string(rune(key))
+}
+
+// ApplyConfig switches the playground to c; it can be called at any
+// time, the change shows from the next frame.
+func (p *Playground) ApplyConfig(c Config) {
+	p.SetDifficulty(c.Difficulty)
+	p.theme, _ = ThemeByName(c.Theme)
+	p.sound    = c.Sound
+	p.fps      = c.FPS
+	p.keymap   = c.Keys
+	p.dirty    = true
+
+	p.soundRoutes = c.Sounds
+	p.soundCmd    = c.SoundCmd
+	p.soundFile   = c.SoundFile
+	p.routeSounds()
+}
+
+func (p *Playground) currentConfig() Config {
+	return Config{
+		Difficulty: p.Difficulty().Name,
+		Theme:      Themes[p.theme].Name,
+		Sound:      p.sound,
+		Sounds:     p.soundRoutes,
+		SoundCmd:   p.soundCmd,
+		SoundFile:  p.soundFile,
+		FPS:        p.fps,
+		Keys:       p.keymap,
+	}
+}
+
+// Options are the command line settings, they override the config
+// file for this run.
+type Options struct {
+	ConfigPath   string
+	Seed         int64
+	Difficulty   string
+	Theme        string
+	FPS          int
+	NoBell       bool
+	NoTitle      bool
+	Debug        bool
+	Log          string
+	LogLevel     string
+	Host         string
+	Rival        string
+	Rounds       int
+	Record       string
+	Replay       *Replay
+	Save         string
+	Resume       *Save
+	Spectate     string
+}
+
+// Config is the configuration of a game for o: the config file, with
+// the flags over it.
+func (o Options) Config() (Config, error) {
+	path := o.ConfigPath
+	if path == "" { path = ConfigPath() }
+	config, err := LoadConfig(path)
+	if err == nil { err = o.override(&config) }
+	if err != nil { return config, &Error{ CONFIG_ERROR, err } }
+	return config, nil
+}
+
+func (o Options) override(c *Config) error {
+	if o.Difficulty != "" {
+		if err := c.set("difficulty", o.Difficulty); err != nil { return err }
+	}
+	if o.Theme != "" {
+		if err := c.set("theme", o.Theme); err != nil { return err }
+	}
+	if o.FPS != 0 {
+		if err := c.set("fps", strconv.Itoa(o.FPS)); err != nil { return err }
+	}
+	if o.NoBell {
+		for e := range c.Sounds {
+			if c.Sounds[e] == sound.BACKEND_BELL { c.Sounds[e] = sound.BACKEND_SILENT }
+		}
+	}
+	return nil
+}
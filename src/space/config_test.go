@@ -0,0 +1,68 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package space
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sound"
+)
+
+// Leaving the settings writes only what was changed there: the flags of
+// the run stay out of the file, and nothing is written when nothing
+// changed.
+func TestSaveSettings(t *testing.T) {
+	p := NewHeadless(35, 100, 1, "EASY")
+	p.configPath = filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(p.configPath, []byte("difficulty = EASY\n"), 0644); err != nil { t.Fatal(err) }
+
+	p.SetDifficulty("HARD")
+	before := p.currentConfig()
+	if err := p.saveSettings(before); err != nil { t.Fatal(err) }
+	if text, _ := os.ReadFile(p.configPath); string(text) != "difficulty = EASY\n" { t.Errorf("the file was written unchanged:\n%s", text) }
+
+	p.theme = (p.theme + 1) % len(Themes)
+	p.keymap.Fire, p.keymap.Left = p.keymap.Left, p.keymap.Fire
+	if err := p.saveSettings(before); err != nil { t.Fatal(err) }
+	config, err := LoadConfig(p.configPath)
+	if err != nil { t.Fatal(err) }
+	if config.Difficulty != "EASY" || config.Theme != Themes[p.theme].Name || config.Keys.Fire != 'a' || config.Keys.Left != ' ' {
+		t.Errorf("saved %+v", config)
+	}
+	if defaults := DefaultConfig(); config.FPS != defaults.FPS || config.Sounds != defaults.Sounds { t.Errorf("saved the settings of the run: %+v", config) }
+}
+
+// --no-bell silences the events rung on the bell, and only them.
+func TestNoBell(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte("sound.fire = pcm\n"), 0644); err != nil { t.Fatal(err) }
+
+	config, err := Options{ ConfigPath: path, NoBell: true }.Config()
+	if err != nil { t.Fatal(err) }
+	if !config.Sound { t.Error("the sound was switched off") }
+	for e, backend := range config.Sounds {
+		want := sound.BACKEND_SILENT
+		if sound.Event(e) == sound.FIRE { want = sound.BACKEND_PCM }
+		if backend != want { t.Errorf("%s goes to %s, want %s", sound.Event(e), backend, want) }
+	}
+}
@@ -0,0 +1,413 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package space
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// In a co-op game the host plays the round and a second player joins
+// it over TCP: the client says hello with its terminal, sends its keys
+// and draws the frames the host encodes for that terminal.
+const (
+	COOP_MAGIC         = "SYSTEMINVADERS-COOP"
+	COOP_VERSION       = 1
+	COOP_TIMEOUT       = 5 * time.Second
+	COOP_WRITE_TIMEOUT = time.Second
+	COOP_BUFFER        = 32 * 1024
+	COOP_LINE          = 256
+	MATE_GAP           = 7
+	WAIT_TITLE         = "WAITING FOR PLAYER 2"
+	WAIT_FOOTER        = "Press any key to quit"
+)
+
+// coopKeys are the keys the client sends for the actions of the second
+// player, whatever its own key map.
+var coopKeys = DefaultConfig().Keys
+
+// A mate is the second player, at the other end of conn. The frames are
+// written by a goroutine of its own, a frame it did not take yet being
+// replaced by the next one, so that a slow connection never holds up
+// the game.
+type mate struct {
+	conn                      net.Conn
+	in                        *bufio.Reader
+	caps                      *termCaps
+	frames                    chan []byte
+	cancel                    context.CancelFunc
+	col, score                int
+	input                     []byte
+}
+
+// listen opens the port the second player joins on, if addr is set.
+func (p *Playground) listen(addr string) error {
+	if addr == "" { return nil }
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil { return &Error{ NET_ERROR, err } }
+	p.listener = ln
+	p.joined   = make(chan struct{}, 1)
+	p.log.Info("listening", "addr", ln.Addr().String())
+	return nil
+}
+
+// joinAddr is the address to give to the second player.
+func (p *Playground) joinAddr() string {
+	_, port, _ := net.SplitHostPort(p.listener.Addr().String())
+	host, _, _ := net.SplitHostPort(p.opts.Host)
+	if host == "" { host, _ = os.Hostname() }
+	return net.JoinHostPort(host, port)
+}
+
+// waitMate tells where to join until the second player does, or the
+// host gives up with any key.
+func (p *Playground) waitMate() bool {
+	lines := []string{ "Join from another terminal with", "", "systemInvaders join " + p.joinAddr() }
+	for {
+		p.drawPage(WAIT_TITLE, WAIT_FOOTER, lines)
+		select {
+			case <- p.joined:
+				return true
+			case <- p.resized:
+			case <- p.keys:
+				return false
+			case <- p.session.ctx.Done():
+				return false
+		}
+	}
+}
+
+// acceptMates lets the second player join, again after they left,
+// until ctx is cancelled.
+func (p *Playground) acceptMates(ctx context.Context) {
+	defer context.AfterFunc(ctx, func() { p.listener.Close() })()
+
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil { p.end(&Error{ NET_ERROR, err }) }
+			return
+		}
+		p.greet(ctx, conn)
+	}
+}
+
+// greet reads the hello of a player, "SYSTEMINVADERS-COOP 1 TERM ROWS
+// COLS", and answers "OK ROWS COLS" with the size of the playfield, or
+// "ERROR" and why before hanging up: the game is for two, and the
+// terminal of the client must be big enough.
+func (p *Playground) greet(ctx context.Context, conn net.Conn) {
+	var (
+		in                  = bufio.NewReader(conn)
+		magic, term         string
+		version, rows, cols int
+		caps                *termCaps
+	)
+	conn.SetDeadline(time.Now().Add(COOP_TIMEOUT))
+	line, err := readLine(in, COOP_LINE)
+	if err == nil { _, err = fmt.Sscanf(line, "%s %d %s %d %d", &magic, &version, &term, &rows, &cols) }
+	if err == nil && (magic != COOP_MAGIC || version != COOP_VERSION) { err = fmt.Errorf("not a %s %d client", COOP_MAGIC, COOP_VERSION) }
+	if err == nil { caps, err = loadCaps(term) }
+	if err == nil && caps.cup == "" { err = fmt.Errorf("%s: the terminal cannot move the cursor", term) }
+
+	p.Lock()
+	defer p.Unlock()
+
+	switch {
+		case err != nil:
+		case p.mate != nil:
+			err = errors.New("the game is full")
+		case rows < p.termRow || cols < p.termCol:
+			err = fmt.Errorf("the game needs a %dx%d terminal, this one is %dx%d", p.termCol, p.termRow, cols, rows)
+	}
+	if err != nil {
+		p.event(slog.LevelWarn, "player refused", "addr", conn.RemoteAddr().String(), "err", err)
+		fmt.Fprintf(conn, "ERROR %v\n", err)
+		conn.Close()
+		return
+	}
+
+	mctx, cancel := context.WithCancel(ctx)
+	m := &mate{ conn: conn, in: in, caps: caps, frames: make(chan []byte, 1), cancel: cancel }
+	fmt.Fprintf(conn, "OK %d %d\n", p.termRow, p.termCol)
+	conn.SetDeadline(time.Time{})
+
+	p.mate  = m
+	p.dirty = true
+	if p.playing { p.placeMate() }
+	p.event(slog.LevelInfo, "player joined", "addr", conn.RemoteAddr().String(), "term", term)
+
+	p.session.Go(func(context.Context) { p.readMate(mctx, m) })
+	p.session.Go(func(context.Context) { m.writeFrames(mctx) })
+	select {
+		case p.joined <- struct{}{}:
+		default:
+	}
+}
+
+// readMate queues the keys of the second player for the round, one
+// being taken per tick like the keys of the host, until they hang up.
+func (p *Playground) readMate(ctx context.Context, m *mate) {
+	defer context.AfterFunc(ctx, func() { m.conn.Close() })()
+
+	k := make([]byte, 1)
+	for {
+		n, err := m.in.Read(k)
+		if err != nil { break }
+		p.Lock()
+		if n == 1 && p.playing && len(m.input) < KEYS_BUFFER { m.input = append(m.input, k[0]) }
+		p.Unlock()
+	}
+
+	p.Lock()
+	p.dropMate(m)
+	p.Unlock()
+}
+
+// dropMate takes the ship of m off the playfield. The caller must hold
+// the lock.
+func (p *Playground) dropMate(m *mate) {
+	if p.mate != m { return }
+
+	m.cancel()
+	m.conn.Close()
+	if p.playing && m.col + SPRITE_COLS <= p.termCol {
+		for i := range p.sprite {
+			copy(p.screen[p.termRow - (SPRITE_BEGIN - i)][m.col:], blank(SPRITE_COLS))
+		}
+	}
+	p.mate  = nil
+	p.dirty = true
+	p.drawHud()
+	p.event(slog.LevelInfo, "player left", "addr", m.conn.RemoteAddr().String(), "score", m.score)
+}
+
+func (m *mate) writeFrames(ctx context.Context) {
+	for {
+		select {
+			case <- ctx.Done():
+				return
+			case f := <- m.frames:
+				m.conn.SetWriteDeadline(time.Now().Add(COOP_WRITE_TIMEOUT))
+				if _, err := m.conn.Write(f); err != nil {
+					m.conn.Close()
+					return
+				}
+		}
+	}
+}
+
+// send hands a frame to the writer, in place of the one it did not
+// take yet. Only the renderer sends.
+func (m *mate) send(frame []byte) {
+	select {
+		case <- m.frames:
+		default:
+	}
+	m.frames <- frame
+}
+
+// mateFrame encodes the screen for the terminal of the second player.
+// The caller must hold the lock.
+func (p *Playground) mateFrame() []byte {
+	var buf bytes.Buffer
+	p.encode(&buf, p.mate.caps, true)
+	return buf.Bytes()
+}
+
+// placeMate puts the ship of the second player next to the one of the
+// host, on the side with more room. The caller must hold the lock.
+func (p *Playground) placeMate() {
+	m := p.mate
+	m.score, m.input = 0, nil
+
+	m.col = p.curCol - SPRITE_COLS - MATE_GAP
+	if p.curCol < p.termCol - p.curCol - SPRITE_COLS { m.col = p.curCol + SPRITE_COLS + MATE_GAP }
+	if m.col < EN_MISS_ADJ { m.col = EN_MISS_ADJ }
+	if m.col > p.termCol - SPRITE_COLS_GAP { m.col = p.termCol - SPRITE_COLS_GAP }
+
+	for i := range p.sprite {
+		copy(p.screen[p.termRow - (SPRITE_BEGIN - i)][m.col:], p.sprite[i])
+	}
+	p.drawHud()
+}
+
+// shipsCollide tells whether the ship at *col, moved to to, would run
+// into the other ship of a co-op game.
+func (p *Playground) shipsCollide(col *int, to int) bool {
+	if p.mate == nil { return false }
+
+	other := p.mate.col
+	if col == &p.mate.col { other = p.curCol }
+	return to > other - SPRITE_COLS && to < other + SPRITE_COLS
+}
+
+// applyMateKey plays a key of the second player, as coopKeys map it.
+// The caller must hold the lock.
+func (p *Playground) applyMateKey() {
+	m := p.mate
+	if m == nil || len(m.input) == 0 { return }
+	k := m.input[0]
+	m.input = m.input[1:]
+	if p.stop { return }
+
+	switch k {
+		case coopKeys.Left:
+			p.moveShip(&m.col, DIR_LEFT)
+		case coopKeys.Right:
+			p.moveShip(&m.col, DIR_RIGHT)
+		case coopKeys.JumpLeft:
+			for i := 0; i < STD_JUMP_LEN; i++ { p.moveShip(&m.col, DIR_LEFT) }
+		case coopKeys.JumpRight:
+			for i := 0; i < STD_JUMP_LEN; i++ { p.moveShip(&m.col, DIR_RIGHT) }
+		case coopKeys.Fire:
+			p.fire(m.col, true)
+	}
+}
+
+// credit scores a destroyed enemy for the player who shot it; in a
+// versus match, it sends invaders to the rival. The caller must hold
+// the lock.
+func (p *Playground) credit(e *enemy, points int) {
+	if p.rival != nil { p.rival.attack(e.boss) }
+	if !e.mateShot {
+		p.changeScore(points)
+		return
+	}
+	if p.mate == nil { return }
+
+	p.mate.score += points
+	p.event(slog.LevelInfo, "score", "player", 2, "points", points, "score", p.mate.score)
+	p.drawHud()
+}
+
+func (p *Playground) mateScore() string {
+	if p.mate == nil { return "" }
+	return fmt.Sprintf("P2: %-*d", MAX_SCORE_LEN, p.mate.score)
+}
+
+// Join plays as the second player of the co-op game hosted at addr:
+// the keys go to the host, the frames it sends back are drawn as they
+// come. It returns when the player quits or the host hangs up.
+func (p *Playground) Join(addr string) error {
+	defer p.session.crash()
+
+	conn, err := net.DialTimeout("tcp", addr, COOP_TIMEOUT)
+	if err != nil { return &Error{ NET_ERROR, err } }
+	in, err := p.hello(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	p.session.Go(p.Events)
+	p.session.Go(p.JobControl)
+	p.session.Go(p.ReadKeys)
+	p.session.Go(func(ctx context.Context) { p.drawFrames(ctx, conn, in) })
+	defer p.session.Stop()
+
+	for {
+		select {
+			case k, ok := <- p.keys:
+				if !ok || k == p.keymap.Quit { return p.Err() }
+				if key, ok := p.coopKey(k); ok { conn.Write([]byte{ key }) }
+			case <- p.session.ctx.Done():
+				return p.Err()
+		}
+	}
+}
+
+// hello introduces the client to the host, see greet.
+func (p *Playground) hello(conn net.Conn) (*bufio.Reader, error) {
+	conn.SetDeadline(time.Now().Add(COOP_TIMEOUT))
+	defer conn.SetDeadline(time.Time{})
+
+	fmt.Fprintf(conn, "%s %d %s %d %d\n", COOP_MAGIC, COOP_VERSION, p.caps.name, p.termRow, p.termCol)
+	in := bufio.NewReader(conn)
+	answer, err := readLine(in, COOP_LINE)
+	if err != nil { return nil, &Error{ NET_ERROR, err } }
+
+	var rows, cols int
+	if _, err := fmt.Sscanf(answer, "OK %d %d", &rows, &cols); err != nil {
+		why := strings.Map(printable, strings.TrimSpace(strings.TrimPrefix(answer, "ERROR")))
+		return nil, errorf(NET_ERROR, "the host refused to play: %s", why)
+	}
+	p.log.Info("joined", "addr", conn.RemoteAddr().String(), "rows", rows, "cols", cols)
+	return in, nil
+}
+
+// drawFrames copies the frames of the host to the terminal. It takes
+// the lock not to draw while the game is suspended.
+func (p *Playground) drawFrames(ctx context.Context, conn net.Conn, in io.Reader) {
+	defer context.AfterFunc(ctx, func() { conn.Close() })()
+
+	buf := make([]byte, COOP_BUFFER)
+	for {
+		n, err := in.Read(buf)
+		p.Lock()
+		if !p.halted.Load() { p.out.Write(buf[:n]) }
+		p.Unlock()
+		if err != nil {
+			if ctx.Err() == nil { p.end(errorf(NET_ERROR, "the host ended the game")) }
+			return
+		}
+	}
+}
+
+// readLine reads a line of at most max bytes, newline included, so that
+// the other end cannot make it grow without end.
+func readLine(in *bufio.Reader, max int) (string, error) {
+	var line []byte
+	for len(line) < max {
+		c, err := in.ReadByte()
+		if err != nil { return "", err }
+		line = append(line, c)
+		if c == '\n' { return string(line), nil }
+	}
+	return "", fmt.Errorf("a line of more than %d bytes", max)
+}
+
+// printable drops the control characters of a text from the other end
+// before it reaches the terminal.
+func printable(r rune) rune {
+	if unicode.IsPrint(r) { return r }
+	return -1
+}
+
+// coopKey translates a key of the player to the one sent for the same
+// action.
+func (p *Playground) coopKey(k byte) (byte, bool) {
+	for _, action := range keyActions {
+		if *action.key(&p.keymap) == k { return *action.key(&coopKeys), true }
+	}
+	return 0, false
+}
@@ -0,0 +1,159 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package space
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// screenBuffer is the terminal of a client, written by its goroutines.
+type screenBuffer struct {
+	sync.Mutex
+	bytes.Buffer
+}
+
+func (b *screenBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.Write(p)
+}
+
+func (b *screenBuffer) Contains(s string) bool {
+	b.Lock()
+	defer b.Unlock()
+	return strings.Contains(b.Buffer.String(), s)
+}
+
+// waitFor polls cond with the lock of p held.
+func waitFor(t *testing.T, p *Playground, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(PLAY_TIMEOUT); ; time.Sleep(TICK) {
+		p.Lock()
+		ok := cond()
+		p.Unlock()
+		if ok { return }
+		if time.Now().After(deadline) { t.Fatalf("waiting for %s", what) }
+	}
+}
+
+// hail says hello to the host like a client would, and returns its
+// answer.
+func hail(t *testing.T, addr, hello string) string {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil { t.Fatal(err) }
+	defer conn.Close()
+	fmt.Fprint(conn, hello)
+	answer, _ := bufio.NewReader(conn).ReadString('\n')
+	return answer
+}
+
+func joinHost(addr string, keys io.Reader, screen io.Writer) (*Playground, <-chan error) {
+	client := NewHeadless(40, 120, 2, "NORMAL")
+	client.keymap.Right = 'l'
+	client.in, client.out = keys, screen
+	done := make(chan error, 1)
+	go func() { done <- client.Join(addr) }()
+	return client, done
+}
+
+// Two players on loopback: the second one moves and fires its own ship
+// with its own keys, sees the frames, and can leave the game to the
+// host, after which someone else can join.
+func TestCoopLoopback(t *testing.T) {
+	host := NewHeadless(35, 100, 1, "EASY")
+	host.opts.NoTitle = true
+	if err := host.listen("127.0.0.1:0"); err != nil { t.Fatal(err) }
+	addr := host.listener.Addr().String()
+	hostIn, hostKeys := io.Pipe()
+	host.in = hostIn
+	code := make(chan int, 1)
+	go func() { code <- ExitCode(host.Play()) }()
+	defer hostKeys.Close()
+
+	if answer := hail(t, addr, "SYSTEMINVADERS-COOP 1 xterm 20 60\n"); !strings.HasPrefix(answer, "ERROR the game needs a 100x35 terminal") {
+		t.Errorf("a small terminal was answered %q", answer)
+	}
+	if answer := hail(t, addr, strings.Repeat("X", 2*COOP_LINE)); !strings.HasPrefix(answer, "ERROR a line of more than") {
+		t.Errorf("an endless greeting was answered %q", answer)
+	}
+
+	clientIn, clientKeys := io.Pipe()
+	defer clientKeys.Close()
+	var screen screenBuffer
+	_, done := joinHost(addr, clientIn, &screen)
+
+	waitRounds(t, host, 1)
+	var col int
+	host.Lock()
+	if host.mate == nil { t.Fatal("no second player in the round") }
+	col = host.mate.col
+	if col + SPRITE_COLS > host.curCol { t.Errorf("the ships overlap: %d and %d", col, host.curCol) }
+	host.Unlock()
+
+	clientKeys.Write([]byte("l"))
+	waitFor(t, host, "the second ship to move", func() bool { return host.mate.col == col + 1 })
+	clientKeys.Write([]byte(" "))
+	waitFor(t, host, "the missile of the second ship", func() bool {
+		for _, m := range host.missiles {
+			if m.mate && m.col == col + 1 + COL_START_LIMIT { return true }
+		}
+		return false
+	})
+
+	waitFor(t, host, "the frames of the client", func() bool { return screen.Contains("P2: 0") && screen.Contains(host.mate.caps.mate) })
+
+	_, refused := joinHost(addr, strings.NewReader(""), io.Discard)
+	if err := <-refused; ExitCode(err) != NET_ERROR || !strings.Contains(err.Error(), "the game is full") {
+		t.Errorf("a third player joined: %v", err)
+	}
+
+	clientKeys.Write([]byte("q"))
+	if err := <-done; err != nil { t.Errorf("the client quit with %v", err) }
+	waitFor(t, host, "the second player to leave", func() bool { return host.mate == nil })
+
+	clientIn, clientKeys = io.Pipe()
+	defer clientKeys.Close()
+	_, done = joinHost(addr, clientIn, io.Discard)
+	waitFor(t, host, "a new second player", func() bool { return host.mate != nil })
+
+	hostKeys.Write([]byte("q"))
+	if c := waitExit(t, code); c != NO_ERROR { t.Errorf("the host exited with %d", c) }
+	if err := <-done; ExitCode(err) != NET_ERROR { t.Errorf("the client did not see the host leave: %v", err) }
+}
+
+// Points go to the player whose missile hit.
+func TestCoopCredit(t *testing.T) {
+	p := NewHeadless(35, 100, 1, "NORMAL")
+	p.mate = &mate{}
+	p.credit(&enemy{ mateShot: true }, STD_ENEM_POINT)
+	p.credit(&enemy{}, STD_BOSS_POINTS)
+	if p.mate.score != STD_ENEM_POINT || p.score != STD_BOSS_POINTS { t.Errorf("scores %d and %d", p.score, p.mate.score) }
+	if !strings.Contains(p.String(), fmt.Sprintf("P2: %d ", STD_ENEM_POINT)) { t.Errorf("the HUD has no score for the second player:\n%s", p) }
+}
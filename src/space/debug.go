@@ -0,0 +1,128 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+const (
+	DEBUG_MARGIN = 1
+	DEBUG_WINDOW = time.Second
+)
+
+// debugStats are measured by the renderer and the round as they go,
+// for the debug overlay. They are guarded by the lock.
+type debugStats struct {
+	frames, fps               int
+	window                    time.Time
+	frameTime                 time.Duration
+	frameBytes                int
+	lockWait, lockWaitMax,
+	windowWaitMax             time.Duration
+}
+
+// lockWaited records how long a goroutine waited for the lock.
+func (s *debugStats) lockWaited(d time.Duration) {
+	s.lockWait = d
+	if d > s.windowWaitMax { s.windowWaitMax = d }
+}
+
+// frameDone records a frame drawn since start; the frame rate and the
+// longest lock wait are counted over DEBUG_WINDOW.
+func (s *debugStats) frameDone(start time.Time, bytes int) {
+	now := time.Now()
+	s.frameTime, s.frameBytes = now.Sub(start), bytes
+	s.frames++
+	if now.Sub(s.window) < DEBUG_WINDOW { return }
+
+	s.fps, s.frames, s.window = s.frames, 0, now
+	s.lockWaitMax, s.windowWaitMax = s.windowWaitMax, 0
+}
+
+// lock takes the lock, keeping track of the wait.
+func (p *Playground) lock() {
+	start := time.Now()
+	p.Lock()
+	p.stats.lockWaited(time.Since(start))
+}
+
+func (p *Playground) toggleDebug() {
+	p.debug = !p.debug
+	p.dirty = true
+}
+
+// debugLines is the text of the overlay. The caller must hold the lock.
+func (p *Playground) debugLines() []string {
+	s, enemies := &p.stats, 0
+	if p.enemy != nil { enemies = 1 }
+
+	return []string{
+		fmt.Sprintf(" FPS %-4d FRAME %v ", s.fps, s.frameTime.Round(time.Microsecond)),
+		fmt.Sprintf(" BYTES/FRAME %d ", s.frameBytes),
+		fmt.Sprintf(" MISSILES %d ENEMY %d ", len(p.missiles), len(p.enemyMissiles)),
+		fmt.Sprintf(" ENEMIES %d WAVE %d/%d ", enemies, p.wave.deployed, p.wave.enemies),
+		fmt.Sprintf(" GOROUTINES %d ", runtime.NumGoroutine()),
+		fmt.Sprintf(" LOCK WAIT %v MAX %v ", s.lockWait.Round(time.Microsecond), s.lockWaitMax.Round(time.Microsecond)),
+		fmt.Sprintf(" SEED %d TICK %d ", p.seed, p.ticks),
+	}
+}
+
+// overlay returns the rows of the screen with the replay viewer bar
+// on the top row and the debug overlay in the top right corner, below
+// the bar. The screen itself is left alone: the round reads it to find
+// what was hit. The caller must hold the lock.
+func (p *Playground) overlay() [][]rune {
+	if !p.debug && p.viewer == nil { return p.screen }
+
+	var (
+		top   int
+		width int
+		rows  = make([][]rune, len(p.screen))
+	)
+	copy(rows, p.screen)
+	if p.viewer != nil {
+		rows[0] = overlayText(rows[0], 0, p.viewerBar())
+		top = 1
+	}
+	if !p.debug { return rows }
+
+	lines := p.debugLines()
+	for _, line := range lines {
+		if n := len([]rune(line)); n > width { width = n }
+	}
+	col := p.termCol - width - DEBUG_MARGIN
+	if col < 0 { col = 0 }
+	for i, line := range lines {
+		if top + i >= len(rows) - HUD_ROWS { break }
+		rows[top + i] = overlayText(rows[top + i], col, fmt.Sprintf("%-*s", width, line))
+	}
+	return rows
+}
+
+// overlayText returns a copy of row with text over it from col, cut at
+// the end of the row.
+func overlayText(row []rune, col int, text string) []rune {
+	row = append([]rune(nil), row...)
+	copy(row[col:], []rune(text))
+	return row
+}
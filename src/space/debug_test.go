@@ -0,0 +1,64 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package space
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The overlay is drawn over the frame but stays out of the screen the
+// round plays on, and the debug key does not reach the round.
+func TestDebugOverlay(t *testing.T) {
+	p := NewHeadless(35, 100, 1, "NORMAL")
+	for p.Ticks() < 5 { p.Tick() }
+	before := p.String()
+
+	if finish := p.roundKey(p.keymap.Debug); finish != FINISH_NONE { t.Fatalf("debug key finished the round: %d", finish) }
+	if !p.debug { t.Fatal("the debug key did not show the overlay") }
+	if len(p.input) != 0 { t.Errorf("the debug key was pressed in the round: %q", p.input) }
+
+	var frame bytes.Buffer
+	p.frame(&frame)
+	for _, want := range []string{ "FPS ", "GOROUTINES ", "LOCK WAIT ", "SEED 1 TICK 5 " } {
+		if !strings.Contains(frame.String(), want) { t.Errorf("the frame has no %q", want) }
+	}
+	if p.String() != before { t.Error("the overlay was drawn on the screen") }
+
+	p.roundKey(p.keymap.Debug)
+	frame.Reset()
+	p.frame(&frame)
+	if strings.Contains(frame.String(), "GOROUTINES") { t.Error("the overlay is still drawn after the second toggle") }
+}
+
+// Frames and lock waits are summed up once per window.
+func TestDebugStats(t *testing.T) {
+	var s debugStats
+	s.lockWaited(3 * time.Millisecond)
+	s.lockWaited(time.Millisecond)
+	for i := 0; i < 10; i++ { s.frameDone(time.Now(), 100) }
+
+	if s.fps != 1 || s.frames != 9 { t.Errorf("fps %d frames %d, want the first window closed at 1", s.fps, s.frames) }
+	if s.lockWait != time.Millisecond || s.lockWaitMax != 3 * time.Millisecond { t.Errorf("lock wait %v max %v", s.lockWait, s.lockWaitMax) }
+	if s.frameBytes != 100 { t.Errorf("frame bytes %d", s.frameBytes) }
+}
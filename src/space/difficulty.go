@@ -0,0 +1,63 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	DIFF_EASY   = iota
+	DIFF_NORMAL
+	DIFF_HARD
+)
+
+// Difficulty tunes how many invaders make a wave and how fast
+// invaders and their missiles fall.
+type Difficulty struct {
+	Name         string
+	EnemyGroup   int
+	EnemyStep    time.Duration
+	MissileStep  time.Duration
+}
+
+var Difficulties = [...]Difficulty{
+	DIFF_EASY:   { "EASY",   STD_ENEMY_GROUP - 2, TIMER_LEVEL_D, TIMER_LEVEL_C },
+	DIFF_NORMAL: { "NORMAL", STD_ENEMY_GROUP,     TIMER_LEVEL_C, TIMER_LEVEL_B },
+	DIFF_HARD:   { "HARD",   STD_ENEMY_GROUP + 4, TIMER_LEVEL_B, TIMER_LEVEL_A },
+}
+
+func DifficultyByName(name string) (int, bool) {
+	for i := range Difficulties {
+		if strings.EqualFold(Difficulties[i].Name, name) { return i, true }
+	}
+	return DIFF_NORMAL, false
+}
+
+func (p *Playground) Difficulty() Difficulty {
+	return Difficulties[p.difficulty]
+}
+
+func (p *Playground) SetDifficulty(name string) bool {
+	level, ok := DifficultyByName(name)
+	if ok { p.difficulty = level }
+	return ok
+}
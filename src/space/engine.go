@@ -0,0 +1,481 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+import (
+	"log/slog"
+	"time"
+
+	"sound"
+)
+
+// The whole round advances one tick at a time, every timer of the game
+// being a whole number of ticks: with the same seed and the same keys
+// at the same ticks, a round always plays out the same way.
+const (
+	TICK            = TIMER_LEVEL_AM
+	HUD_CLOCK_TICKS = int(HUD_CLOCK / TICK)
+)
+
+const (
+	PHASE_FALL = iota
+	PHASE_SHOT
+	PHASE_BLAST
+)
+
+// How a round ends: it goes on, starts again, ends the game after a
+// replay, or is left for the title screen or for good. A round of a
+// versus match is lost or won.
+const (
+	FINISH_NONE = iota
+	FINISH_RESTART
+	FINISH_EXIT
+	FINISH_TITLE
+	FINISH_QUIT
+	FINISH_LOST
+	FINISH_WON
+)
+
+// What destroyed the ship: an enemy that reached the bottom, one that
+// came down on the ship, or the missiles that wore the shield out. A
+// round that ends otherwise was quit.
+const (
+	CAUSE_LANDED = "landed"
+	CAUSE_RAMMED = "rammed"
+	CAUSE_SHOT   = "shot"
+	CAUSE_QUIT   = "quit"
+)
+
+const (
+	ENEMY_MISSILE   = '\U00000044'
+	MISSILE_HEAD    = '\U0000005E'
+	MISSILE_BODY    = '\U00002569'
+	MISSILE_TRAIL_A = '\U0000002E'
+	MISSILE_TRAIL_B = '\U0000002A'
+)
+
+var enemyMissileFade = [EN_MISS_SEQ_LEN]rune{ ENEMY_MISSILE, '\U0000002A', '\U0000002E', SPACE_CHARAC }
+
+func ticks(d time.Duration) int64 { return int64(d / TICK) }
+
+// An enemy is the invader or the boss coming down; there is only one
+// at a time. A shot enemy waits for the missile that hit it to report
+// the explosion, then blows up; one that reaches the ship blows up too,
+// taking the ship with it.
+type enemy struct {
+	boss              bool
+	x, y              int
+	shoot1, shoot2    int
+	damage            int
+	phase, frame      int
+	shot, mateShot    bool
+	next              int64
+}
+
+// A wave is a group of invaders followed by a boss.
+type wave struct {
+	enemies, deployed int
+	destroyed         int
+	boss              bool
+	x                 int
+}
+
+// A missile of the second player of a co-op game scores for them.
+type missile struct {
+	col, row          int
+	next              int64
+	mate              bool
+}
+
+type enemyMissile struct {
+	col, row          int
+	frame             int
+	next              int64
+}
+
+// Tick advances the round by one tick and tells whether it is over and
+// how it should go on. The caller must hold the lock.
+func (p *Playground) Tick() int {
+	p.ticks++
+
+	p.applyKey()
+	p.applyMateKey()
+	if p.demo && p.ticks % ticks(DEMO_STEP) == 0 { p.autopilot() }
+
+	for p.enemy != nil && p.ticks >= p.enemy.next {
+		p.stepEnemy(p.enemy)
+	}
+	for i := 0; i < len(p.missiles); i++ {
+		if p.ticks >= p.missiles[i].next && p.stepMissile(&p.missiles[i]) {
+			p.missiles = append(p.missiles[:i], p.missiles[i + 1:]...)
+			i--
+		}
+	}
+	for i := 0; i < len(p.enemyMissiles); i++ {
+		if p.ticks >= p.enemyMissiles[i].next && p.stepEnemyMissile(&p.enemyMissiles[i]) {
+			p.enemyMissiles = append(p.enemyMissiles[:i], p.enemyMissiles[i + 1:]...)
+			i--
+		}
+	}
+
+	p.stepEnding()
+	if !p.stop && p.ticks % int64(HUD_CLOCK_TICKS) == 0 { p.drawHud() }
+
+	p.dirty = true
+	if p.finishAt > 0 && p.ticks >= p.finishAt { return p.finish }
+	return FINISH_NONE
+}
+
+// Press queues a key for the round, one key being taken per tick.
+func (p *Playground) Press(k byte) {
+	p.input = append(p.input, k)
+}
+
+func (p *Playground) applyKey() {
+	var k byte
+	switch {
+		case p.replay != nil:
+			if p.replayPos >= len(p.replay.Keys) || p.replay.Keys[p.replayPos].Tick > p.ticks { return }
+			k, _ = mapKey(p.replay.Keys[p.replayPos].Key, DefaultConfig().Keys, p.keymap)
+			p.replayPos++
+		case len(p.input) > 0:
+			k = p.input[0]
+			p.input = p.input[1:]
+		default:
+			return
+	}
+	p.recordKey(k)
+
+	keys := p.keymap
+	switch {
+		case p.awaitRestart:
+			if k == keys.Restart {
+				p.event(slog.LevelInfo, "restart")
+				p.finish, p.finishAt = FINISH_RESTART, p.ticks
+			}
+		case p.stop:
+		case k == keys.Left:
+			p.MoveSprite(DIR_LEFT)
+		case k == keys.Right:
+			p.MoveSprite(DIR_RIGHT)
+		case k == keys.JumpLeft:
+			for i := 0; i < STD_JUMP_LEN; i++ { p.MoveSprite(DIR_LEFT) }
+		case k == keys.JumpRight:
+			for i := 0; i < STD_JUMP_LEN; i++ { p.MoveSprite(DIR_RIGHT) }
+		case k == keys.Fire:
+			p.deployMissile()
+		case k == keys.Restart && p.rival == nil:
+			p.restart(false)
+	}
+}
+
+// nextEnemy sends the next invader of the wave, or its boss, or starts
+// a new wave one level up.
+func (p *Playground) nextEnemy() {
+	p.enemy = nil
+	if p.stop { return }
+
+	w := &p.wave
+	switch {
+		case w.deployed < w.enemies:
+			w.deployed++
+			shoot1 := p.rng.Intn(p.termRow - RND_ENEM_ADJ)
+			p.enemy = &enemy{ x: w.x, y: 1, shoot1: shoot1, shoot2: shoot1 + RND_ENEM_ADJ_SC, next: p.ticks }
+			p.event(slog.LevelDebug, "spawn", "enemy", "invader", "x", w.x, "wave", w.deployed)
+		case !w.boss:
+			w.boss = true
+			x := RND_CORR + p.rng.Intn(p.termCol - RND_COL_ADJ)
+			shoot1 := p.rng.Intn(p.termRow - RND_ROW_ADJ)
+			p.enemy = &enemy{ boss: true, x: x, y: 1, shoot1: shoot1, shoot2: shoot1 + RND_ENEM_ADJ_SC, next: p.ticks }
+			p.event(slog.LevelDebug, "spawn", "enemy", "boss", "x", x)
+		default:
+			p.level++
+			p.event(slog.LevelInfo, "level", "level", p.level)
+			p.drawHud()
+			p.startWave()
+	}
+}
+
+func (p *Playground) startWave() {
+	p.wave = wave{ enemies: p.Difficulty().EnemyGroup, x: p.centTrmCol }
+	p.nextEnemy()
+}
+
+func (p *Playground) stepEnemy(e *enemy) {
+	switch e.phase {
+		case PHASE_FALL:
+			if e.boss { p.fallBoss(e) } else { p.fallInvader(e) }
+		case PHASE_SHOT:
+			if p.explosions == 0 {
+				e.next = p.ticks + 1
+				return
+			}
+			p.explosions--
+			e.mateShot = p.mateShot
+			p.enemyShot(e)
+		case PHASE_BLAST:
+			p.blastEnemy(e)
+	}
+}
+
+func (p *Playground) fallInvader(e *enemy) {
+	row := p.screen[e.y + 2][e.x:]
+	if row[0] == row[1] && row[2] == row[3] && row[3] == row[4] {
+		copy(p.screen[e.y - 1][e.x:], blank(INVASOR_COLS))
+		for i := range invasorSprite {
+			copy(p.screen[e.y + i][e.x:], invasorSprite[i][:])
+		}
+
+		e.y++
+		if e.y == e.shoot1 || e.y == e.shoot2 { p.deployEnemyMissile(e.x, e.y) }
+		if e.y != p.termRow - SPRITE_END {
+			e.next = p.ticks + ticks(p.Difficulty().EnemyStep)
+			return
+		}
+	}
+
+	switch {
+		case e.y < p.termRow - SPRITE_BEGIN - INFO_OFFST:
+			e.phase, e.next = PHASE_SHOT, p.ticks
+		case e.y == p.termRow - SPRITE_END:
+			copy(p.screen[e.y + 1][e.x:], blank(INVASOR_COLS))
+			p.enemy = nil
+			p.critical(CAUSE_LANDED)
+		default:
+			p.play(sound.PLAYER_HIT)
+			copy(p.screen[e.y - 1][e.x:], blank(INVASOR_COLS))
+			e.phase, e.next = PHASE_BLAST, p.ticks
+	}
+}
+
+// fallBoss moves the boss down; it takes STD_BOSS_DAMAGE hits before
+// it stops.
+func (p *Playground) fallBoss(e *enemy) {
+	row := p.screen[e.y + BOSS_ROWS][e.x:]
+	if row[0] != row[1] || row[2] != row[3] || row[3] != row[4] || row[5] != row[6] {
+		e.damage++
+		p.event(slog.LevelDebug, "hit", "target", "boss", "damage", e.damage)
+		if e.damage == STD_BOSS_DAMAGE || e.y >= p.termRow - SPRITE_COLS_GAP {
+			p.bossStopped(e)
+			return
+		}
+	}
+
+	copy(p.screen[e.y - 1][e.x:], blank(BOSS_COLS))
+	for i := range bossSprite {
+		copy(p.screen[e.y + i][e.x:], bossSprite[i][:])
+	}
+
+	e.y++
+	if e.y == e.shoot1 || e.y == e.shoot2 {
+		for col := e.x + 1; col <= e.x + 3; col++ { p.deployEnemyMissile(col, e.y + 4) }
+	}
+	if e.y == p.termRow - ROW_LOW_LIMIT {
+		p.bossStopped(e)
+		return
+	}
+	e.next = p.ticks + ticks(p.Difficulty().EnemyStep)
+}
+
+func (p *Playground) bossStopped(e *enemy) {
+	switch {
+		case e.y < p.termRow - SPRITE_BEGIN - BOSS_ROWS:
+			e.phase, e.next = PHASE_SHOT, p.ticks
+		case e.y == p.termRow - ROW_LOW_LIMIT:
+			p.clearEnemy(e)
+			p.enemy = nil
+			p.critical(CAUSE_LANDED)
+		default:
+			p.play(sound.PLAYER_HIT)
+			e.phase, e.next = PHASE_BLAST, p.ticks
+	}
+}
+
+func (p *Playground) enemyShot(e *enemy) {
+	p.event(slog.LevelDebug, "hit", "target", "enemy", "boss", e.boss, "x", e.x, "y", e.y)
+	e.shot = true
+	if e.boss {
+		p.play(sound.BOSS_HIT)
+	} else {
+		p.wave.destroyed++
+		if p.shield < STD_SHIELD_LEV && p.wave.destroyed == STD_DEST_REWARD {
+			p.wave.destroyed = 0
+			p.changeShield(1)
+			p.play(sound.POWER_UP)
+		}
+		p.play(sound.ENEMY_HIT)
+		copy(p.screen[e.y - 1][e.x:], blank(INVASOR_COLS))
+	}
+	e.phase = PHASE_BLAST
+	p.blastEnemy(e)
+}
+
+// blastEnemy draws the explosion a frame at a time, then clears it and
+// scores the enemy, or ends the round if it hit the ship.
+func (p *Playground) blastEnemy(e *enemy) {
+	if e.frame < DESTR_SEQUENCE {
+		if e.boss {
+			for i := range bossDestr[e.frame] { copy(p.screen[e.y + i][e.x:], bossDestr[e.frame][i][:]) }
+		} else {
+			for i := range invasorDestr[e.frame] { copy(p.screen[e.y + i][e.x:], invasorDestr[e.frame][i][:]) }
+		}
+		e.frame++
+		e.next = p.ticks + ticks(TIMER_LEVEL_A)
+		return
+	}
+
+	p.clearEnemy(e)
+	if !e.shot {
+		p.enemy = nil
+		p.critical(CAUSE_RAMMED)
+		return
+	}
+
+	if e.boss {
+		p.credit(e, STD_BOSS_POINTS)
+		if p.shield < STD_SHIELD_LEV { p.play(sound.POWER_UP) }
+		p.changeShield(STD_SHIELD_LEV)
+	} else {
+		p.credit(e, STD_ENEM_POINT)
+		p.wave.x = RND_CORR + p.rng.Intn(p.termCol - RND_COL_ADJ)
+	}
+	p.nextEnemy()
+}
+
+func (p *Playground) clearEnemy(e *enemy) {
+	if !e.boss {
+		for i := 0; i < INVASOR_ROWS; i++ { copy(p.screen[e.y + i][e.x:], blank(INVASOR_COLS)) }
+		return
+	}
+	for i := -1; i < BOSS_ROWS; i++ { copy(p.screen[e.y + i][e.x:], blank(BOSS_COLS)) }
+}
+
+func (p *Playground) deployEnemyMissile(col, row int) {
+	p.enemyMissiles = append(p.enemyMissiles, enemyMissile{ col: col + EN_MISS_ADJ, row: row + INFO_OFFST, next: p.ticks })
+	p.event(slog.LevelDebug, "spawn", "missile", "enemy", "col", col + EN_MISS_ADJ)
+}
+
+// stepEnemyMissile drops the missile by a row; at the bottom it hurts
+// the shield if the ship is there, then fades out. It reports when the
+// missile is gone.
+func (p *Playground) stepEnemyMissile(m *enemyMissile) bool {
+	end, begin := p.termRow - SPRITE_END, p.termRow - SPRITE_BEGIN - 1
+
+	if m.frame == 0 {
+		if m.row < end && p.screen[m.row + 1][m.col] == SPACE_CHARAC {
+			m.row++
+			p.screen[m.row][m.col]     = ENEMY_MISSILE
+			p.screen[m.row - 1][m.col] = SPACE_CHARAC
+			m.next = p.ticks + ticks(p.Difficulty().MissileStep)
+			return false
+		}
+		if m.row >= begin && m.row < end {
+			p.event(slog.LevelDebug, "hit", "target", "ship", "col", m.col)
+			p.changeShield(-1)
+			p.play(sound.PLAYER_HIT)
+			if p.shield == STD_SHIELD_EXP { p.critical(CAUSE_SHOT) }
+		}
+		m.frame++
+	}
+
+	p.screen[m.row][m.col] = enemyMissileFade[m.frame]
+	m.frame++
+	m.next = p.ticks + ticks(TIMER_LEVEL_A)
+	return m.frame == EN_MISS_SEQ_LEN
+}
+
+func (p *Playground) deployMissile() {
+	p.fire(p.curCol, false)
+}
+
+// fire launches a missile from the ship at col, the one of the second
+// player of a co-op game if mate.
+func (p *Playground) fire(col int, mate bool) {
+	p.play(sound.FIRE)
+	p.missiles = append(p.missiles, missile{ col: col + COL_START_LIMIT, row: p.termRow - ROW_LOW_LIMIT, next: p.ticks, mate: mate })
+	p.event(slog.LevelDebug, "spawn", "missile", "ship", "col", col + COL_START_LIMIT, "mate", mate)
+}
+
+// stepMissile moves the missile up a row, until it hits something; a
+// hit below the top row is an explosion for the enemy to take.
+func (p *Playground) stepMissile(m *missile) bool {
+	startPos, safeRows := p.termRow - ROW_START_LIMIT, p.termRow - SPRITE_BEGIN
+
+	if m.row > 0 && p.screen[m.row - 1][m.col] == SPACE_CHARAC {
+		m.row--
+		p.screen[m.row][m.col]     = MISSILE_HEAD
+		p.screen[m.row + 1][m.col] = MISSILE_BODY
+		if m.row < startPos {
+			trailA, trailB := MISSILE_TRAIL_A, MISSILE_TRAIL_B
+			if m.row % 2 != 0 { trailA, trailB = trailB, trailA }
+			p.screen[m.row + 2][m.col] = trailA
+			p.screen[m.row + 3][m.col] = trailB
+			p.screen[m.row + 4][m.col] = SPACE_CHARAC
+		} else {
+			p.screen[m.row + 2][m.col] = SPACE_CHARAC
+		}
+		m.next = p.ticks + ticks(TIMER_LEVEL_A)
+		return false
+	}
+
+	for i := 0; i < 5; i++ {
+		if m.row + i < safeRows { p.screen[m.row + i][m.col] = SPACE_CHARAC }
+	}
+	if m.row != 0 {
+		p.explosions++
+		p.mateShot = m.mate
+	}
+	return true
+}
+
+// critical ends the round: the ship blows up, for cause, then the game
+// over dialog comes.
+func (p *Playground) critical(cause string) {
+	if p.stop { return }
+	p.stop   = true
+	p.diedAt = p.ticks
+	p.cause  = cause
+	p.event(slog.LevelInfo, "ship destroyed", "cause", cause, "score", p.score, "level", p.level, "shield", p.shield)
+	p.play(sound.GAME_OVER)
+	p.endFrame, p.endNext = 0, p.ticks
+}
+
+func (p *Playground) stepEnding() {
+	if !p.stop || p.start || p.ticks < p.endNext { return }
+
+	if p.endFrame == DESTR_SEQUENCE {
+		p.restart(true)
+		return
+	}
+	for i := range shipDestr[p.endFrame] {
+		copy(p.screen[p.termRow - (SPRITE_BEGIN - i)][p.curCol:], shipDestr[p.endFrame][i][:])
+		if p.mate != nil { copy(p.screen[p.termRow - (SPRITE_BEGIN - i)][p.mate.col:], shipDestr[p.endFrame][i][:]) }
+	}
+	p.endFrame++
+	p.endNext = p.ticks + ticks(TIMER_LEVEL_C)
+}
+
+func blank(n int) []rune {
+	b := make([]rune, n)
+	for i := range b {
+		b[i] = SPACE_CHARAC
+	}
+	return b
+}
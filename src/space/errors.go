@@ -0,0 +1,152 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+const (
+	CRASH_FILE      = ".systemInvaders.crash"
+	CRASH_INPUTS    = 32
+)
+
+// The class of an error says what went wrong, and the exit code the
+// program ends with.
+var errorClasses = map[int]string{
+	RUNTIME_ERROR: "Runtime Error",
+	DIMS_ERROR:    "Terminal Size Error",
+	CONFIG_ERROR:  "Configuration Error",
+	USAGE_ERROR:   "Usage Error",
+	TERM_ERROR:    "Terminal Error",
+	FILE_ERROR:    "File Error",
+	NET_ERROR:     "Network Error",
+	VERIFY_ERROR:  "Verification Error",
+}
+
+// Error is an error of one of the classes, a signal ending the game
+// being the class SIGNAL_EXIT plus its number.
+type Error struct {
+	Code  int
+	Err   error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func errorf(code int, format string, args ...interface{}) error {
+	return &Error{ Code: code, Err: fmt.Errorf(format, args...) }
+}
+
+// ExitCode is the exit code for err: NO_ERROR for nil, RUNTIME_ERROR
+// for an error without a class.
+func ExitCode(err error) int {
+	var e *Error
+	switch {
+		case err == nil:           return NO_ERROR
+		case errors.As(err, &e):   return e.Code
+	}
+	return RUNTIME_ERROR
+}
+
+// Report writes err to out, headed by its class, and returns the exit
+// code.
+func Report(out io.Writer, err error) int {
+	code := ExitCode(err)
+	if err == nil { return code }
+
+	class, ok := errorClasses[code]
+	if !ok { class = "Terminated" }
+	fmt.Fprintf(out, "%s: %v\n", class, err)
+	return code
+}
+
+func CrashPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil { home = "." }
+	return filepath.Join(home, CRASH_FILE)
+}
+
+// An input is a key read from the keyboard and the tick of the round
+// when it came; the last CRASH_INPUTS go in the crash report.
+type input struct {
+	tick  int64
+	key   byte
+}
+
+// logInput keeps k among the last inputs. The caller must hold the lock.
+func (p *Playground) logInput(k byte) {
+	if len(p.inputs) == CRASH_INPUTS { p.inputs = p.inputs[1:] }
+	p.inputs = append(p.inputs, input{ p.ticks, k })
+}
+
+// recoverCrash is deferred by every goroutine of the game: a panic is
+// a bug, the game cannot go on. The terminal is given back, a crash
+// report is written and the program exits with RUNTIME_ERROR, without
+// waiting for the other goroutines, which may be stuck on the lock.
+func (p *Playground) recoverCrash() {
+	v := recover()
+	if v == nil { return }
+
+	report := p.crashReport(v, debug.Stack())
+	p.CanonicMode()
+	p.log.Error("crash", "panic", fmt.Sprint(v))
+	p.CloseLog(nil)
+
+	path := CrashPath()
+	if err := os.WriteFile(path, report, 0600); err != nil {
+		os.Stderr.Write(report)
+		path = "standard error"
+	}
+	fmt.Fprintf(os.Stderr, "%s: %v\nThe crash report is in %s\n", errorClasses[RUNTIME_ERROR], v, path)
+	os.Exit(RUNTIME_ERROR)
+}
+
+// crashReport describes the game as it was when v was raised. The lock
+// may be held by the goroutine that panicked, in that case the state is
+// read without it.
+func (p *Playground) crashReport(v interface{}, stack []byte) []byte {
+	if p.TryLock() { defer p.Unlock() }
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "SystemInvaders %s crash report, %s\n\n", VERSION, time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&b, "panic: %v\n\n%s\n", v, stack)
+	fmt.Fprintf(&b, "seed %d\ndifficulty %s\nsize %d %d\ntick %d\nscore %d\nlevel %d\nshield %d\n\n",
+	            p.seed, p.Difficulty().Name, p.termRow, p.termCol, p.ticks, p.score, p.level, p.shield)
+
+	fmt.Fprintf(&b, "last %d inputs (tick key):\n", len(p.inputs))
+	for _, in := range p.inputs {
+		fmt.Fprintf(&b, "%d %d\n", in.tick, in.key)
+	}
+
+	b.WriteString("\nscreen:\n")
+	for i := range p.screen {
+		fmt.Fprintf(&b, "%s\n", strings.TrimRight(string(p.screen[i]), " "))
+	}
+	return []byte(b.String())
+}
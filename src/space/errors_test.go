@@ -0,0 +1,101 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const CRASH_CHILD = "SYSTEMINVADERS_CRASH_CHILD"
+
+func TestExitCode(t *testing.T) {
+	for _, c := range []struct {
+		err   error
+		code  int
+	}{
+		{ nil, NO_ERROR },
+		{ errors.New("plain"), RUNTIME_ERROR },
+		{ errorf(DIMS_ERROR, "small"), DIMS_ERROR },
+		{ fmt.Errorf("wrapped: %w", errorf(FILE_ERROR, "missing")), FILE_ERROR },
+		{ errorf(SIGNAL_EXIT + 1, "hangup"), SIGNAL_EXIT + 1 },
+	}{
+		if code := ExitCode(c.err); code != c.code { t.Errorf("ExitCode(%v) = %d, want %d", c.err, code, c.code) }
+	}
+}
+
+func TestReport(t *testing.T) {
+	var out bytes.Buffer
+	if code := Report(&out, errorf(CONFIG_ERROR, "bad fps")); code != CONFIG_ERROR { t.Errorf("code %d", code) }
+	if out.String() != "Configuration Error: bad fps\n" { t.Errorf("reported %q", out.String()) }
+
+	out.Reset()
+	if code := Report(&out, nil); code != NO_ERROR || out.Len() != 0 { t.Errorf("nil reported %q, code %d", out.String(), code) }
+}
+
+func TestCrashReport(t *testing.T) {
+	p := NewHeadless(35, 100, 42, "HARD")
+	for i := 0; i < CRASH_INPUTS + 5; i++ {
+		p.Tick()
+		p.logInput(byte('a' + i % 3))
+	}
+
+	report := string(p.crashReport("boom", []byte("goroutine 1 [running]:")))
+	for _, want := range []string{ "panic: boom", "goroutine 1 [running]:", "seed 42", "difficulty HARD",
+	                               "size 35 100", fmt.Sprintf("last %d inputs", CRASH_INPUTS), "37 97\n",
+	                               "screen:\n", "SCORE: 0" } {
+		if !strings.Contains(report, want) { t.Errorf("the report has no %q:\n%s", want, report) }
+	}
+	if strings.Contains(report, "\n4 97\n") { t.Error("the report has more than the last inputs") }
+}
+
+// A panic in a goroutine of the game gives back the terminal, writes
+// the report and exits with RUNTIME_ERROR; it runs in a child process.
+func TestCrashExit(t *testing.T) {
+	if os.Getenv(CRASH_CHILD) != "" {
+		p := NewHeadless(35, 100, 7, "NORMAL")
+		p.session = newSupervisor(context.Background(), p.recoverCrash)
+		p.session.Go(func(ctx context.Context) { panic("boom") })
+		<- make(chan struct{})
+	}
+
+	home := t.TempDir()
+	child := exec.Command(os.Args[0], "-test.run=^TestCrashExit$")
+	child.Env = append(os.Environ(), CRASH_CHILD + "=1", "HOME=" + home)
+	out, err := child.CombinedOutput()
+
+	if err == nil || child.ProcessState.ExitCode() != RUNTIME_ERROR {
+		t.Fatalf("the crash exited with %v, want %d:\n%s", err, RUNTIME_ERROR, out)
+	}
+	if !strings.Contains(string(out), "Runtime Error: boom") { t.Errorf("the crash printed:\n%s", out) }
+
+	report, err := os.ReadFile(filepath.Join(home, CRASH_FILE))
+	if err != nil { t.Fatal(err) }
+	if !bytes.Contains(report, []byte("panic: boom")) || !bytes.Contains(report, []byte("seed 7")) {
+		t.Errorf("the crash report is:\n%s", report)
+	}
+}
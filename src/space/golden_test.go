@@ -0,0 +1,135 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// A goldenCase is a headless round with keys pressed at given ticks,
+// and the ticks at which its screen is compared with testdata/NAME.golden.
+type goldenCase struct {
+	name          string
+	rows, cols    int
+	seed          int64
+	difficulty    string
+	demo          bool
+	keys          map[int64]string
+	at            []int64
+	untilOver     bool
+}
+
+var goldenCases = []goldenCase{
+	{ name: "start", rows: 35, cols: 100, seed: 1, difficulty: "NORMAL", at: []int64{ 1 } },
+	{ name: "narrow-hud", rows: 30, cols: 72, seed: 1, difficulty: "NORMAL", at: []int64{ 1 } },
+	{ name: "invader-missile", rows: 35, cols: 100, seed: 7, difficulty: "HARD", at: []int64{ 20, 40 } },
+	{ name: "kill", rows: 35, cols: 100, seed: 1, difficulty: "EASY",
+	  keys: map[int64]string{ 1: "a", 2: " " }, at: []int64{ 10, 48, 52, 60 } },
+	{ name: "restart", rows: 35, cols: 100, seed: 1, difficulty: "NORMAL",
+	  keys: map[int64]string{ 5: "r" }, at: []int64{ 6 } },
+	{ name: "game-over", rows: 35, cols: 100, seed: 3, difficulty: "HARD", untilOver: true },
+	{ name: "demo", rows: 35, cols: 100, seed: 5, difficulty: "NORMAL", demo: true, at: []int64{ 100, 300 } },
+}
+
+// play runs the case and returns its frames, each under a header with
+// its tick. Trailing blanks are dropped so that the files stay easy to
+// read and to edit.
+func (c goldenCase) play() []byte {
+	p := NewHeadless(c.rows, c.cols, c.seed, c.difficulty)
+	p.demo = c.demo
+
+	var out bytes.Buffer
+	frame := func() {
+		fmt.Fprintf(&out, "--- tick %d ---\n", p.Ticks())
+		for _, row := range p.Screen() {
+			fmt.Fprintln(&out, strings.TrimRight(row, " "))
+		}
+	}
+
+	last := int64(0)
+	for _, tick := range c.at {
+		if tick > last { last = tick }
+	}
+	if c.untilOver { last = 1 << 20 }
+
+	for next := 0; p.Ticks() < last; {
+		for _, k := range []byte(c.keys[p.Ticks() + 1]) { p.Press(k) }
+		p.Tick()
+		if next < len(c.at) && p.Ticks() == c.at[next] {
+			frame()
+			next++
+		}
+		if c.untilOver && p.awaitRestart {
+			frame()
+			break
+		}
+	}
+	return out.Bytes()
+}
+
+func TestGoldenFrames(t *testing.T) {
+	for _, c := range goldenCases {
+		t.Run(c.name, func(t *testing.T) {
+			got  := c.play()
+			path := filepath.Join("testdata", c.name + ".golden")
+
+			if *update {
+				if err := os.WriteFile(path, got, 0644); err != nil { t.Fatal(err) }
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil { t.Fatalf("%v (run go test space -update to create it)", err) }
+			if !bytes.Equal(got, want) { t.Errorf("frames differ from %s:\n%s", path, diff(want, got)) }
+		})
+	}
+}
+
+// The same seed and keys must always give the same frames.
+func TestDeterministic(t *testing.T) {
+	for _, c := range goldenCases {
+		if a, b := c.play(), c.play(); !bytes.Equal(a, b) { t.Errorf("%s: two runs differ", c.name) }
+	}
+}
+
+// diff shows the first lines that differ, with their line numbers.
+func diff(want, got []byte) string {
+	var (
+		out             strings.Builder
+		wl, gl          = strings.Split(string(want), "\n"), strings.Split(string(got), "\n")
+		shown           int
+	)
+	for i := 0; i < len(wl) || i < len(gl); i++ {
+		var w, g string
+		if i < len(wl) { w = wl[i] }
+		if i < len(gl) { g = gl[i] }
+		if w == g { continue }
+		fmt.Fprintf(&out, "%4d want |%s\n%4d got  |%s\n", i + 1, w, i + 1, g)
+		if shown++; shown == 10 { break }
+	}
+	return out.String()
+}
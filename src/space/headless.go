@@ -0,0 +1,77 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// NewHeadless sets up a round that only lives in memory: no terminal,
+// no sound, no files. It is driven by calling Press and Tick, and is
+// what the tests and the benchmark play with. Given an input, Play
+// works on it too, the frames going nowhere.
+func NewHeadless(rows, cols int, seed int64, difficulty string) *Playground {
+	p := &Playground{}
+	p.headless(rows, cols, seed)
+	p.SetDifficulty(difficulty)
+	p.beginRound()
+	return p
+}
+
+func (p *Playground) headless(rows, cols int, seed int64) {
+	p.termRow, p.termCol = rows, cols
+	p.centTrmRow = rows / 2
+	p.centTrmCol = cols / 2
+	p.curCol     = cols / 2
+	p.shield     = STD_SHIELD_LEV
+	p.level      = 1
+	p.lives      = STD_LIVES
+	p.weapon     = STD_WEAPON
+	p.keymap     = DefaultConfig().Keys
+	p.difficulty = DIFF_NORMAL
+	p.fps        = STD_FPS
+	p.out        = io.Discard
+	p.log        = discardLog
+	p.keys       = make(chan byte, KEYS_BUFFER)
+	p.resized    = make(chan struct{}, 1)
+	p.session    = newSupervisor(context.Background(), func() {})
+	p.seedRng(seed, 0)
+	p.caps, _    = loadCaps(STD_TERM)
+	p.makeScreen()
+}
+
+// Screen returns the rows of the screen as they would be drawn.
+func (p *Playground) Screen() []string {
+	rows := make([]string, len(p.screen))
+	for i := range p.screen {
+		rows[i] = string(p.screen[i])
+	}
+	return rows
+}
+
+func (p *Playground) String() string {
+	return strings.Join(p.Screen(), "\n")
+}
+
+func (p *Playground) Ticks() int64 { return p.ticks }
+
+func (p *Playground) Score() int { return p.score }
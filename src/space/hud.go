@@ -0,0 +1,131 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	HUD_ROWS       = 1
+	HUD_MARGIN     = 1
+	HUD_SEPARATOR  = " \U00002502 "
+	HUD_HELP       = "Move: %s,%s Jump: %s,%s Fire: %s Quit: %s  New: %s"
+	HUD_BAR_FULL   = '\U00002588'
+	HUD_BAR_EMPTY  = '\U00002591'
+	HUD_CLOCK      = time.Second
+)
+
+// A hudField is one labelled value of the status row. Fields are drawn
+// in declaration order, the empty ones left out; when the terminal is
+// too narrow the ones with the highest priority value are dropped first.
+type hudField struct {
+	priority int
+	text     func(p *Playground) string
+}
+
+var hudFields = []hudField{
+	{ 0, func(p *Playground) string { return fmt.Sprintf("SCORE: %-*d", MAX_SCORE_LEN, p.score) } },
+	{ 0, func(p *Playground) string { return p.mateScore() } },
+	{ 0, func(p *Playground) string { return p.matchScore() } },
+	{ 5, func(p *Playground) string { return fmt.Sprintf("HI: %-*d", MAX_SCORE_LEN, p.hiScore) } },
+	{ 3, func(p *Playground) string { return fmt.Sprintf("LEVEL: %-2d", p.level) } },
+	{ 2, func(p *Playground) string { return fmt.Sprintf("LIVES: %d", p.lives) } },
+	{ 1, func(p *Playground) string { return "SHIELD: " + p.shieldBar() } },
+	{ 6, func(p *Playground) string { return p.weapon } },
+	{ 4, func(p *Playground) string { return p.elapsed() } },
+}
+
+// hudLayout returns the help text and the status fields that fit in
+// the terminal width, help being the first thing to go.
+func (p *Playground) hudLayout() (help string, fields []string) {
+	var (
+		width  int   = p.termCol - 2 * HUD_MARGIN
+		sepLen int   = len([]rune(HUD_SEPARATOR))
+		keep   []bool = make([]bool, len(hudFields))
+		texts  []string = make([]string, len(hudFields))
+		total  int
+	)
+
+	for i := range hudFields {
+		texts[i] = hudFields[i].text(p)
+		keep[i]  = texts[i] != ""
+		if keep[i] { total += len([]rune(texts[i])) + sepLen }
+	}
+	total -= sepLen
+
+	for total > width {
+		drop := -1
+		for i := range hudFields {
+			if keep[i] && (drop < 0 || hudFields[i].priority > hudFields[drop].priority) {
+				drop = i
+			}
+		}
+		if drop < 0 { break }
+		keep[drop] = false
+		total -= len([]rune(texts[drop])) + sepLen
+	}
+
+	for i := range texts {
+		if keep[i] { fields = append(fields, texts[i]) }
+	}
+
+	keys := p.keymap
+	help = fmt.Sprintf(HUD_HELP, keyName(keys.Left), keyName(keys.Right), keyName(keys.JumpLeft),
+	                   keyName(keys.JumpRight), keyName(keys.Fire), keyName(keys.Quit), keyName(keys.Restart))
+	if p.demo { help = DEMO_HELP }
+	if p.replay != nil { help = fmt.Sprintf(REPLAY_HELP, keyName(keys.Quit)) }
+	if total + sepLen + len([]rune(help)) > width { help = "" }
+
+	return help, fields
+}
+
+// drawHud repaints the status row. The caller must hold the lock; the
+// row is reserved to the HUD and is never reached by the playfield.
+func (p *Playground) drawHud() {
+	row := p.screen[p.termRow - HUD_ROWS]
+	for i := range row {
+		row[i] = SPACE_CHARAC
+	}
+
+	help, fields := p.hudLayout()
+	status := []rune(strings.Join(fields, HUD_SEPARATOR))
+
+	start := p.termCol - HUD_MARGIN - len(status)
+	if start < HUD_MARGIN { start = HUD_MARGIN }
+	copy(row[start:p.termCol - HUD_MARGIN], status)
+
+	if help != "" { copy(row[HUD_MARGIN:], []rune(help)) }
+}
+
+func (p *Playground) shieldBar() string {
+	bar := make([]rune, STD_SHIELD_LEV)
+	for i := range bar {
+		if i < p.shield { bar[i] = HUD_BAR_FULL } else { bar[i] = HUD_BAR_EMPTY }
+	}
+	return string(bar)
+}
+
+func (p *Playground) elapsed() string {
+	secs := int(time.Duration(p.ticks) * TICK / time.Second)
+	return fmt.Sprintf("TIME: %02d:%02d", secs / 60, secs % 60)
+}
@@ -0,0 +1,51 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package space
+
+import (
+	"strings"
+	"testing"
+)
+
+// The status row shows the lives and the weapon of the ship, and the
+// weapon is the first field to go when the terminal is narrow.
+func TestHud(t *testing.T) {
+	cases := []struct {
+		cols, lives  int
+		want, absent []string
+	}{
+		{ 110, STD_LIVES, []string{ "LIVES: 1", STD_WEAPON, "SHIELD: ", "LEVEL: 1" }, nil },
+		{ 110, 0, []string{ "LIVES: 0", STD_WEAPON }, nil },
+		{ 72, STD_LIVES, []string{ "LIVES: 1", "SHIELD: " }, []string{ STD_WEAPON, "HI: " } },
+	}
+	for _, c := range cases {
+		p := NewHeadless(MIN_ROWS, c.cols, 1, "NORMAL")
+		p.lives = c.lives
+		p.drawHud()
+		hud := p.Screen()[p.termRow - HUD_ROWS]
+		for _, text := range c.want {
+			if !strings.Contains(hud, text) { t.Errorf("%d columns, %d lives: no %q in %q", c.cols, c.lives, text, hud) }
+		}
+		for _, text := range c.absent {
+			if strings.Contains(hud, text) { t.Errorf("%d columns, %d lives: %q in %q", c.cols, c.lives, text, hud) }
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"syscall"
+)
+
+// JobControl suspends the game on SIGTSTP, or Ctrl-Z since raw mode
+// turns off the terminal signals, and sets the terminal up again when
+// the game is continued.
+func (p *Playground) JobControl(ctx context.Context){
+	for {
+		select {
+			case <- ctx.Done():
+				return
+			case <- p.stopSignal:
+				p.suspend()
+			case <- p.contSignal:
+				p.resume()
+		}
+	}
+}
+
+func (p *Playground) requestSuspend(){
+	select {
+		case p.stopSignal <- syscall.SIGTSTP:
+		default:
+	}
+}
+
+// suspend stops the whole game, the lock is held until it continues so
+// that nothing moves in the meantime.
+func (p *Playground) suspend(){
+	p.Lock()
+	defer p.Unlock()
+
+	p.leaveScreen()
+	p.event(slog.LevelInfo, "suspend")
+	for len(p.contSignal) > 0 { <- p.contSignal }
+	syscall.Kill(os.Getpid(), syscall.SIGSTOP)
+	<- p.contSignal
+	p.event(slog.LevelInfo, "resume")
+
+	p.enterScreenLocked()
+}
+
+// resume handles a SIGCONT that did not follow a suspension of ours,
+// as after a SIGSTOP sent by someone else.
+func (p *Playground) resume(){
+	p.Lock()
+	defer p.Unlock()
+
+	p.enterScreenLocked()
+}
+
+func (p *Playground) enterScreenLocked(){
+	if p.halted.Load() { return }
+	if err := p.enterScreen(); err != nil {
+		p.event(slog.LevelError, "terminal", "err", err)
+		go p.end(err)
+		return
+	}
+	p.dirty = true
+}
@@ -0,0 +1,75 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package space
+
+import (
+	"context"
+	"log/slog"
+	"os"
+)
+
+const LOG_LEVEL = "debug"
+
+var discardLog = slog.New(slog.DiscardHandler)
+
+// openLog starts the log of the game in the file of opts.Log, if any:
+// the game owns the terminal, the log is where it tells what happened.
+func (p *Playground) openLog() (err error) {
+	p.log, p.logFile, err = OpenLog(p.opts.Log, p.opts.LogLevel)
+	return err
+}
+
+// OpenLog opens the log at path, nothing being logged without one. The
+// lines are JSON objects, appended, tagged with the process id so that
+// the sessions written to the same file can be told apart.
+func OpenLog(path, levelName string) (*slog.Logger, *os.File, error) {
+	if path == "" { return discardLog, nil, nil }
+
+	var level slog.Level
+	if levelName == "" { levelName = LOG_LEVEL }
+	if err := level.UnmarshalText([]byte(levelName)); err != nil {
+		return discardLog, nil, errorf(USAGE_ERROR, "log level %q: use debug, info, warn or error", levelName)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY | os.O_CREATE | os.O_APPEND, 0600)
+	if err != nil { return discardLog, nil, &Error{ FILE_ERROR, err } }
+
+	return slog.New(slog.NewJSONHandler(file, &slog.HandlerOptions{ Level: level })).With("pid", os.Getpid()), file, nil
+}
+
+// CloseLog writes why the game ended, if it did not end well, and
+// closes the log.
+func (p *Playground) CloseLog(err error) {
+	if err != nil { p.log.Error("game ended", "exit", ExitCode(err), "err", err) }
+	p.log.Info("log closed")
+
+	if p.logFile == nil { return }
+	p.logFile.Close()
+	p.logFile, p.log = nil, discardLog
+}
+
+// event logs what happened in the round, at its tick. The caller must
+// hold the lock.
+func (p *Playground) event(level slog.Level, msg string, args ...interface{}) {
+	ctx := context.Background()
+	if !p.log.Enabled(ctx, level) { return }
+	p.log.Log(ctx, level, msg, append([]interface{}{ "tick", p.ticks }, args...)...)
+}
@@ -0,0 +1,66 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package space
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"path/filepath"
+	"testing"
+)
+
+// The kill round of the golden tests, logged: the ship fires, hits the
+// first invader and scores.
+func TestLogEvents(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewHeadless(35, 100, 1, "EASY")
+	p.log = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{ Level: slog.LevelDebug }))
+
+	p.Press('a')
+	p.Press(' ')
+	for p.Ticks() < 60 { p.Tick() }
+
+	seen := map[string]bool{}
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(line, &entry); err != nil { t.Fatalf("%s: %v", line, err) }
+		if _, ok := entry["tick"]; !ok { t.Errorf("no tick in %s", line) }
+		seen[entry["msg"].(string)] = true
+		if entry["msg"] == "score" && entry["score"] != float64(STD_ENEM_POINT) { t.Errorf("score entry %s", line) }
+	}
+	for _, msg := range []string{ "spawn", "hit", "score" } {
+		if !seen[msg] { t.Errorf("no %q entry in\n%s", msg, buf.String()) }
+	}
+}
+
+func TestOpenLog(t *testing.T) {
+	var p Playground
+	p.opts = Options{ Log: filepath.Join(t.TempDir(), "game.log"), LogLevel: "loud" }
+	if err := p.openLog(); ExitCode(err) != USAGE_ERROR { t.Errorf("bad level: %v", err) }
+
+	p.opts = Options{ Log: filepath.Join(t.TempDir(), "missing", "game.log") }
+	if err := p.openLog(); ExitCode(err) != FILE_ERROR { t.Errorf("bad file: %v", err) }
+
+	p.opts = Options{}
+	if err := p.openLog(); err != nil || p.log != discardLog { t.Errorf("no log: %v", err) }
+	p.CloseLog(nil)
+}
@@ -0,0 +1,270 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	MENU_START      = iota
+	MENU_DIFFICULTY
+	MENU_SCORES
+	MENU_CONTROLS
+	MENU_SETTINGS
+	MENU_QUIT
+	MENU_DEMO
+)
+
+const (
+	KEY_NONE        = iota
+	KEY_UP
+	KEY_DOWN
+	KEY_LEFT
+	KEY_RIGHT
+	KEY_ENTER
+	KEY_BACK
+	KEY_REDRAW
+	KEY_OTHER
+)
+
+const (
+	MENU_IDLE       = 15 * time.Second
+	MENU_LOGO_ROW   = 2
+	MENU_ITEMS_ROW  = 12
+	MENU_ITEM_GAP   = 2
+	MENU_CURSOR     = "\U000025B6 "
+	MENU_FOOTER     = "w/s: select   a/d: change   enter: confirm   q: back"
+	PAGE_FOOTER     = "Press any key"
+	ESC_CHARAC      = 0x1B
+)
+
+var menuItems = [...]string{
+	MENU_START:      "START",
+	MENU_DIFFICULTY: "DIFFICULTY",
+	MENU_SCORES:     "HIGH SCORES",
+	MENU_CONTROLS:   "CONTROLS",
+	MENU_SETTINGS:   "SETTINGS",
+	MENU_QUIT:       "QUIT",
+}
+
+var logo = [...]string{
+	"\U00002554\U00002550\U00002557\U00002566 \U00002566\U00002554\U00002550\U00002557\U00002554\U00002566\U00002557\U00002554\U00002550\U00002557\U00002554\U00002566\U00002557",
+	"\U0000255A\U00002550\U00002557\U0000255A\U00002566\U0000255D\U0000255A\U00002550\U00002557 \U00002551 \U00002551\U00002563 \U00002551\U00002551\U00002551",
+	"\U0000255A\U00002550\U0000255D \U00002569 \U0000255A\U00002550\U0000255D \U00002569 \U0000255A\U00002550\U0000255D\U00002569 \U00002569",
+	"",
+	"\U00002566\U00002554\U00002557\U00002554\U00002566  \U00002566\U00002554\U00002550\U00002557\U00002554\U00002566\U00002557\U00002554\U00002550\U00002557\U00002566\U00002550\U00002557\U00002554\U00002550\U00002557",
+	"\U00002551\U00002551\U00002551\U00002551\U0000255A\U00002557\U00002554\U0000255D\U00002560\U00002550\U00002563 \U00002551\U00002551\U00002551\U00002563 \U00002560\U00002566\U0000255D\U0000255A\U00002550\U00002557",
+	"\U00002569\U0000255D\U0000255A\U0000255D \U0000255A\U0000255D \U00002569 \U00002569\U00002550\U00002569\U0000255D\U0000255A\U00002550\U0000255D\U00002569\U0000255A\U00002550\U0000255A\U00002550\U0000255D",
+	"",
+	"The evil dictator of planet D want to conquer your system !",
+}
+
+// TitleScreen runs the main menu until the player starts a game or
+// quits. After MENU_IDLE without input it returns MENU_DEMO.
+func (p *Playground) TitleScreen() int {
+	p.Lock()
+	p.demo = false
+	p.Unlock()
+
+	selected := MENU_START
+	for {
+		p.drawTitle(selected)
+
+		switch p.menuKey(MENU_IDLE) {
+			case KEY_NONE:
+				p.Lock()
+				p.demo = true
+				p.Unlock()
+				return MENU_DEMO
+			case KEY_UP:
+				selected = (selected + len(menuItems) - 1) % len(menuItems)
+			case KEY_DOWN:
+				selected = (selected + 1) % len(menuItems)
+			case KEY_LEFT:
+				if selected == MENU_DIFFICULTY { p.changeDifficulty(DIR_LEFT) }
+			case KEY_RIGHT:
+				if selected == MENU_DIFFICULTY { p.changeDifficulty(DIR_RIGHT) }
+			case KEY_BACK:
+				return MENU_QUIT
+			case KEY_ENTER:
+				switch selected {
+					case MENU_START, MENU_QUIT:
+						return selected
+					case MENU_DIFFICULTY:
+						p.changeDifficulty(DIR_RIGHT)
+					case MENU_SCORES:
+						p.scoresScreen()
+					case MENU_CONTROLS:
+						p.controlsScreen()
+					case MENU_SETTINGS:
+						p.settingsScreen()
+				}
+		}
+	}
+}
+
+func (p *Playground) drawTitle(selected int) {
+	p.Lock()
+	p.clearScreen()
+
+	for i, line := range logo {
+		p.putCentered(MENU_LOGO_ROW + i, line)
+	}
+
+	for i, item := range menuItems {
+		if i == MENU_DIFFICULTY { item = fmt.Sprintf("%s  < %s >", item, p.Difficulty().Name) }
+		p.putMenuItem(MENU_ITEMS_ROW + i * MENU_ITEM_GAP, item, i == selected)
+	}
+
+	p.putCentered(p.termRow - HUD_ROWS - 1, MENU_FOOTER)
+	p.refreshScreenUnlock(0)
+}
+
+func (p *Playground) scoresScreen() {
+	var lines []string
+
+	scores, err := LoadScores(p.scoresPath)
+	switch {
+		case err != nil:
+			lines = append(lines, "Cannot read the high scores: " + err.Error())
+		case len(scores) == 0:
+			lines = append(lines, "No scores yet")
+		default:
+			for i, s := range scores {
+				lines = append(lines, fmt.Sprintf("%2d. %-12.12s %*d  L%-3d %s", i + 1, s.Name,
+				                                  MAX_SCORE_LEN, s.Points, s.Level, s.Date.Local().Format("2006-01-02")))
+			}
+	}
+
+	p.showPage("HIGH SCORES", lines)
+}
+
+func (p *Playground) controlsScreen() {
+	var lines []string
+	p.Lock()
+	for _, action := range keyActions {
+		lines = append(lines, fmt.Sprintf("%-8s %-10s", keyName(*action.key(&p.keymap)), action.label))
+	}
+	p.Unlock()
+	p.showPage("CONTROLS", lines)
+}
+
+// showPage draws a titled list and waits for a key.
+func (p *Playground) showPage(title string, lines []string) {
+	for p.drawPage(title, PAGE_FOOTER, lines); p.menuKey(MENU_IDLE) == KEY_REDRAW; p.drawPage(title, PAGE_FOOTER, lines) {}
+}
+
+func (p *Playground) drawPage(title, footer string, lines []string) {
+	p.Lock()
+	p.clearScreen()
+
+	p.putCentered(MENU_LOGO_ROW, title)
+	for i, line := range lines {
+		p.putCentered(MENU_LOGO_ROW + MENU_ITEM_GAP + i, line)
+	}
+	p.putCentered(p.termRow - HUD_ROWS - 1, footer)
+	p.refreshScreenUnlock(0)
+}
+
+func (p *Playground) changeDifficulty(direction int) {
+	p.Lock()
+	p.cycleDifficulty(direction)
+	p.Unlock()
+}
+
+func (p *Playground) cycleDifficulty(direction int) {
+	p.difficulty = (p.difficulty + len(Difficulties) + direction) % len(Difficulties)
+}
+
+// menuKey waits up to timeout for a key and translates it, arrow
+// escape sequences included, to one of the KEY_ values. When the game
+// ends it is KEY_BACK, and KEY_REDRAW after a resize.
+func (p *Playground) menuKey(timeout time.Duration) int {
+	var key byte
+
+	select {
+		case k, ok := <- p.keys:
+			if !ok { return KEY_BACK }
+			key = k
+		case <- p.session.ctx.Done():
+			return KEY_BACK
+		case <- p.resized:
+			return KEY_REDRAW
+		case <- time.After(timeout):
+			return KEY_NONE
+	}
+
+	switch key {
+		case ESC_CHARAC:
+			switch p.escapeSequence() {
+				case "[A", "OA": return KEY_UP
+				case "[B", "OB": return KEY_DOWN
+				case "[C", "OC": return KEY_RIGHT
+				case "[D", "OD": return KEY_LEFT
+				case "":         return KEY_BACK
+			}
+		case 'w', 'k':           return KEY_UP
+		case 's', 'j':           return KEY_DOWN
+		case 'a', 'h':           return KEY_LEFT
+		case 'd', 'l':           return KEY_RIGHT
+		case '\r', '\n', ' ':    return KEY_ENTER
+		case 'q':                return KEY_BACK
+	}
+	return KEY_OTHER
+}
+
+func (p *Playground) escapeSequence() string {
+	var seq []byte
+	for len(seq) < 2 {
+		select {
+			case k, ok := <- p.keys:
+				if !ok { return string(seq) }
+				seq = append(seq, k)
+			case <- time.After(TIMER_LEVEL_AM):
+				return string(seq)
+		}
+	}
+	return string(seq)
+}
+
+func (p *Playground) putMenuItem(row int, item string, selected bool) {
+	if selected {
+		p.putCentered(row, MENU_CURSOR + item + "  ")
+	} else {
+		p.putCentered(row, "  " + item + "  ")
+	}
+}
+
+func (p *Playground) clearScreen() {
+	for i := range p.screen {
+		for j := range p.screen[i] {
+			p.screen[i][j] = SPACE_CHARAC
+		}
+	}
+}
+
+func (p *Playground) putCentered(row int, text string) {
+	line := []rune(text)
+	col  := (p.termCol - len(line)) / 2
+	if col < 0 { col = 0 }
+	copy(p.screen[row][col:], line)
+}
@@ -0,0 +1,94 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package space
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"syscall"
+)
+
+// A Remote is a terminal at the other end of a connection, for the
+// games a server hosts: the keys are read from Conn and the screen is
+// written to it, Size tells the size of the terminal, of type Term.
+type Remote struct {
+	Conn    io.ReadWriter
+	Term    string
+	Size    func() (rows, cols int)
+	Player  string
+	Log     *slog.Logger
+}
+
+// InitRemote sets up a game for opts on the terminal r, as one among
+// the others of a server: the signals of the process are not its own,
+// the settings changed last as long as the game, the PCM sound is left
+// silent and a crash ends this game only. The scores go to the table
+// shared by all the games, under the name of the player.
+func (p *Playground) InitRemote(opts Options, r Remote) error {
+	p.winchSignal = make(chan os.Signal, 1)
+	p.session     = newSupervisor(context.Background(), p.recoverRemote)
+	p.in, p.out   = r.Conn, r.Conn
+	p.size        = func() (int, int, error) {
+		rows, cols := r.Size()
+		return rows, cols, nil
+	}
+	p.opts        = opts
+	p.remote      = true
+	p.player      = r.Player
+	p.pcmFailed   = true
+	p.log         = r.Log
+	if p.log == nil { p.log = discardLog }
+
+	if err := p.setup(r.Term); err != nil { return err }
+	p.configPath = ""
+	return nil
+}
+
+// Resize tells a remote game that the size of its terminal changed.
+func (p *Playground) Resize() {
+	select {
+		case p.winchSignal <- syscall.SIGWINCH:
+		default:
+	}
+}
+
+// recoverRemote is the crash handler of a remote game: the report goes
+// to the log and to the crash file, then the game ends with the error
+// and the connection is dropped, while the server goes on.
+func (p *Playground) recoverRemote() {
+	v := recover()
+	if v == nil { return }
+
+	report := p.crashReport(v, debug.Stack())
+	p.halted.Store(true)
+	p.log.Error("crash", "panic", fmt.Sprint(v), "report", string(report))
+	os.WriteFile(CrashPath(), report, 0600)
+
+	err := errorf(RUNTIME_ERROR, "%v", v)
+	go func() {
+		p.end(err)
+		if conn, ok := p.in.(io.Closer); ok { conn.Close() }
+	}()
+}
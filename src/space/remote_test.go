@@ -0,0 +1,126 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package space
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A remote game takes its size from the connection and follows its
+// changes, and keeps its scores under the name of the player.
+func TestRemote(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var mu sync.Mutex
+	rows, cols := 35, 100
+	size := func() (int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return rows, cols
+	}
+
+	keys, press := io.Pipe()
+	defer press.Close()
+	var screen screenBuffer
+	conn := struct{ *io.PipeReader; io.Writer }{ keys, &screen }
+
+	var p Playground
+	err := p.InitRemote(Options{ Seed: 1, Difficulty: "easy", NoTitle: true },
+	                    Remote{ Conn: conn, Term: "xterm", Size: size, Player: "alice" })
+	if err != nil { t.Fatal(err) }
+	if p.termRow != 35 || p.termCol != 100 { t.Fatalf("the game is %dx%d, want 100x35", p.termCol, p.termRow) }
+	if err := p.RawMode(); err != nil { t.Fatal(err) }
+	if !screen.Contains(p.caps.smcup) { t.Error("the alternate screen was not entered") }
+
+	done := make(chan error, 1)
+	go func() { done <- p.Play() }()
+	waitRounds(t, &p, 1)
+
+	mu.Lock()
+	rows, cols = 40, 120
+	mu.Unlock()
+	p.Resize()
+	waitFor(t, &p, "the game to resize", func() bool { return p.termRow == 40 && p.termCol == 120 })
+
+	p.Lock()
+	p.score = 70
+	p.recordScore()
+	p.Unlock()
+	scores, err := LoadScores(ScoresPath())
+	if err != nil || len(scores) != 1 || scores[0].Name != "alice" { t.Errorf("the scores are %v, %v", scores, err) }
+
+	press.Write([]byte{ p.keymap.Quit })
+	if err := <-done; err != nil { t.Errorf("the game ended with %v", err) }
+	p.CanonicMode()
+	if !screen.Contains(p.caps.rmcup) { t.Error("the alternate screen was not left") }
+}
+
+// A remote game refuses a size out of MIN_COLS x MIN_ROWS to
+// MAX_COLS x MAX_ROWS, before making a screen for it.
+func TestRemoteSize(t *testing.T) {
+	for _, size := range [][2]int{ { MIN_ROWS - 1, 100 }, { 35, MAX_COLS + 1 }, { MAX_ROWS + 1, 100 }, { 65535, 65535 } } {
+		var p Playground
+		err := p.InitRemote(Options{ Seed: 1, NoTitle: true },
+		                    Remote{ Conn: struct{ io.Reader; io.Writer }{ strings.NewReader(""), io.Discard }, Term: "xterm",
+		                            Size: func() (int, int) { return size[0], size[1] } })
+		if ExitCode(err) != DIMS_ERROR { t.Errorf("a %dx%d terminal gave %v", size[1], size[0], err) }
+		if p.screen != nil { t.Errorf("a %dx%d terminal got a screen", size[1], size[0]) }
+	}
+}
+
+// A round that panics ends its remote game, with RUNTIME_ERROR and a
+// crash report, instead of leaving the lock held and the game hung.
+func TestRemoteCrash(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	keys, press := io.Pipe()
+	defer press.Close()
+	var screen screenBuffer
+	conn := struct{ *io.PipeReader; io.Writer }{ keys, &screen }
+
+	var p Playground
+	err := p.InitRemote(Options{ Seed: 1, Difficulty: "easy", NoTitle: true },
+	                    Remote{ Conn: conn, Term: "xterm", Size: func() (int, int) { return 35, 100 }, Player: "alice" })
+	if err != nil { t.Fatal(err) }
+
+	done := make(chan error, 1)
+	go func() { done <- p.Play() }()
+	waitRounds(t, &p, 1)
+
+	p.Lock()
+	p.enemy = &enemy{ x: p.termCol + 50, y: 5, next: p.ticks }
+	p.Unlock()
+
+	select {
+		case err := <- done:
+			if ExitCode(err) != RUNTIME_ERROR { t.Errorf("the game ended with %v", err) }
+		case <- time.After(PLAY_TIMEOUT):
+			t.Fatal("the game did not end after the panic")
+	}
+	if _, err := os.Stat(filepath.Join(home, CRASH_FILE)); err != nil { t.Errorf("no crash report: %v", err) }
+}
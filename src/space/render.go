@@ -0,0 +1,126 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"time"
+
+	"terminfo"
+)
+
+const (
+	STD_FPS         = 30
+	MIN_FPS         = 5
+	MAX_FPS         = 60
+	THEME_CLASSIC   = 0
+)
+
+var FrameRates = []int{ 10, 15, 20, 30, 60 }
+
+// Theme colors the whole screen; its attributes are sent before each
+// frame, as far as the terminal supports them.
+type Theme struct {
+	Name           string
+	Fg, Bg         int
+	Bold, Reverse  bool
+}
+
+var Themes = [...]Theme{
+	THEME_CLASSIC: { "CLASSIC",  COLOR_NONE,   COLOR_NONE, false, false },
+	               { "PHOSPHOR", COLOR_GREEN,  COLOR_NONE, true,  false },
+	               { "AMBER",    COLOR_YELLOW, COLOR_NONE, false, false },
+	               { "ICE",      COLOR_CYAN,   COLOR_BLUE, true,  false },
+	               { "INVERSE",  COLOR_NONE,   COLOR_NONE, false, true  },
+}
+
+func ThemeByName(name string) (int, bool) {
+	for i := range Themes {
+		if strings.EqualFold(Themes[i].Name, name) { return i, true }
+	}
+	return THEME_CLASSIC, false
+}
+
+// Render paints the screen at the configured frame rate, only when
+// something changed since the previous frame or a spectator came in,
+// or at every frame with the debug overlay, until ctx is cancelled.
+func (p *Playground) Render(ctx context.Context) {
+	var frame bytes.Buffer
+	for !p.halted.Load() {
+		fps := p.renderFrame(&frame)
+		select {
+			case <- ctx.Done():
+				return
+			case <- time.After(time.Second / time.Duration(fps)):
+		}
+	}
+}
+
+// renderFrame paints a frame if one is due and returns the frame rate.
+// The lock is given back even if the frame panics.
+func (p *Playground) renderFrame(frame *bytes.Buffer) int {
+	p.lock()
+	defer p.Unlock()
+
+	if (p.dirty || p.debug || p.spectators.wants()) && !p.halted.Load() {
+		start := time.Now()
+		p.frame(frame)
+		p.out.Write(frame.Bytes())
+		p.stats.frameDone(start, frame.Len())
+		if p.mate != nil { p.mate.send(p.mateFrame()) }
+		if p.spectators.watched() { p.spectators.publish(p.spectatorFrame()) }
+		p.dirty = false
+	}
+	return p.fps
+}
+
+// frame encodes the whole screen, the caller must hold the lock.
+func (p *Playground) frame(buf *bytes.Buffer) {
+	p.encode(buf, p.caps, false)
+}
+
+// encode writes the screen for a terminal with caps, the ship of the
+// second player in its own color. The rows follow each other, unless
+// each one is to be placed with cup, for a terminal of another size.
+func (p *Playground) encode(buf *bytes.Buffer, caps *termCaps, cup bool) {
+	buf.Reset()
+	buf.WriteString(caps.home)
+	buf.WriteString(caps.sgr0)
+	buf.WriteString(caps.themes[p.theme])
+
+	ship := p.termRow - SPRITE_BEGIN
+	for i, row := range p.overlay() {
+		if cup { buf.WriteString(terminfo.Tparm(caps.cup, i, 0)) }
+		if p.mate == nil || !p.playing || i < ship || i >= ship + SPRITE_ROWS || p.mate.col + SPRITE_COLS > len(row) {
+			buf.WriteString(string(row))
+			continue
+		}
+
+		col := p.mate.col
+		buf.WriteString(string(row[:col]))
+		buf.WriteString(caps.mate)
+		buf.WriteString(string(row[col:col + SPRITE_COLS]))
+		buf.WriteString(caps.sgr0)
+		buf.WriteString(caps.themes[p.theme])
+		buf.WriteString(string(row[col + SPRITE_COLS:]))
+	}
+}
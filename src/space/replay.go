@@ -0,0 +1,155 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	REPLAY_MAGIC      = "SYSTEMINVADERS-REPLAY"
+	REPLAY_VERSION    = 3
+	REPLAY_VERSION_MS = 1
+	REPLAY_END        = "end"
+	REPLAY_HELP       = "REPLAY - press %s to stop"
+)
+
+// A ReplayKey is a key press and the tick of the round it was taken.
+type ReplayKey struct {
+	Tick    int64
+	Key     byte
+}
+
+// A ReplayEnd is how the round ended, as the game saw it.
+type ReplayEnd struct {
+	Tick         int64
+	Points       int
+	Level        int
+	Cause        string
+}
+
+// Replay is a recorded round: what is needed to start the same game
+// again, the keys that were pressed and, unless the recording was cut
+// short, how it ended. On disk it is a text file, a header followed by
+// one "tick key" line per key press and an "end tick points level
+// cause" line; version 1 files, which have milliseconds instead of
+// ticks, are converted, version 2 ones have no end. The keys are those
+// of the default key map, whatever the player used.
+type Replay struct {
+	Seed         int64
+	Difficulty   string
+	Rows, Cols   int
+	Keys         []ReplayKey
+	End          *ReplayEnd
+}
+
+func LoadReplay(path string) (*Replay, error) {
+	file, err := os.Open(path)
+	if err != nil { return nil, err }
+	defer file.Close()
+	return ReadReplay(file, path)
+}
+
+// ReadReplay reads a replay from r, path naming it in the errors.
+func ReadReplay(r io.Reader, path string) (*Replay, error) {
+	var (
+		replay  Replay
+		version int
+		err     error
+		reader  = bufio.NewReader(r)
+	)
+
+	if _, err = fmt.Fscanf(reader, REPLAY_MAGIC + " %d\n", &version); err != nil {
+		return nil, fmt.Errorf("%s: not a replay file", path)
+	}
+	if version < REPLAY_VERSION_MS || version > REPLAY_VERSION {
+		return nil, fmt.Errorf("%s: unsupported replay version %d", path, version)
+	}
+	if _, err = fmt.Fscanf(reader, "seed %d\ndifficulty %s\nsize %d %d\n",
+	                       &replay.Seed, &replay.Difficulty, &replay.Rows, &replay.Cols); err != nil {
+		return nil, fmt.Errorf("%s: bad replay header: %v", path, err)
+	}
+	if _, ok := DifficultyByName(replay.Difficulty); !ok {
+		return nil, fmt.Errorf("%s: unknown difficulty %q", path, replay.Difficulty)
+	}
+
+	for line := 5; ; line++ {
+		text, err := reader.ReadString('\n')
+		if text == "" && err == io.EOF { break }
+		if err != nil && err != io.EOF { return nil, err }
+
+		if replay.End != nil { return nil, fmt.Errorf("%s:%d: line after the end", path, line) }
+		if strings.HasPrefix(text, REPLAY_END + " ") && version == REPLAY_VERSION {
+			end := &ReplayEnd{}
+			if _, err = fmt.Sscanf(text, REPLAY_END + " %d %d %d %s\n", &end.Tick, &end.Points, &end.Level, &end.Cause); err != nil {
+				return nil, fmt.Errorf("%s:%d: bad end line", path, line)
+			}
+			replay.End = end
+			continue
+		}
+
+		var tick, key int64
+		if _, err = fmt.Sscanf(text, "%d %d\n", &tick, &key); err != nil || key < 0 || key > 255 {
+			return nil, fmt.Errorf("%s:%d: bad key line", path, line)
+		}
+		if version == REPLAY_VERSION_MS { tick = ticks(time.Duration(tick) * time.Millisecond) }
+		replay.Keys = append(replay.Keys, ReplayKey{ tick, byte(key) })
+	}
+
+	return &replay, nil
+}
+
+// startRecording writes the replay header; the keys follow as the
+// round goes, unbuffered, so a restart or a crash loses nothing.
+func (p *Playground) startRecording() error {
+	file, err := os.Create(p.opts.Record)
+	if err != nil { return &Error{ FILE_ERROR, err } }
+
+	fmt.Fprintf(file, "%s %d\nseed %d\ndifficulty %s\nsize %d %d\n", REPLAY_MAGIC, REPLAY_VERSION,
+	            p.seed, p.Difficulty().Name, p.termRow, p.termCol)
+	p.record = file
+	return nil
+}
+
+func (p *Playground) recordKey(k byte) {
+	if p.record == nil || p.stop { return }
+	if k, ok := mapKey(k, p.keymap, DefaultConfig().Keys); ok { fmt.Fprintf(p.record, "%d %d\n", p.ticks, k) }
+}
+
+// roundCause is what ended the round so far: what destroyed the ship,
+// or the player.
+func (p *Playground) roundCause() string {
+	if p.cause == "" { return CAUSE_QUIT }
+	return p.cause
+}
+
+// mapKey translates k, a key of the map from, to the key of the same
+// action in the map to; it is false for a key of no action.
+func mapKey(k byte, from, to KeyMap) (byte, bool) {
+	for _, action := range keyActions {
+		if *action.key(&from) == k { return *action.key(&to), true }
+	}
+	return k, false
+}
@@ -0,0 +1,59 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package space
+
+import (
+	"strings"
+	"testing"
+)
+
+const REPLAY_HEADER = "seed 5\ndifficulty EASY\nsize 35 100\n"
+
+// Every version of the file is read, the end only from version 3; the
+// errors tell the line.
+func TestReadReplay(t *testing.T) {
+	for _, c := range []struct {
+		file    string
+		keys    int
+		end     *ReplayEnd
+		err     string
+	}{
+		{ REPLAY_MAGIC + " 3\n" + REPLAY_HEADER + "3 97\n10 32\nend 250 20 1 shot\n", 2, &ReplayEnd{ 250, 20, 1, CAUSE_SHOT }, "" },
+		{ REPLAY_MAGIC + " 3\n" + REPLAY_HEADER + "3 97\n10 32", 2, nil, "" },
+		{ REPLAY_MAGIC + " 2\n" + REPLAY_HEADER + "3 97\n", 1, nil, "" },
+		{ REPLAY_MAGIC + " 1\n" + REPLAY_HEADER + "100 97\n", 1, nil, "" },
+		{ REPLAY_MAGIC + " 2\n" + REPLAY_HEADER + "3 97\nend 250 20 1 shot\n", 0, nil, "round:6: bad key line" },
+		{ REPLAY_MAGIC + " 3\n" + REPLAY_HEADER + "end 250 20 1 shot\n3 97\n", 0, nil, "round:6: line after the end" },
+		{ REPLAY_MAGIC + " 3\n" + REPLAY_HEADER + "end 250 twenty\n", 0, nil, "round:5: bad end line" },
+		{ REPLAY_MAGIC + " 3\n" + REPLAY_HEADER + "3 300\n", 0, nil, "round:5: bad key line" },
+		{ REPLAY_MAGIC + " 4\n" + REPLAY_HEADER, 0, nil, "unsupported replay version 4" },
+	} {
+		replay, err := ReadReplay(strings.NewReader(c.file), "round")
+		switch {
+			case c.err != "":
+				if err == nil || !strings.Contains(err.Error(), c.err) { t.Errorf("%q: got %v, want %q", c.file, err, c.err) }
+			case err != nil:
+				t.Errorf("%q: %v", c.file, err)
+			case len(replay.Keys) != c.keys || (replay.End == nil) != (c.end == nil) || c.end != nil && *replay.End != *c.end:
+				t.Errorf("%q: got %d keys and the end %+v", c.file, len(replay.Keys), replay.End)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package space
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const (
+	SAVE_MAGIC   = "SYSTEMINVADERS-SAVE"
+	SAVE_VERSION = 1
+)
+
+// The lines every save has, whatever the round was doing.
+var saveRequired = []string{ "rng", "tick", "ship", "score", "wave", "timers" }
+
+// Save is a round left with the quit key, to be resumed where it was.
+// On disk it is a text file, a header followed by one "name values"
+// line per part of the round: the random numbers as their seed and how
+// many were drawn, the ship, the score, the wave, the enemy if there is
+// one, a line per missile of the ship and per bomb of the enemies, and
+// the rows of the screen, quoted, which the round reads to find what
+// was hit. A save of another version is refused, as its round would
+// not play the same.
+type Save struct {
+	Difficulty   string
+	Rows, Cols   int
+	state        snapshot
+}
+
+func LoadSave(path string) (*Save, error) {
+	file, err := os.Open(path)
+	if err != nil { return nil, err }
+	defer file.Close()
+	return ReadSave(file, path)
+}
+
+// ReadSave reads a save from r, path naming it in the errors.
+func ReadSave(r io.Reader, path string) (*Save, error) {
+	var (
+		save    Save
+		version int
+		err     error
+		reader  = bufio.NewReader(r)
+		seen    = map[string]bool{}
+		s       = &save.state
+	)
+
+	if _, err = fmt.Fscanf(reader, SAVE_MAGIC + " %d\n", &version); err != nil {
+		return nil, fmt.Errorf("%s: not a saved game", path)
+	}
+	if version != SAVE_VERSION {
+		return nil, fmt.Errorf("%s: the game was saved in version %d of the format, only version %d can be resumed",
+		                       path, version, SAVE_VERSION)
+	}
+	if _, err = fmt.Fscanf(reader, "difficulty %s\nsize %d %d\n", &save.Difficulty, &save.Rows, &save.Cols); err != nil {
+		return nil, fmt.Errorf("%s: bad save header: %v", path, err)
+	}
+	if _, ok := DifficultyByName(save.Difficulty); !ok {
+		return nil, fmt.Errorf("%s: unknown difficulty %q", path, save.Difficulty)
+	}
+
+	for line := 4; ; line++ {
+		text, err := reader.ReadString('\n')
+		if text == "" && err == io.EOF { break }
+		if err != nil && err != io.EOF { return nil, err }
+
+		name, values, _ := strings.Cut(text, " ")
+		switch name {
+			case "rng":
+				_, err = fmt.Sscanf(values, "%d %d\n", &s.seed, &s.draws)
+			case "tick":
+				_, err = fmt.Sscanf(values, "%d\n", &s.ticks)
+			case "ship":
+				_, err = fmt.Sscanf(values, "%d %d %d %s\n", &s.curCol, &s.shield, &s.lives, &s.weapon)
+			case "score":
+				_, err = fmt.Sscanf(values, "%d %d\n", &s.score, &s.level)
+			case "wave":
+				w := &s.wave
+				_, err = fmt.Sscanf(values, "%d %d %d %t %d\n", &w.enemies, &w.deployed, &w.destroyed, &w.boss, &w.x)
+			case "timers":
+				_, err = fmt.Sscanf(values, "%d %d\n", &s.explosions, &s.reload)
+			case "enemy":
+				e := &enemy{}
+				_, err = fmt.Sscanf(values, "%t %d %d %d %d %d %d %d %t %d\n", &e.boss, &e.x, &e.y, &e.shoot1, &e.shoot2,
+				                    &e.damage, &e.phase, &e.frame, &e.shot, &e.next)
+				s.enemy = e
+			case "missile":
+				var m missile
+				_, err = fmt.Sscanf(values, "%d %d %d\n", &m.col, &m.row, &m.next)
+				s.missiles = append(s.missiles, m)
+			case "bomb":
+				var m enemyMissile
+				_, err = fmt.Sscanf(values, "%d %d %d %d\n", &m.col, &m.row, &m.frame, &m.next)
+				s.enemyMissiles = append(s.enemyMissiles, m)
+			case "row":
+				var row string
+				_, err = fmt.Sscanf(values, "%q\n", &row)
+				s.screen = append(s.screen, []rune(row))
+			default:
+				return nil, fmt.Errorf("%s:%d: unknown line %q", path, line, name)
+		}
+		if err != nil || seen[name] && name != "missile" && name != "bomb" && name != "row" {
+			return nil, fmt.Errorf("%s:%d: bad %s line", path, line, name)
+		}
+		seen[name] = true
+	}
+
+	for _, name := range saveRequired {
+		if !seen[name] { return nil, fmt.Errorf("%s: no %s line", path, name) }
+	}
+	if err := save.check(); err != nil { return nil, fmt.Errorf("%s: %v", path, err) }
+	return &save, nil
+}
+
+// check makes sure that everything of the round is on its screen, so
+// that resuming it cannot draw out of it, and that what it waits for
+// comes in time.
+func (save *Save) check() error {
+	s := &save.state
+	if save.Rows < MIN_ROWS || save.Cols < MIN_COLS { return fmt.Errorf("a %dx%d screen is too small", save.Cols, save.Rows) }
+	if len(s.screen) != save.Rows { return fmt.Errorf("%d rows of screen, not %d", len(s.screen), save.Rows) }
+	for i, row := range s.screen {
+		if len(row) != save.Cols { return fmt.Errorf("row %d is %d wide, not %d", i, len(row), save.Cols) }
+	}
+	if s.ticks < 0 { return fmt.Errorf("the round is at tick %d", s.ticks) }
+
+	level, _ := DifficultyByName(save.Difficulty)
+	d := Difficulties[level]
+	wait := ticks(max(d.EnemyStep, d.MissileStep, TIMER_LEVEL_A))
+	due := func(next int64) bool { return next >= 0 && next <= s.ticks + wait }
+	inside := func(col, row int) bool { return col >= 0 && col < save.Cols && row >= 0 && row < save.Rows }
+
+	if s.curCol < EN_MISS_ADJ || s.curCol > save.Cols - SPRITE_COLS_GAP { return fmt.Errorf("the ship is off the screen") }
+	if e := s.enemy; e != nil {
+		// The enemy clears the row above it and, falling, looks at the
+		// one below.
+		cols, rows := INVASOR_COLS, SPRITE_END
+		if e.boss { cols, rows = BOSS_COLS, BOSS_ROWS + 1 }
+		if e.x < 0 || e.x + cols > save.Cols || e.y < 1 || e.y + rows > save.Rows { return fmt.Errorf("the enemy is off the screen") }
+		if e.phase < PHASE_FALL || e.phase > PHASE_BLAST || e.frame < 0 || e.frame > DESTR_SEQUENCE ||
+		   e.damage < 0 || e.damage > STD_BOSS_DAMAGE || !due(e.next) {
+			return fmt.Errorf("the enemy is in no state to resume")
+		}
+	}
+	for _, m := range s.missiles {
+		// Under its head a missile draws its body and trail down to the
+		// row it was fired from.
+		if !inside(m.col, m.row) || m.row > save.Rows - ROW_LOW_LIMIT { return fmt.Errorf("a missile is off the screen") }
+		if !due(m.next) { return fmt.Errorf("a missile is in no state to resume") }
+	}
+	for _, m := range s.enemyMissiles {
+		if !inside(m.col, m.row) || m.row > save.Rows - SPRITE_END { return fmt.Errorf("a bomb is off the screen") }
+		if m.frame < 0 || m.frame >= EN_MISS_SEQ_LEN || !due(m.next) { return fmt.Errorf("a bomb is in no state to resume") }
+	}
+	return nil
+}
+
+// saveRound writes the round to path, through a temporary file so that
+// a failed save leaves the last one alone. The caller must hold the
+// lock.
+func (p *Playground) saveRound(path string) error {
+	s := p.snapshot()
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil { return &Error{ FILE_ERROR, err } }
+
+	writer := bufio.NewWriter(file)
+	fmt.Fprintf(writer, "%s %d\ndifficulty %s\nsize %d %d\n", SAVE_MAGIC, SAVE_VERSION, p.Difficulty().Name, p.termRow, p.termCol)
+	fmt.Fprintf(writer, "rng %d %d\ntick %d\n", s.seed, s.draws, s.ticks)
+	fmt.Fprintf(writer, "ship %d %d %d %s\nscore %d %d\n", s.curCol, s.shield, s.lives, s.weapon, s.score, s.level)
+	fmt.Fprintf(writer, "wave %d %d %d %t %d\n", s.wave.enemies, s.wave.deployed, s.wave.destroyed, s.wave.boss, s.wave.x)
+	fmt.Fprintf(writer, "timers %d %d\n", s.explosions, s.reload)
+	if e := s.enemy; e != nil {
+		fmt.Fprintf(writer, "enemy %t %d %d %d %d %d %d %d %t %d\n", e.boss, e.x, e.y, e.shoot1, e.shoot2,
+		            e.damage, e.phase, e.frame, e.shot, e.next)
+	}
+	for _, m := range s.missiles {
+		fmt.Fprintf(writer, "missile %d %d %d\n", m.col, m.row, m.next)
+	}
+	for _, m := range s.enemyMissiles {
+		fmt.Fprintf(writer, "bomb %d %d %d %d\n", m.col, m.row, m.frame, m.next)
+	}
+	for _, row := range s.screen {
+		fmt.Fprintf(writer, "row %q\n", string(row))
+	}
+
+	if err = writer.Flush(); err != nil {
+		file.Close()
+		return &Error{ FILE_ERROR, err }
+	}
+	if err = file.Close(); err == nil { err = os.Rename(tmp, path) }
+	if err != nil { return &Error{ FILE_ERROR, err } }
+	p.event(slog.LevelInfo, "round saved", "path", path, "tick", s.ticks, "score", s.score)
+	return nil
+}
+
+// quitRound saves the round the player is leaving, when asked to and
+// there is a round going on: not over, nor a demo or a replay. The
+// caller must hold the lock.
+func (p *Playground) quitRound() {
+	if p.opts.Save == "" || !p.playing || p.stop || p.demo || p.replay != nil { return }
+	if err := p.saveRound(p.opts.Save); err != nil && p.err == nil { p.err = err }
+}
+
+// resumeRound takes the round just begun to where the save left it.
+// The caller must hold the lock.
+func (p *Playground) resumeRound() {
+	s := p.saved.state
+	s.hiScore = p.hiScore
+	p.restore(s)
+	p.drawHud()
+	p.event(slog.LevelInfo, "round resumed", "tick", p.ticks, "score", p.score, "level", p.level)
+	p.saved = nil
+}
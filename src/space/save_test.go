@@ -0,0 +1,112 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package space
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A round saved on quitting and resumed goes on as the round would have,
+// with the same random numbers.
+func TestSaveResume(t *testing.T) {
+	p := NewHeadless(35, 100, 5, "HARD")
+	path := filepath.Join(t.TempDir(), "round.save")
+	p.opts.Save = path
+	for p.ticks < 60 {
+		if p.ticks % 9 == 0 { p.Press(p.keymap.Fire) }
+		p.Tick()
+	}
+	if p.enemy == nil || len(p.missiles) == 0 || len(p.enemyMissiles) == 0 { t.Fatal("nothing in the air to save") }
+	if p.roundKey(p.keymap.Quit) != FINISH_QUIT || p.err != nil { t.Fatalf("quitting failed: %v", p.err) }
+
+	saved, err := LoadSave(path)
+	if err != nil { t.Fatal(err) }
+	if saved.Difficulty != "HARD" || saved.Rows != 35 || saved.Cols != 100 { t.Errorf("saved %s at %dx%d", saved.Difficulty, saved.Cols, saved.Rows) }
+
+	r := NewHeadless(35, 100, 1, "HARD")
+	r.saved = saved
+	r.resumeRound()
+	if r.String() != p.String() || r.ticks != p.ticks || r.rngSource.draws != p.rngSource.draws {
+		t.Fatalf("resumed at tick %d:\n%s\nsaved at tick %d:\n%s", r.ticks, r, p.ticks, p)
+	}
+
+	for i := 0; i < 400 && !p.stop; i++ {
+		if i % 7 == 0 {
+			p.Press(p.keymap.Fire)
+			r.Press(r.keymap.Fire)
+		}
+		p.Tick()
+		r.Tick()
+		if r.String() != p.String() { t.Fatalf("the resumed round went another way at tick %d", r.ticks) }
+	}
+	if r.score != p.score || r.level != p.level || r.shield != p.shield { t.Errorf("resumed %d points, %d %d, the round %d, %d %d", r.score, r.level, r.shield, p.score, p.level, p.shield) }
+
+	p.stop = true
+	os.Remove(path)
+	p.quitRound()
+	if _, err := os.Stat(path); err == nil { t.Error("a round over was saved") }
+}
+
+// A save of another version, or one not of the game, is refused; the
+// errors tell the line.
+func TestReadSave(t *testing.T) {
+	p := NewHeadless(35, 100, 5, "NORMAL")
+	path := filepath.Join(t.TempDir(), "round.save")
+	if err := p.saveRound(path); err != nil { t.Fatal(err) }
+	text, err := os.ReadFile(path)
+	if err != nil { t.Fatal(err) }
+	good := string(text)
+	if _, err := ReadSave(strings.NewReader(good), "round"); err != nil { t.Fatal(err) }
+	const enemy = "enemy false 50 1 6 15 0 0 0 false 0"
+	if !strings.Contains(good, enemy) { t.Fatalf("no %q in the save", enemy) }
+
+	for _, c := range []struct {
+		file    string
+		err     string
+	}{
+		{ strings.Replace(good, SAVE_MAGIC + " 1", SAVE_MAGIC + " 0", 1), "round: the game was saved in version 0" },
+		{ strings.Replace(good, SAVE_MAGIC, REPLAY_MAGIC, 1), "round: not a saved game" },
+		{ strings.Replace(good, "difficulty NORMAL", "difficulty SILLY", 1), `unknown difficulty "SILLY"` },
+		{ strings.Replace(good, "tick 0", "tick zero", 1), "round:5: bad tick line" },
+		{ strings.Replace(good, "tick 0", "tick 0\ntick 1", 1), "round:6: bad tick line" },
+		{ strings.Replace(good, "tick 0\n", "", 1), "round: no tick line" },
+		{ strings.Replace(good, "ship ", "shipp ", 1), `round:6: unknown line "shipp"` },
+		{ strings.Replace(good, "ship 49 ", "ship 500 ", 1), "the ship is off the screen" },
+		{ good[:strings.LastIndex(good, "row ")], "34 rows of screen, not 35" },
+		{ strings.Replace(good, enemy, "enemy false 98 1 6 15 0 0 0 false 0", 1), "the enemy is off the screen" },
+		{ strings.Replace(good, enemy, "enemy true 50 30 6 15 0 0 0 false 0", 1), "the enemy is off the screen" },
+		{ strings.Replace(good, enemy, "enemy false 50 0 6 15 0 0 0 false 0", 1), "the enemy is off the screen" },
+		{ strings.Replace(good, enemy, "enemy false 50 1 6 15 0 0 -1 false 0", 1), "the enemy is in no state to resume" },
+		{ strings.Replace(good, enemy, "enemy false 50 1 6 15 0 3 0 false 0", 1), "the enemy is in no state to resume" },
+		{ strings.Replace(good, enemy, "enemy true 50 1 6 15 13 0 0 false 0", 1), "the enemy is in no state to resume" },
+		{ strings.Replace(good, enemy, "enemy false 50 1 6 15 0 0 0 false 1000000", 1), "the enemy is in no state to resume" },
+		{ strings.Replace(good, "timers 0 0\n", "timers 0 0\nmissile 55 34 0\n", 1), "a missile is off the screen" },
+		{ strings.Replace(good, "timers 0 0\n", "timers 0 0\nmissile 55 20 -1\n", 1), "a missile is in no state to resume" },
+		{ strings.Replace(good, "timers 0 0\n", "timers 0 0\nbomb 55 33 0 0\n", 1), "a bomb is off the screen" },
+		{ strings.Replace(good, "timers 0 0\n", "timers 0 0\nbomb 55 20 4 0\n", 1), "a bomb is in no state to resume" },
+	} {
+		_, err := ReadSave(strings.NewReader(c.file), "round")
+		if err == nil || !strings.Contains(err.Error(), c.err) { t.Errorf("got %v, want %q", err, c.err) }
+	}
+}
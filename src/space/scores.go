@@ -0,0 +1,139 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SCORES_FILE   = ".systemInvaders.scores"
+	MAX_SCORES    = 10
+	SCORE_FIELDS  = 4
+)
+
+// Score is one line of the high-score table. On disk every entry is a
+// tab separated line: points, level, RFC3339 date, player name.
+type Score struct {
+	Points  int
+	Level   int
+	Date    time.Time
+	Name    string
+}
+
+func ScoresPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil { home = "." }
+	return filepath.Join(home, SCORES_FILE)
+}
+
+// LoadScores reads the table, best score first. A missing file is an
+// empty table, not an error.
+func LoadScores(path string) ([]Score, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) { return nil, nil }
+	if err != nil { return nil, err }
+	defer file.Close()
+
+	var scores []Score
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", SCORE_FIELDS)
+		if len(fields) != SCORE_FIELDS { continue }
+
+		var (
+			s        Score
+			errP, errL, errD error
+		)
+		s.Points, errP = strconv.Atoi(fields[0])
+		s.Level,  errL = strconv.Atoi(fields[1])
+		s.Date,   errD = time.Parse(time.RFC3339, fields[2])
+		s.Name         = fields[3]
+		if errP != nil || errL != nil || errD != nil { continue }
+
+		scores = append(scores, s)
+	}
+	sortScores(scores)
+
+	return scores, scanner.Err()
+}
+
+// scoresMu serializes the updates of the table by the games of a
+// server.
+var scoresMu sync.Mutex
+
+// SaveScore merges s into the table at path, keeping the best
+// MAX_SCORES entries.
+func SaveScore(path string, s Score) error {
+	scoresMu.Lock()
+	defer scoresMu.Unlock()
+
+	scores, err := LoadScores(path)
+	if err != nil { return err }
+
+	scores = append(scores, s)
+	sortScores(scores)
+	if len(scores) > MAX_SCORES { scores = scores[:MAX_SCORES] }
+
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil { return err }
+
+	writer := bufio.NewWriter(file)
+	for _, entry := range scores {
+		fmt.Fprintf(writer, "%d\t%d\t%s\t%s\n", entry.Points, entry.Level,
+		            entry.Date.UTC().Format(time.RFC3339), entry.Name)
+	}
+	if err = writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil { return err }
+
+	return os.Rename(tmp, path)
+}
+
+func sortScores(scores []Score) {
+	sort.SliceStable(scores, func(i, j int) bool {
+		if scores[i].Points != scores[j].Points { return scores[i].Points > scores[j].Points }
+		return scores[i].Date.Before(scores[j].Date)
+	})
+}
+
+func (p *Playground) playerName() string {
+	if p.player != "" { return p.player }
+	for _, env := range []string{"USER", "LOGNAME"} {
+		if name := os.Getenv(env); name != "" { return name }
+	}
+	return "player"
+}
+
+func (p *Playground) recordScore() {
+	if p.score == 0 || p.demo || p.replay != nil || p.scoresPath == "" { return }
+	SaveScore(p.scoresPath, Score{ Points: p.score, Level: p.level, Date: time.Now(), Name: p.playerName() })
+}
@@ -0,0 +1,187 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A supervisor runs a group of goroutines under one context; Stop
+// cancels it and waits until every one of them has returned. Each of
+// them defers crash, which is to recover their panics.
+type supervisor struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	crash    func()
+}
+
+func newSupervisor(parent context.Context, crash func()) *supervisor {
+	s := &supervisor{ crash: crash }
+	s.ctx, s.cancel = context.WithCancel(parent)
+	return s
+}
+
+func (s *supervisor) Go(f func(ctx context.Context)) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.crash()
+		f(s.ctx)
+	}()
+}
+
+func (s *supervisor) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// Play runs the game until the player quits: the title screen, then
+// rounds one after the other. The input, the screen and the signals
+// are handled by goroutines of the game session, each round adds its
+// own; all of them are stopped before Play returns, and so is the
+// sound bus, which plays outside the session. The error is what ended
+// the game, if not the player.
+func (p *Playground) Play() error {
+	defer p.session.crash()
+
+	p.openSounds()
+	p.session.Go(p.Events)
+	p.session.Go(p.JobControl)
+	p.session.Go(p.Render)
+	p.session.Go(p.ReadKeys)
+	defer p.closeSounds()
+	defer p.session.Stop()
+
+	if p.spectators != nil { defer p.spectators.end() }
+	if p.spectateListener != nil { p.session.Go(p.acceptSpectators) }
+
+	if p.listener != nil {
+		p.session.Go(p.acceptMates)
+		if !p.waitMate() { return p.Err() }
+	}
+
+	title := !p.SkipTitle()
+	for {
+		if title && p.TitleScreen() == MENU_QUIT { return p.Err() }
+
+		switch p.PlayRound() {
+			case FINISH_EXIT, FINISH_QUIT:
+				return p.Err()
+			case FINISH_TITLE:
+				title = true
+			case FINISH_RESTART:
+				p.Lock()
+				title = p.demo
+				p.Unlock()
+		}
+	}
+}
+
+// PlayRound plays a round in real time, handing it the keys, until it
+// ends; the round goroutine is stopped before it returns.
+func (p *Playground) PlayRound() int {
+	p.Lock()
+	switch {
+		case p.rival != nil:
+			p.seedRng(p.rival.seed + int64(p.rounds), 0)
+		case p.rounds > 0:
+			p.seedRng(time.Now().UTC().UnixNano(), 0)
+	}
+	p.rounds++
+	p.log.Info("round", "round", p.rounds, "seed", p.seed, "difficulty", p.Difficulty().Name,
+	           "rows", p.termRow, "cols", p.termCol, "demo", p.demo, "replay", p.replay != nil)
+	p.beginRound()
+	if p.saved != nil { p.resumeRound() }
+	var err error
+	if p.opts.Record != "" { err = p.startRecording() }
+	p.Unlock()
+	if err != nil {
+		p.end(err)
+		return FINISH_QUIT
+	}
+
+	var (
+		round    = newSupervisor(p.session.ctx, p.session.crash)
+		finished = make(chan int, 1)
+		finish   = FINISH_NONE
+	)
+	run := p.Run
+	if p.replay != nil { run = p.runReplay }
+	round.Go(func(ctx context.Context) { finished <- run(ctx) })
+
+	for finish == FINISH_NONE {
+		select {
+			case finish = <- finished:
+			case k, ok := <- p.keys:
+				finish = FINISH_QUIT
+				if ok { finish = p.roundKey(k) }
+			case <- p.session.ctx.Done():
+				finish = FINISH_QUIT
+		}
+	}
+	round.Stop()
+
+	p.Lock()
+	p.endRound()
+	p.Unlock()
+	return finish
+}
+
+// roundKey hands a key to the round, which takes it at the next tick;
+// quitting does not wait, though it saves the round when asked to, the
+// debug overlay is not part of the game, any other key ends the demo
+// and controls the replay viewer.
+func (p *Playground) roundKey(k byte) int {
+	p.Lock()
+	defer p.Unlock()
+
+	switch {
+		case k == p.keymap.Quit:
+			p.quitRound()
+			return FINISH_QUIT
+		case k == p.keymap.Debug:
+			p.toggleDebug()
+		case p.demo:
+			return FINISH_TITLE
+		case p.replay != nil:
+			p.viewKey(k)
+		default:
+			p.Press(k)
+	}
+	return FINISH_NONE
+}
+
+// end stops the game from any goroutine, err being what Play is to
+// return; only the first error is kept.
+func (p *Playground) end(err error) {
+	p.Lock()
+	if p.err == nil { p.err = err }
+	p.Unlock()
+	p.session.cancel()
+}
+
+func (p *Playground) Err() error {
+	p.Lock()
+	defer p.Unlock()
+	return p.err
+}
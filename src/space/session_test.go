@@ -0,0 +1,101 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+import (
+	"io"
+	"runtime"
+	"testing"
+	"time"
+)
+
+const PLAY_TIMEOUT = 5 * time.Second
+
+// play starts Play on a headless playground, straight into a round,
+// with the returned writer as keyboard.
+func play(t *testing.T) (*Playground, io.Writer, <-chan int) {
+	t.Helper()
+
+	p := NewHeadless(35, 100, 1, "NORMAL")
+	p.opts.NoTitle = true
+	in, keys := io.Pipe()
+	p.in = in
+
+	code := make(chan int, 1)
+	go func() { code <- ExitCode(p.Play()) }()
+	t.Cleanup(func() { keys.Close() })
+	return p, keys, code
+}
+
+func waitExit(t *testing.T, code <-chan int) int {
+	t.Helper()
+	select {
+		case c := <- code:
+			return c
+		case <- time.After(PLAY_TIMEOUT):
+			t.Fatal("Play did not return")
+	}
+	return -1
+}
+
+// waitRounds polls until the game is in its n-th round.
+func waitRounds(t *testing.T, p *Playground, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(PLAY_TIMEOUT); ; time.Sleep(TICK) {
+		p.Lock()
+		rounds, playing := p.rounds, p.playing
+		p.Unlock()
+		if rounds == n && playing { return }
+		if time.Now().After(deadline) { t.Fatalf("%d rounds played, waiting for %d", rounds, n) }
+	}
+}
+
+// Restarting starts a new round in the same process, and quitting
+// stops every goroutine of the game before Play returns.
+func TestPlayRestartQuit(t *testing.T) {
+	before := runtime.NumGoroutine()
+	p, keys, code := play(t)
+
+	waitRounds(t, p, 1)
+	keys.Write([]byte("aar"))
+	waitRounds(t, p, 2)
+	fresh := NewHeadless(35, 100, 1, "NORMAL")
+	p.Lock()
+	if p.curCol != fresh.curCol || p.score != 0 || p.shield != STD_SHIELD_LEV || p.stop { t.Error("the new round does not start from scratch") }
+	p.Unlock()
+
+	keys.Write([]byte("q"))
+	if c := waitExit(t, code); c != NO_ERROR { t.Errorf("exit code %d, want %d", c, NO_ERROR) }
+
+	for deadline := time.Now().Add(PLAY_TIMEOUT); runtime.NumGoroutine() > before; time.Sleep(TICK) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left running, %d before Play", runtime.NumGoroutine(), before)
+		}
+	}
+}
+
+// A signal ends the game from its own goroutine, with its exit code.
+func TestPlayQuitFromSignal(t *testing.T) {
+	p, _, code := play(t)
+
+	waitRounds(t, p, 1)
+	p.end(errorf(SIGNAL_EXIT + 15, "terminated"))
+	if c := waitExit(t, code); c != SIGNAL_EXIT + 15 { t.Errorf("exit code %d, want %d", c, SIGNAL_EXIT + 15) }
+}
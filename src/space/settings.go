@@ -0,0 +1,207 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+import (
+	"fmt"
+	"strings"
+
+	"sound"
+)
+
+const (
+	SETTINGS_ROW    = MENU_LOGO_ROW + 2
+	SETTINGS_GAP    = 1
+	BIND_PROMPT     = "Press the new key for %s, ESC to cancel"
+)
+
+// A setting is one line of the settings screen: its current value and
+// how left/right change it. value and change are called with the lock
+// held; a key binding has bind instead, which waits for the new key
+// and takes the lock itself.
+type setting struct {
+	name   string
+	value  func(p *Playground) string
+	change func(p *Playground, direction int)
+	bind   func(p *Playground)
+}
+
+var settings = []setting{
+	{ "DIFFICULTY",
+	  func(p *Playground) string { return p.Difficulty().Name },
+	  func(p *Playground, direction int) { p.cycleDifficulty(direction) },
+	  nil },
+	{ "THEME",
+	  func(p *Playground) string { return Themes[p.theme].Name },
+	  func(p *Playground, direction int) { p.theme = (p.theme + len(Themes) + direction) % len(Themes) },
+	  nil },
+	{ "SOUND",
+	  func(p *Playground) string { return onOff(p.sound) },
+	  func(p *Playground, direction int) { p.sound = !p.sound },
+	  nil },
+	{ "FRAME RATE",
+	  func(p *Playground) string { return fmt.Sprintf("%d FPS", p.fps) },
+	  func(p *Playground, direction int) { p.cycleFrameRate(direction) },
+	  nil },
+}
+
+func init() {
+	for e := range sound.EventNames {
+		event := sound.Event(e)
+		settings = append(settings, setting{
+			"SOUND " + strings.ToUpper(strings.Replace(event.String(), "-", " ", -1)),
+			func(p *Playground) string { return strings.ToUpper(p.soundRoutes[event]) },
+			func(p *Playground, direction int) { p.cycleSoundBackend(event, direction) },
+			nil,
+		})
+	}
+	for i := range keyActions {
+		action := keyActions[i]
+		settings = append(settings, setting{
+			"KEY " + strings.ToUpper(action.label),
+			func(p *Playground) string { return keyName(*action.key(&p.keymap)) },
+			nil,
+			func(p *Playground) { p.bindKey(action.key(&p.keymap), action.label) },
+		})
+	}
+}
+
+// settingsScreen edits the settings in place, so that they apply at
+// once, and saves the ones changed to the config file when the player
+// leaves; a remote game has none.
+func (p *Playground) settingsScreen() {
+	p.Lock()
+	before := p.currentConfig()
+	p.Unlock()
+
+	selected := 0
+	for {
+		p.drawSettings(selected, "")
+
+		switch p.menuKey(MENU_IDLE) {
+			case KEY_NONE, KEY_BACK:
+				if err := p.saveSettings(before); err != nil {
+					p.showPage("SETTINGS", []string{ "Cannot save the settings: " + err.Error() })
+				}
+				return
+			case KEY_UP:
+				selected = (selected + len(settings) - 1) % len(settings)
+			case KEY_DOWN:
+				selected = (selected + 1) % len(settings)
+			case KEY_LEFT:
+				p.changeSetting(settings[selected], DIR_LEFT)
+			case KEY_RIGHT, KEY_ENTER:
+				p.changeSetting(settings[selected], DIR_RIGHT)
+		}
+	}
+}
+
+// saveSettings writes the settings changed since before to the config
+// file, over what the file has: the others, among them the flags of
+// this run, are left as they are there. Nothing is written when
+// nothing changed.
+func (p *Playground) saveSettings(before Config) error {
+	p.Lock()
+	after := p.currentConfig()
+	p.Unlock()
+	if p.configPath == "" || after == before { return nil }
+
+	config, err := LoadConfig(p.configPath)
+	if err != nil { return err }
+	config.edit(before, after)
+	return config.Save(p.configPath)
+}
+
+func (p *Playground) changeSetting(s setting, direction int) {
+	if s.bind != nil {
+		s.bind(p)
+		return
+	}
+	p.Lock()
+	s.change(p, direction)
+	p.dirty = true
+	p.Unlock()
+}
+
+func (p *Playground) drawSettings(selected int, footer string) {
+	if footer == "" { footer = MENU_FOOTER }
+
+	p.Lock()
+	p.clearScreen()
+
+	p.putCentered(MENU_LOGO_ROW, "SETTINGS")
+	for i, s := range settings {
+		p.putMenuItem(SETTINGS_ROW + i * SETTINGS_GAP,
+		              fmt.Sprintf("%-16s < %-8s >", s.name, s.value(p)), i == selected)
+	}
+
+	p.putCentered(p.termRow - HUD_ROWS - 1, footer)
+	p.refreshScreenUnlock(0)
+}
+
+// bindKey waits for a key and binds it to the action; when the key
+// already belongs to another action the two are swapped.
+func (p *Playground) bindKey(key *byte, label string) {
+	for i := range settings {
+		if strings.HasSuffix(settings[i].name, strings.ToUpper(label)) {
+			p.drawSettings(i, fmt.Sprintf(BIND_PROMPT, label))
+		}
+	}
+
+	var k byte
+	select {
+		case key, ok := <- p.keys:
+			if !ok { return }
+			k = key
+		case <- p.session.ctx.Done():
+			return
+	}
+	if _, err := parseKey(keyName(k)); err != nil { return }
+
+	p.Lock()
+	defer p.Unlock()
+	for _, action := range keyActions {
+		if other := action.key(&p.keymap); other != key && *other == k { *other = *key }
+	}
+	*key = k
+}
+
+func (p *Playground) cycleSoundBackend(e sound.Event, direction int) {
+	current := 0
+	for i, name := range sound.BackendNames {
+		if name == p.soundRoutes[e] { current = i }
+	}
+	names := len(sound.BackendNames)
+	p.soundRoutes[e] = sound.BackendNames[(current + names + direction) % names]
+	p.routeSounds()
+}
+
+func (p *Playground) cycleFrameRate(direction int) {
+	current := 0
+	for i, fps := range FrameRates {
+		if fps <= p.fps { current = i }
+	}
+	p.fps = FrameRates[(current + len(FrameRates) + direction) % len(FrameRates)]
+}
+
+func onOff(flag bool) string {
+	if flag { return "ON" }
+	return "OFF"
+}
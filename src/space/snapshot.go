@@ -0,0 +1,151 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package space
+
+import (
+	"math/rand"
+)
+
+// A countedSource is the source of the random numbers of a round; it
+// counts what it gave, so that the same numbers can be taken up again
+// from its seed.
+type countedSource struct {
+	rand.Source64
+	draws   uint64
+}
+
+func (s *countedSource) Int63() int64 {
+	s.draws++
+	return s.Source64.Int63()
+}
+
+func (s *countedSource) Uint64() uint64 {
+	s.draws++
+	return s.Source64.Uint64()
+}
+
+// seedRng starts the random numbers of the round from seed, after the
+// first draws of them.
+func (p *Playground) seedRng(seed int64, draws uint64) {
+	p.seed      = seed
+	p.rngSource = &countedSource{ Source64: rand.NewSource(seed).(rand.Source64) }
+	for i := uint64(0); i < draws; i++ {
+		p.rngSource.Uint64()
+	}
+	p.rng = rand.New(p.rngSource)
+}
+
+// A snapshot is the state of a round at a tick, all that the ticks to
+// come depend on: taken up again, the round goes on as if it never
+// stopped.
+type snapshot struct {
+	seed                       int64
+	draws                      uint64
+	ticks                      int64
+	screen                     [][]rune
+	curCol, score, hiScore     int
+	shield, level, lives       int
+	weapon                     string
+	enemy                      *enemy
+	wave                       wave
+	missiles                   []missile
+	enemyMissiles              []enemyMissile
+	explosions, reload         int
+	mateShot                   bool
+	diedAt                     int64
+	cause                      string
+	stop, start, awaitRestart  bool
+	finish, endFrame           int
+	finishAt, endNext          int64
+	replayPos                  int
+	input                      []byte
+}
+
+// snapshot takes the state of the round. The caller must hold the lock.
+func (p *Playground) snapshot() snapshot {
+	s := snapshot{
+		seed:          p.seed,
+		draws:         p.rngSource.draws,
+		ticks:         p.ticks,
+		screen:        make([][]rune, len(p.screen)),
+		curCol:        p.curCol,
+		score:         p.score,
+		hiScore:       p.hiScore,
+		shield:        p.shield,
+		level:         p.level,
+		lives:         p.lives,
+		weapon:        p.weapon,
+		wave:          p.wave,
+		missiles:      append([]missile(nil), p.missiles...),
+		enemyMissiles: append([]enemyMissile(nil), p.enemyMissiles...),
+		explosions:    p.explosions,
+		reload:        p.reload,
+		mateShot:      p.mateShot,
+		diedAt:        p.diedAt,
+		cause:         p.cause,
+		stop:          p.stop,
+		start:         p.start,
+		awaitRestart:  p.awaitRestart,
+		finish:        p.finish,
+		endFrame:      p.endFrame,
+		finishAt:      p.finishAt,
+		endNext:       p.endNext,
+		replayPos:     p.replayPos,
+		input:         append([]byte(nil), p.input...),
+	}
+	for i := range p.screen {
+		s.screen[i] = append([]rune(nil), p.screen[i]...)
+	}
+	if p.enemy != nil {
+		e := *p.enemy
+		s.enemy = &e
+	}
+	return s
+}
+
+// restore takes the round back to the snapshot s, of a screen of the
+// same size. The caller must hold the lock.
+func (p *Playground) restore(s snapshot) {
+	p.seedRng(s.seed, s.draws)
+	p.ticks                          = s.ticks
+	p.curCol, p.score, p.hiScore     = s.curCol, s.score, s.hiScore
+	p.shield, p.level, p.lives       = s.shield, s.level, s.lives
+	p.weapon                         = s.weapon
+	p.wave                           = s.wave
+	p.missiles                       = append([]missile(nil), s.missiles...)
+	p.enemyMissiles                  = append([]enemyMissile(nil), s.enemyMissiles...)
+	p.explosions, p.reload           = s.explosions, s.reload
+	p.mateShot, p.diedAt, p.cause    = s.mateShot, s.diedAt, s.cause
+	p.stop, p.start, p.awaitRestart  = s.stop, s.start, s.awaitRestart
+	p.finish, p.endFrame             = s.finish, s.endFrame
+	p.finishAt, p.endNext            = s.finishAt, s.endNext
+	p.replayPos                      = s.replayPos
+	p.input                          = append([]byte(nil), s.input...)
+	for i := range p.screen {
+		copy(p.screen[i], s.screen[i])
+	}
+	p.enemy = nil
+	if s.enemy != nil {
+		e := *s.enemy
+		p.enemy = &e
+	}
+	p.dirty = true
+}
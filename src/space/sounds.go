@@ -0,0 +1,83 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+import (
+
+	"sound"
+)
+
+// openSounds starts the sound bus of the game, for as long as it plays;
+// closeSounds stops it.
+func (p *Playground) openSounds() {
+	p.Lock()
+	defer p.Unlock()
+	p.sounds = sound.NewBus()
+	p.routeSounds()
+}
+
+// routeSounds connects every event to the backend chosen for it, once
+// the bus is started. The PCM player is started the first time an event
+// is routed to it; if it cannot start, those events stay silent.
+func (p *Playground) routeSounds() {
+	if p.sounds == nil { return }
+
+	for e, name := range p.soundRoutes {
+		var backend sound.Backend = sound.Silent{}
+		switch name {
+			case sound.BACKEND_BELL:
+				backend = sound.Bell{ Out: p.out }
+			case sound.BACKEND_PCM:
+				if pcm := p.pcmBackend(); pcm != nil { backend = pcm }
+		}
+		p.sounds.Route(sound.Event(e), backend)
+	}
+}
+
+func (p *Playground) pcmBackend() *sound.PCM {
+	if p.pcm != nil || p.pcmFailed { return p.pcm }
+
+	var err error
+	if p.soundFile != "" {
+		p.pcm, err = sound.CreatePCM(p.soundFile)
+	} else {
+		p.pcm, err = sound.StartPCM(p.soundCmd)
+	}
+	p.pcmFailed = err != nil
+	return p.pcm
+}
+
+// play posts a sound event unless the sound is switched off.
+func (p *Playground) play(e sound.Event) {
+	if p.sound && p.sounds != nil { p.sounds.Emit(e) }
+}
+
+// closeSounds stops the bus, once the events queued are played, and the
+// PCM player. Nothing is played after it: the events of the rounds are
+// posted with the lock held, and find no bus.
+func (p *Playground) closeSounds() {
+	p.Lock()
+	bus, pcm := p.sounds, p.pcm
+	p.sounds, p.pcm = nil, nil
+	p.Unlock()
+
+	if bus != nil { bus.Close() }
+	if pcm != nil { pcm.Close() }
+}
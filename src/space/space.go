@@ -20,22 +20,28 @@
 package space
 
 import (
+	 "context"
          "fmt"
     	 "time"
+	 "io"
+	 "log/slog"
 	 "math/rand"
+	 "net"
 	 "os"
-	 "os/exec"
 	 "os/signal"
 	 "syscall"
-	 "unsafe"
 	 "sync"
-	 "strconv"
-	 "strings"
+	 "sync/atomic"
+
+	 "sound"
+	 "terminal"
 )
 
 const (
        MIN_ROWS        = 30
        MIN_COLS        = 70
+       MAX_ROWS        = 1000
+       MAX_COLS        = 1000
        SPRITE_BEGIN    = 7
        SPRITE_END      = 4
        STD_BOSS_POINTS = 100
@@ -43,6 +49,8 @@ const (
        STD_ENEM_POINT  = 10
        STD_SHIELD_LEV  = 3
        STD_SHIELD_EXP  = -1
+       STD_LIVES       = 1
+       STD_WEAPON      = "MISSILE"
        STD_JUMP_LEN    = 10
        STD_ENEMY_GROUP = 10
        STD_DEST_REWARD = 10
@@ -61,10 +69,13 @@ const (
        NO_ERROR        = 0
        RUNTIME_ERROR   = 1
        DIMS_ERROR      = 2
-       SCORE_OFFSET    = 9
-       SCORE_TXT_OFFST = 14
-       SCORE_IST_OFFST = 26
-       SHIELD_OFFST    = 18
+       CONFIG_ERROR    = 3
+       USAGE_ERROR     = 4
+       TERM_ERROR      = 5
+       FILE_ERROR      = 6
+       NET_ERROR       = 7
+       VERIFY_ERROR    = 8
+       SIGNAL_EXIT     = 128
        INFO_OFFST      = 3
        MSG_OFFSET      = 9
        MAX_SCORE_LEN   = 8
@@ -81,644 +92,380 @@ const (
        ROW_LOW_LIMIT   = 11
        ROW_START_LIMIT = 9
        COL_START_LIMIT = 6
-       GET_TERMIOS     = syscall.TCGETS
-       SET_TERMIOS     = syscall.TCSETS
-       SOURCE_NAME     = "src/main/main.go"
-       BINARY_NAME     = "a.out"
-       COMPILER_NAME   = "go"
-       RUN_PARAMETER   = "run"
        TERMINAL_DEV    = "/dev/tty"
+       VERSION         = "1.1-beta"
+       KEYS_BUFFER     = 16
        SPACE_CHARAC    = '\U00000020'
-       BELL_SOUND      = '\U00000007'
+       SUSPEND_CHARAC  = 0x1A
 )
 
-type winsize struct {
-    ws_row, ws_col                uint16
-    ws_xpixel, ws_ypixel          uint16
-}
-
-type Termios struct {
-	Iflag, Oflag, Cflag, 
-	Lflag, Ispeed, Ospeed     uint32
-	Cc                        [20]byte
-}
-
+// Playground is a game and the screen it is drawn on. The mutex guards
+// every field that changes once the goroutines of play are started:
+// the round, the screen and the settings alike. The channels are safe
+// by themselves, halted is atomic, termMu serializes the terminal mode
+// changes, and the rest is set by InitPlayground before anything runs.
 type Playground struct{
 	sync.Mutex
 
-	wgConfirm                 sync.WaitGroup
+	termMu                    sync.Mutex
 
-	exploded,    critical     chan bool
+	out                       io.Writer
 
-	intSignal, winchSignal    chan os.Signal
+	in                        io.Reader
 
-	stop, start               bool
+	session                   *supervisor
 
-	termRow,       termCol,
-	centTrmRow, centTrmCol, 
-        curCol, score, shield     int 
+	intSignal, winchSignal    chan os.Signal
 
-	screen, sprite            [][]rune
+	termSignal, stopSignal,
+	contSignal                chan os.Signal
 
-	args                      []string
+	stop, start,
+	playing, demo, sound,
+	dirty, debug              bool
 
-	oldTerm, newTerm          Termios
-}
+	halted                    atomic.Bool
 
-func (p *Playground) InitPlayground(){
-	p.start       = false
-	p.intSignal   = make(chan os.Signal, 1)
-	p.winchSignal = make(chan os.Signal, 1)
-	p.exploded    = make(chan bool, 1)
-	p.critical    = make(chan bool, 1)
+	keys                      chan byte
 
-	signal.Notify(p.intSignal,   syscall.SIGINT)
-	signal.Notify(p.winchSignal, syscall.SIGWINCH)
+	resized                   chan struct{}
 
-	rand.Seed(time.Now().UTC().UnixNano())
-	p.getTermDims()
+	termRow,       termCol,
+	centTrmRow, centTrmCol, 
+        curCol, score, shield,
+	hiScore, level, lives,
+	difficulty, theme, fps,
+	rounds                    int 
 
-	p.centTrmRow = p.termRow / 2 
-	p.centTrmCol = p.termCol / 2
-        p.curCol       = p.termCol / 2
-	p.score        = 0
-	p.shield       = STD_SHIELD_LEV
-	var spriteData = [SPRITE_ROWS][SPRITE_COLS]rune {
-	    { '\U00000020','\U00000020','\U00000020','\U00000020','\U00002554','\U00002550','\U0000256C','\U00002550','\U00002557','\U00000020','\U00000020','\U00000020','\U00000020'}, 
-	    { '\U00000020','\U00000020','\U00000020','\U00000020','\U00002560','\U00002550','\U00002569','\U00002550','\U00002563','\U00000020','\U00000020','\U00000020','\U00000020'}, 
-	    { '\U00000020','\U00000020','\U00002554','\U00002550','\U00002569','\U00002550','\U00002550','\U00002550','\U00002569','\U00002550','\U00002557','\U00000020','\U00000020'}, 
-	    { '\U0000255A','\U00002550','\U00002569','\U00002550','\U00002550','\U00002550','\U00002550','\U00002550','\U00002550','\U00002550','\U00002569','\U00002550','\U0000255D'}}
+	keymap                    KeyMap
 
-	p.args = os.Args
+	weapon, scoresPath,
+	configPath                string
 
-	p.screen = make([][]rune, p.termRow)
-	p.sprite = make([][]rune, SPRITE_ROWS)
+	ticks                     int64
 
-	for i := range p.screen[:] {
-		p.screen[i] = make([]rune, p.termCol)
-	}
+	input                     []byte
 
-	for i := range spriteData[:] {
-		p.sprite[i] = make([]rune, SPRITE_COLS)
-		copy(p.sprite[i][:] , spriteData[i][:])
-	}
-}
+	inputs                    []input
 
-func (p *Playground) InitScreen(){
-	defer p.safeExitPanic("InitScreen")
+	err                       error
 
-	for i := range p.screen[:] {
-		for j:= range p.screen[i]{
-			p.screen[i][j] = '\U00000020'
-		}
-	}
+	enemy                     *enemy
 
-	for i := range p.screen {
-		fmt.Fprintf(os.Stderr, string(p.screen[i]))
-	}
+	wave                      wave
 
-	var textRight = []rune {'\U00000053','\U00000048','\U00000049','\U00000045','\U0000004C','\U00000044','\U0000003A','\U00000020','\U00000033','\U00000020','\U00000053','\U00000043','\U0000004F','\U00000052', '\U00000045','\U0000003A','\U00000020','\U00000030'}
+	missiles                  []missile
 
-	copy(p.screen[p.termRow-1][(p.termCol - SCORE_IST_OFFST):] , textRight[:])
-	
-	var textLeft = []rune {'\U0000004D','\U0000006F','\U00000076','\U00000065','\U0000003A','\U00000020','\U00000061','\U0000002C','\U00000073','\U00000020','\U0000004A','\U00000075','\U0000006D','\U00000070','\U0000003A','\U00000020','\U0000007A','\U0000002C','\U00000078','\U00000020','\U00000046','\U00000069','\U00000072','\U00000065','\U0000003A','\U00000020','\U00000073','\U00000070','\U00000061','\U00000063','\U00000065','\U00000020','\U00000051','\U00000075','\U00000069','\U00000074','\U0000003A','\U00000020','\U00000071','\U00000020','\U00000020','\U0000004E','\U00000065','\U00000077','\U0000003A','\U00000020','\U00000072'}
+	enemyMissiles             []enemyMissile
 
-	copy(p.screen[p.termRow-1][1:], textLeft[:])
-}
+	explosions                int
 
-func (p *Playground) getTermDims(){
+	mateShot                  bool
 
-        winSize := winsize{}
-	_, _, execErr := syscall.Syscall(syscall.SYS_IOCTL,
-			                 uintptr(0), uintptr(syscall.TIOCGWINSZ),
-			                 uintptr(unsafe.Pointer(&winSize)))
-	if execErr != 0 { panic("IOCTL Error") }
+	diedAt                    int64
 
-	p.termCol = int(winSize.ws_col)
-	p.termRow = int(winSize.ws_row)
+	cause                     string
 
-	if p.termRow < MIN_ROWS || p.termCol < MIN_COLS{
-		p.CanonicMode()
-		fmt.Fprintf(os.Stderr,"Terminal size too small: please increase the window dimensions\n")
-		os.Exit(DIMS_ERROR)
-	}
-}
+	endFrame                  int
 
-func (p *Playground) DeployEnemies(enemies int){
-	for !p.stop{
-		p.deployInvasors(enemies)
-		p.deployBoss()
-	}
-}
+	endNext, finishAt         int64
 
-func (p *Playground) deployEnemyMissile(col,row int, wg *sync.WaitGroup){
-	defer p.safeExitPanic("deployEnemyMissile")
+	finish                    int
 
-	var (
-	    lines = [EN_MISS_SEQ_LEN]rune {'\U00000044', '\U0000002A', '\U0000002E', SPACE_CHARAC} 
+	awaitRestart              bool
 
-	    coladj int = col + EN_MISS_ADJ
-	    rowadj int = row + INFO_OFFST
-	    end    int = p.termRow - SPRITE_END
-	    begin  int = p.termRow - SPRITE_BEGIN - 1
-	)
+	replayPos                 int
 
-	for(rowadj < end && p.screen[rowadj + 1][coladj] == lines[3]){
-		wg.Wait()
-		if p.start { goto exit }
-		rowadj++
-		p.Lock()
+	reload                    int
 
-		p.screen[rowadj][coladj]   = lines[0]
-		p.screen[rowadj-1][coladj] = lines[3]
+	screen, sprite            [][]rune
 
-		p.refreshScreenUnlock(TIMER_LEVEL_B)
-	}
+	opts                      Options
 
-	wg.Wait()
+	caps                      *termCaps
 
-	if rowadj >= begin  && rowadj < end {
-		p.changeShield(-1)
-		if p.shield == STD_SHIELD_EXP { p.critical <- true }
-	}
+	seed                      int64
 
-	fmt.Printf("%c",BELL_SOUND)
-	for i:=1; i< EN_MISS_SEQ_LEN; i++{
-		p.Lock() 
-		p.screen[rowadj][coladj]     = lines[i]
-		p.refreshScreenUnlock(TIMER_LEVEL_A)
-	}
+	rng                       *rand.Rand
 
-	exit:
-}
+	rngSource                 *countedSource
 
-func (p *Playground) changeShield(level int){
-	if level < STD_SHIELD_LEV { 
-		p.shield += level
-	}else{
-		p.shield = STD_SHIELD_LEV
-	}
-	thisShield := strconv.Itoa(p.shield)
-	for i:=0; i<len(thisShield); i++{
-		p.screen[p.termRow-1][p.termCol - SHIELD_OFFST + i] = rune (thisShield[i]) 
-	}
-}
+	replay                    *Replay
 
-func (p *Playground) changeScore(points int){
-	p.score += points
-	thisScore := strconv.Itoa(p.score)
-	if( len(thisScore) <= MAX_SCORE_LEN){
-		for i:=0; i<len(thisScore); i++{
-			p.screen[p.termRow-1][p.termCol - (SCORE_OFFSET - i)] = rune (thisScore[i])
-		}
-	}
-}
+	viewer                    *viewer
 
-func (p *Playground) deployInvasors(enemies int){
-	defer p.safeExitPanic("deployInvasors")
+	saved                     *Save
 
-	var (
-	    x int = p.centTrmCol
-	    y int = 1
-
-            //   ╔═╦═╗   *═*═*   *.*.*
-            //   ╠═╬═╣   ╠*╬*╣   .*╬*.    *.* 
-            //   ╝   ╚   * * *   * * *     *           
-
-	    invasor = [INVASOR_ROWS][INVASOR_COLS]rune {
-				 {'\U00002554','\U00002550','\U00002566','\U00002550','\U00002557'}, 
-				 {'\U00002560','\U00002550','\U0000256B','\U00002550','\U00002563'}, 
-				 {'\U0000255D','\U00000020','\U00000020','\U00000020','\U0000255A'}}
-
-	    invasorDestr = [DESTR_SEQUENCE][INVASOR_ROWS][INVASOR_COLS]rune {
-				 {{ '\U0000002A','\U00002550','\U0000002A','\U00002550','\U0000002A'},
-				  { '\U00002560','\U0000002A','\U0000256B','\U0000002A','\U00002563'},
-				  { '\U0000002A','\U00000020','\U0000002A','\U00000020','\U0000002A'}},
-				 {{ '\U0000002A','\U0000002E','\U0000002A','\U0000002E','\U0000002A'}, 
-				  { '\U0000002E','\U0000002A','\U0000256B','\U0000002A','\U0000002E'},
-				  { '\U0000002A','\U00000020','\U0000002A','\U00000020','\U0000002A'}},
-				 {{ '\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'},
-				  { '\U00000020','\U0000002A','\U0000002E','\U0000002A','\U00000020'},
-				  { '\U00000020','\U00000020','\U0000002A','\U00000020','\U00000020'}}} 
-
-	    bline = []rune( "\U00000020\U00000020\U00000020\U00000020\U00000020") 
-
-	    destroyed int = 0
-	)
+	record                    *os.File
 
-	var wg sync.WaitGroup
-	for enemy := 0; enemy< enemies; enemy++  {
-		var (
-		    shoot1 int = rand.Intn(p.termRow - RND_ENEM_ADJ )
-		    shoot2 int = shoot1 + RND_ENEM_ADJ_SC
-		)
+	sounds                    *sound.Bus
 
-		for( p.screen[y+2][x] == p.screen[y+2][x+1]   && 
-		     p.screen[y+2][x+2] == p.screen[y+2][x+3] &&
-		     p.screen[y+2][x+3] == p.screen[y+2][x+4]){
-				if p.start { goto exit }
+	pcm                       *sound.PCM
 
-				wg.Add(1)
-				p.Lock()
+	pcmFailed                 bool
 
-				copy(p.screen[y-1][x:] , bline[:])
-				for i:=0; i<3 ; i++{ 
-					copy(p.screen[y+i][x:] , invasor[i][:]) 
-				}
-				p.refreshScreenUnlock(0)
-
-				y++
-				if( y == shoot1 || y == shoot2){ go p.deployEnemyMissile(x, y,  &wg)}
-				wg.Done()
-
-				if( y == (p.termRow - SPRITE_END) ){ break }
-
-				time.Sleep(TIMER_LEVEL_C)
-			}
-
-			switch{
-				case (y < (p.termRow - SPRITE_BEGIN - INFO_OFFST) ):
-					<- p.exploded 
-					destroyed++
-
-					p.Lock()
-
-					if( p.shield < STD_SHIELD_LEV && destroyed == STD_DEST_REWARD ){
-						destroyed = 0
-						p.changeShield(1)
-					}
-					p.Unlock()
-
-					fmt.Printf("%c%c",BELL_SOUND, BELL_SOUND)
-					copy(p.screen[y-1][x:] , bline[:])
-					for h:= range invasorDestr[:]{
-						p.Lock()
-						for i:=0; i<3; i++{
-							copy(p.screen[y+i][x:] , invasorDestr[h][i][:])
-						}
-						p.refreshScreenUnlock(TIMER_LEVEL_A)
-					}
-
-					p.Lock()
-					for i:=0; i<3; i++{
-						copy(p.screen[y+i][x:] , bline[:])
-					}
-
-					p.changeScore(STD_ENEM_POINT)
-					p.refreshScreenUnlock(0)
-
-				case ( y == (p.termRow - SPRITE_END) ):
-					p.Lock()
-					
-					for i:=-1; i<2; i++{
-						copy(p.screen[y+1][x:] , bline[:])
-					}
-					p.refreshScreenUnlock(0)
-
-					p.critical <- true
-				default:
-					p.Lock()
-
-					fmt.Printf("%c%c",BELL_SOUND, BELL_SOUND)
-					copy(p.screen[y-1][x:] , bline[:])
-					p.Unlock()
-
-					for h:= range invasorDestr[:]{
-						p.Lock()
-						for i:=0; i<3; i++{
-							copy(p.screen[y+i][x:] , invasorDestr[h][i][:])
-						}
-						p.refreshScreenUnlock(TIMER_LEVEL_A)
-					}
-
-					p.Lock()
-					for i:=0; i<3; i++{
-						copy(p.screen[y+i][x:] , bline[:])
-					}
-					p.refreshScreenUnlock(0)
-
-					p.critical <- true 
-			}
-
-			y = 1
-			x = RND_CORR + rand.Intn(p.termCol - RND_COL_ADJ)
-	}
-	exit:
-}
+	soundRoutes               [sound.NUM_EVENTS]string
 
-func (p *Playground) deployBoss(){
-	defer p.safeExitPanic("deployBoss")
+	soundCmd, soundFile       string
 
-	// ┏━━━━━━┓    *━*━━*━*   * *  * *
-	// ┃彡ﾐ   ┃   ┃彡ﾐ   ┃    彡ﾐ        彡ﾐ     
-	// ┃ᒡ◯ᵔ┃◯ᒡ┃   *ᒡ +┃ +*    * +  + *    *  *  
-	// ┃┃  _┃ ┃   ┃┃  _┃ ┃     ┃   ┃     *   *  
-	// ┃ \__/ ┃   * \__/ *    * \__/ *    * *   
-	// ╚═╖══╖═╗   *═╖══╖═*    * ╖══╖ *    * *   
-	//   ╬══╬       ╬══╬  
-	//   ╝  ╚       *  *        ****  
+	term                      *terminal.Terminal
 
-	var (
-	    boss = [BOSS_ROWS][BOSS_COLS]rune  {
-	    {'\U0000256D','\U00000020','\U00002501','\U00002501','\U00002501','\U00002501','\U00000020','\U0000256E'},
-	    {'\U00002503','\U00000020','\U0000256F','\U0000256F','\U00002570','\U00002570','\U00000020','\U00002503'},
-	    {'\U00002503','\U000014A1','\U000025EF','\U00001D54','\U00002503','\U000025EF','\U000014A1','\U00002503'},
-	    {'\U00002503','\U00002503','\U00000020','\U00000020','\U0000005F','\U00002503','\U00000020','\U00002503'},
-	    {'\U00002503','\U00000020','\U0000005C','\U0000005F','\U0000005F','\U0000002F','\U00000020','\U00002503'},
-	    {'\U0000255A','\U00002550','\U00002556','\U00002550','\U00002550','\U00002556','\U00002550','\U00002557'},
-	    {'\U00000020','\U00000020','\U0000256C','\U00002550','\U00002550','\U0000256C','\U00000020','\U00000020'},
-	    {'\U00000020','\U00000020','\U0000255D','\U00000020','\U00000020','\U0000255A','\U00000020','\U00000020'} }
-   
-	   bossDestruct = [DESTR_SEQUENCE][BOSS_ROWS][BOSS_COLS]rune  {
-	   {{'\U0000002A','\U00002501','\U0000002A','\U00002501','\U00002501','\U0000002A','\U00002501','\U0000002A'},
-	    {'\U00002503','\U00000020','\U0000256F','\U0000256F','\U00002570','\U00002570','\U00000020','\U00002503'},
-	    {'\U0000002A','\U00000020','\U0000002B','\U00000020','\U00002503','\U0000002B','\U00000020','\U0000002A'},
-	    {'\U00000020','\U00002503','\U00000020','\U00000020','\U0000002A','\U00002503','\U00000020','\U00000020'},
-	    {'\U0000002A','\U00000020','\U0000005C','\U0000005F','\U0000005F','\U0000002F','\U00000020','\U0000002A'},
-	    {'\U0000002A','\U00002550','\U00002556','\U00002550','\U00002550','\U00002556','\U00002550','\U0000002A'},
-	    {'\U00000020','\U00000020','\U0000002A','\U00002550','\U00002550','\U0000002A','\U00000020','\U00000020'},
-	    {'\U00000020','\U00000020','\U0000002A','\U00000020','\U00000020','\U0000002A','\U00000020','\U00000020'}},
-	   {{'\U0000002A','\U00000020','\U0000002A','\U00000020','\U00000020','\U0000002A','\U00000020','\U0000002A'},
-	    {'\U00002503','\U00000020','\U0000256F','\U0000256F','\U00002570','\U00002570','\U00000020','\U00002503'},
-	    {'\U0000002A','\U00000020','\U0000002B','\U00000020','\U00000020','\U0000002B','\U00000020','\U0000002A'},
-	    {'\U00000020','\U00002503','\U00000020','\U00000020','\U00000020','\U00002503','\U00000020','\U00000020'},
-	    {'\U0000002A','\U00000020','\U0000005C','\U0000005F','\U0000005F','\U0000002F','\U00000020','\U0000002A'},
-	    {'\U0000002A','\U00000020','\U00002556','\U00002550','\U00002550','\U00002556','\U00000020','\U0000002A'}, 
-	    {'\U00000020','\U00000020','\U0000002A','\U0000002A','\U0000002A','\U0000002A','\U00000020','\U00000020'},
-	    {'\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'}},
-	   {{'\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'},
-	    {'\U00002503','\U00000020','\U0000256F','\U0000256F','\U00002570','\U00002570','\U00000020','\U00002503'},
-	    {'\U00000020','\U00000020','\U0000002A','\U00000020','\U00000020','\U0000002A','\U00000020','\U00000020'},
-	    {'\U00000020','\U0000002A','\U00000020','\U0000002A','\U00000020','\U0000002A','\U00000020','\U00000020'},
-	    {'\U00000020','\U00000020','\U0000002A','\U00000020','\U0000002A','\U00000020','\U00000020','\U00000020'},
-	    {'\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'},
-	    {'\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'},
-	    {'\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'}}}
-   
-	   bline = [BOSS_COLS]rune {
-	    '\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'} 
-
-	   x int = RND_CORR + rand.Intn(p.termCol - RND_COL_ADJ)
-	   y int = 1
-	   damage int = 0
-	   shoot1 int = rand.Intn(p.termRow - RND_ROW_ADJ )
-	   shoot2 int = shoot1 + RND_ENEM_ADJ_SC
-        )
-
-	var wg sync.WaitGroup
-	for {
-		if p.stop { goto exit}
-		if(  p.screen[y+BOSS_ROWS][x]   != p.screen[y+BOSS_ROWS][x+1] || 
-		     p.screen[y+BOSS_ROWS][x+2] != p.screen[y+BOSS_ROWS][x+3] ||
-		     p.screen[y+BOSS_ROWS][x+3] != p.screen[y+BOSS_ROWS][x+4] ||
-		     p.screen[y+BOSS_ROWS][x+5] != p.screen[y+BOSS_ROWS][x+6]){
-				 damage++	
-				 if (damage == STD_BOSS_DAMAGE || y >= (p.termRow - SPRITE_COLS_GAP)){ break }
-		}
+	raw                       bool
 
-		wg.Add(1)
-		p.Lock()
+	stats                     debugStats
 
-		copy(p.screen[y-1][x:] , bline[:])
-		for i:=0; i<BOSS_ROWS; i++{
-			copy(p.screen[y+i][x:] , boss[i][:])
-		}
-		p.refreshScreenUnlock(0)
+	log                       *slog.Logger
+	logFile                   *os.File
 
-		y++
-		if( y == shoot1 || y == shoot2){
-			go p.deployEnemyMissile(x+1, y+4, &wg)
-			go p.deployEnemyMissile(x+2, y+4, &wg)
-			go p.deployEnemyMissile(x+3, y+4, &wg)
-		}
+	size                      func() (rows, cols int, err error)
+	remote                    bool
+	player                    string
 
-		wg.Done()
-		if( y == (p.termRow - ROW_LOW_LIMIT) ){ break }
+	listener                  net.Listener
+	mate                      *mate
+	joined                    chan struct{}
 
-		time.Sleep(TIMER_LEVEL_C)
+	rival                     *rival
 
-	}
-	switch{
-		case (y < (p.termRow - SPRITE_BEGIN - BOSS_ROWS) ):
-			<- p.exploded 
+	spectators                *Broadcast
+	spectateListener          net.Listener
+}
 
-			fmt.Printf("%c%c",BELL_SOUND, BELL_SOUND)
-			for h:= range bossDestruct[:]{
-				p.Lock()
-				for i:=0; i<BOSS_ROWS; i++{
-					copy(p.screen[y+i][x:] , bossDestruct[h][i][:])
-				}
-				p.refreshScreenUnlock(TIMER_LEVEL_A)
-			}
+// InitPlayground sets up the game for opts on the terminal of the
+// process; the error tells why it cannot be played there.
+func (p *Playground) InitPlayground(opts Options) error {
+	p.intSignal   = make(chan os.Signal, 1)
+	p.winchSignal = make(chan os.Signal, 1)
+	p.termSignal  = make(chan os.Signal, 1)
+	p.stopSignal  = make(chan os.Signal, 1)
+	p.contSignal  = make(chan os.Signal, 1)
+	p.session     = newSupervisor(context.Background(), p.recoverCrash)
+	p.out         = os.Stderr
+	p.size        = func() (int, int, error) { return terminal.GetSize(int(os.Stdin.Fd())) }
+	p.opts        = opts
+
+	if err := p.openLog(); err != nil { return err }
+	if err := p.setup(os.Getenv("TERM")); err != nil { return err }
+	if err := p.listen(opts.Host); err != nil { return err }
+	if err := p.listenSpectators(opts.Spectate); err != nil { return err }
 
-			p.Lock()
-			for i:=-1; i<BOSS_ROWS; i++{
-				copy(p.screen[y+i][x:] , bline[:])
-			}
+	signal.Notify(p.intSignal,   syscall.SIGINT)
+	signal.Notify(p.winchSignal, syscall.SIGWINCH)
+	signal.Notify(p.termSignal,  syscall.SIGTERM, syscall.SIGHUP)
+	signal.Notify(p.stopSignal,  syscall.SIGTSTP)
+	signal.Notify(p.contSignal,  syscall.SIGCONT)
+	return nil
+}
+
+// setup is the part of the set up that does not depend on where the
+// terminal is, of type term.
+func (p *Playground) setup(term string) error {
+	p.start       = false
+	p.keys        = make(chan byte, KEYS_BUFFER)
+	p.resized     = make(chan struct{}, 1)
+	p.scoresPath  = ScoresPath()
+	p.configPath  = p.opts.ConfigPath
+	p.replay      = p.opts.Replay
+	p.saved       = p.opts.Resume
+
+	if p.configPath == "" { p.configPath = ConfigPath() }
+	config, err := p.opts.Config()
+	if err != nil { return err }
+	p.ApplyConfig(config)
+	if err := p.termCaps(term); err != nil { return err }
+
+	p.seed = p.opts.Seed
+	if p.seed == 0 { p.seed = time.Now().UTC().UnixNano() }
+	if p.replay != nil {
+		p.seed = p.replay.Seed
+		p.SetDifficulty(p.replay.Difficulty)
+	}
+	if p.saved != nil {
+		p.seed = p.saved.state.seed
+		p.SetDifficulty(p.saved.Difficulty)
+	}
+	p.seedRng(p.seed, 0)
 
-			p.changeScore(STD_BOSS_POINTS)
-			p.changeShield(STD_SHIELD_LEV)
-			p.refreshScreenUnlock(0)
+	if err := p.getTermDims(); err != nil { return err }
+	p.log.Info("terminal", "term", term, "rows", p.termRow, "cols", p.termCol)
+	if p.replay != nil && (p.replay.Rows != p.termRow || p.replay.Cols != p.termCol) {
+		return errorf(DIMS_ERROR, "the replay needs a %dx%d terminal, this one is %dx%d",
+		              p.replay.Cols, p.replay.Rows, p.termCol, p.termRow)
+	}
+	if p.saved != nil && (p.saved.Rows != p.termRow || p.saved.Cols != p.termCol) {
+		return errorf(DIMS_ERROR, "the saved game needs a %dx%d terminal, this one is %dx%d",
+		              p.saved.Cols, p.saved.Rows, p.termCol, p.termRow)
+	}
 
-		case ( y == (p.termRow - ROW_LOW_LIMIT) ):
-			p.Lock()
-			for i:=-1; i<BOSS_ROWS; i++{
-				copy(p.screen[y+i][x:] , bline[:])
-			}
-			p.refreshScreenUnlock(0)
+	p.centTrmRow = p.termRow / 2 
+	p.centTrmCol = p.termCol / 2
+        p.curCol       = p.termCol / 2
+	p.score        = 0
+	p.hiScore      = 0
+	if scores, _ := LoadScores(p.scoresPath); len(scores) > 0 { p.hiScore = scores[0].Points }
+	p.shield       = STD_SHIELD_LEV
+	p.level        = 1
+	p.lives        = STD_LIVES
+	p.weapon       = STD_WEAPON
+	p.debug        = p.opts.Debug
+	if p.opts.Spectate != "" || p.remote { p.spectators = newBroadcast(p.playerName(), p.caps) }
+
+	p.makeScreen()
+	return nil
+}
 
-			p.critical <- true
-		default:
-			fmt.Printf("%c%c",BELL_SOUND, BELL_SOUND)
-			for h:= range bossDestruct[:]{
-				p.Lock()
-				for i:=0; i<BOSS_ROWS; i++{
-					copy(p.screen[y+i][x:] , bossDestruct[h][i][:])
-				}
-				p.refreshScreenUnlock(TIMER_LEVEL_A)
-			}
+func (p *Playground) makeScreen(){
+	var spriteData = [SPRITE_ROWS][SPRITE_COLS]rune {
+	    { '\U00000020','\U00000020','\U00000020','\U00000020','\U00002554','\U00002550','\U0000256C','\U00002550','\U00002557','\U00000020','\U00000020','\U00000020','\U00000020'}, 
+	    { '\U00000020','\U00000020','\U00000020','\U00000020','\U00002560','\U00002550','\U00002569','\U00002550','\U00002563','\U00000020','\U00000020','\U00000020','\U00000020'}, 
+	    { '\U00000020','\U00000020','\U00002554','\U00002550','\U00002569','\U00002550','\U00002550','\U00002550','\U00002569','\U00002550','\U00002557','\U00000020','\U00000020'}, 
+	    { '\U0000255A','\U00002550','\U00002569','\U00002550','\U00002550','\U00002550','\U00002550','\U00002550','\U00002550','\U00002550','\U00002569','\U00002550','\U0000255D'}}
 
-			p.Lock()
-			for i:=-1; i<BOSS_ROWS; i++{
-				copy(p.screen[y+i][x:] , bline[:])
-			}
-			p.refreshScreenUnlock(0)
+	p.screen = make([][]rune, p.termRow)
+	p.sprite = make([][]rune, SPRITE_ROWS)
 
-			p.critical <- true 
+	for i := range p.screen[:] {
+		p.screen[i] = make([]rune, p.termCol)
 	}
-	exit: 
-}
 
-func (p *Playground) ActionKey(){
-    defer p.safeExitPanic("ActionKey")
-
-    var(
-        missile  byte =  32  	// space : missile
-        left     byte =  97  	// a: move left
-        right    byte =  115 	// s: move right
-        jleft    byte =  122  	// z: move left quick
-        jright   byte =  120 	// x: move right quick
-        quit     byte =  113 	// q: exit
-        reset    byte =  114    // r: restart
-
-        k []byte = make([]byte, 1)
-    )
-
-    os.Stdin.Read(k)
-    switch k[0] {
-	case left: 
-		if !p.stop { p.MoveSprite(DIR_LEFT)}
-	case right:
-		if !p.stop { p.MoveSprite(DIR_RIGHT)}
-	case jleft: 
-		if !p.stop { for i:=0; i<STD_JUMP_LEN; i++{ p.MoveSprite(DIR_LEFT) }}
-	case jright:
-		if !p.stop { for i:=0; i<STD_JUMP_LEN; i++{ p.MoveSprite(DIR_RIGHT) }}
-	case missile:
-		if !p.stop { go p.deployMissile()}
-	case reset:
-		if !p.stop { p.restart(false) } else { p.wgConfirm.Done() }
-	case quit: 
-		p.safeExit() 
-    }
-    time.Sleep(TIMER_LEVEL_AM)
+	for i := range spriteData[:] {
+		p.sprite[i] = make([]rune, SPRITE_COLS)
+		copy(p.sprite[i][:] , spriteData[i][:])
+	}
 }
 
-func (p *Playground) deployMissile(){
-        defer p.safeExitPanic("deployMissile")
+func (p *Playground) InitScreen(){
+	for i := range p.screen[:] {
+		for j:= range p.screen[i]{
+			p.screen[i][j] = '\U00000020'
+		}
+	}
 
-	var (
-	    lines = []rune { '\U0000005E', '\U00002569', '\U0000002E', '\U0000002A' } 
+	p.drawHud()
+	p.dirty = true
+}
 
-	    coladj int = p.curCol + COL_START_LIMIT
-	    rowadj int = p.termRow - ROW_LOW_LIMIT
-	    startPos  int = p.termRow - ROW_START_LIMIT
-	    safeRows  int = p.termRow - SPRITE_BEGIN
-	)
+// getTermDims reads the size of the terminal, which must leave room
+// for the playfield and not be larger than MAX_COLS x MAX_ROWS.
+func (p *Playground) getTermDims() error {
 
-	fmt.Printf("%c", BELL_SOUND)
-	for(rowadj > 0 && p.screen[rowadj - 1][coladj] == SPACE_CHARAC ){
-		if p.start { goto exit }
-		rowadj--
-		p.Lock()
-
-		p.screen[rowadj][coladj]   = lines[0]
-		p.screen[rowadj+1][coladj] = lines[1]
-		if rowadj < startPos {
-			if(rowadj % 2 == 0){
-					p.screen[rowadj+2][coladj] = lines[2]
-					p.screen[rowadj+3][coladj] = lines[3]
-			} else{
-					p.screen[rowadj+2][coladj] = lines[3]
-					p.screen[rowadj+3][coladj] = lines[2]
-			}
-			p.screen[rowadj+4][coladj] = SPACE_CHARAC
-		}else{
-			p.screen[rowadj+2][coladj] = SPACE_CHARAC
-		}
+	rows, cols, sizeErr := p.size()
+	if sizeErr != nil { return &Error{ TERM_ERROR, sizeErr } }
 
-		p.refreshScreenUnlock(TIMER_LEVEL_A)
+	if rows < MIN_ROWS || cols < MIN_COLS {
+		return errorf(DIMS_ERROR, "the terminal is %dx%d, please make it at least %dx%d", cols, rows, MIN_COLS, MIN_ROWS)
 	}
-
-	p.Lock() 
-
-	for i:=0; i<5; i++{
-		if(rowadj + i < safeRows ) {p.screen[rowadj + i][coladj] = SPACE_CHARAC}
+	if rows > MAX_ROWS || cols > MAX_COLS {
+		return errorf(DIMS_ERROR, "the terminal is %dx%d, please make it at most %dx%d", cols, rows, MAX_COLS, MAX_ROWS)
 	}
 
-	p.refreshScreenUnlock(0)
+	p.termCol = cols
+	p.termRow = rows
+	return nil
+}
 
-	if(rowadj != 0){ p.exploded <- true }
+func (p *Playground) changeShield(level int){
+	old := p.shield
+	if level < STD_SHIELD_LEV { 
+		p.shield += level
+	}else{
+		p.shield = STD_SHIELD_LEV
+	}
+	p.event(slog.LevelInfo, "shield", "from", old, "to", p.shield)
+	p.drawHud()
+}
 
-	exit:
+func (p *Playground) changeScore(points int){
+	p.score += points
+	if p.score > p.hiScore { p.hiScore = p.score }
+	p.event(slog.LevelInfo, "score", "points", points, "score", p.score)
+	p.drawHud()
 }
 
 func (p *Playground) MoveSprite(direction int){
-	defer p.safeExitPanic("MoveSprite")
+	p.moveShip(&p.curCol, direction)
+}
 
+// moveShip moves the ship at *col a column, if the other ship of a
+// co-op game is not in the way.
+func (p *Playground) moveShip(col *int, direction int){
 	var end int
 	switch direction {
 		case DIR_LEFT:
-			if p.curCol <= EN_MISS_ADJ { return }
+			if *col <= EN_MISS_ADJ { return }
 			end = SPRITE_COLS
 		case DIR_RIGHT:       
-			if p.curCol >= (p.termCol - SPRITE_COLS_GAP) { return }
+			if *col >= (p.termCol - SPRITE_COLS_GAP) { return }
 			end = -1
 		default:
 			return
 	}
-	p.curCol+=direction
-	p.Lock()
+	if p.shipsCollide(col, *col + direction) { return }
+	*col+=direction
 
 	for i := range p.sprite[:] {
 		for j:= range p.sprite[i]{
-			p.screen[p.termRow-(SPRITE_BEGIN-i)][j+p.curCol] = p.sprite[i][j]
-			p.screen[p.termRow-(SPRITE_BEGIN-i)][p.curCol+end] = SPACE_CHARAC
+			p.screen[p.termRow-(SPRITE_BEGIN-i)][j+*col] = p.sprite[i][j]
+			p.screen[p.termRow-(SPRITE_BEGIN-i)][*col+end] = SPACE_CHARAC
 		}
 	}
-
-	p.refreshScreenUnlock(0)
 }
 
-func (p *Playground) Events(){
-	defer p.safeExitPanic("Events")
-
-	select {
-		case <- p.critical:
-			p.stop = true
-			p.destroySprite()
-			p.restart(true)
-		case <- p.intSignal:
-			p.safeExit()
-		case <- p.winchSignal:
-			p.restart(false)
+// Events handles the signals until the game ends: an interrupt quits,
+// a termination quits with the exit code of the signal, and a change of
+// the window size starts over on a screen of the new size.
+func (p *Playground) Events(ctx context.Context){
+	for {
+		select {
+			case <- ctx.Done():
+				return
+			case <- p.intSignal:
+				p.log.Info("signal", "signal", "interrupt")
+				p.end(nil)
+			case sig := <- p.termSignal:
+				p.log.Warn("signal", "signal", sig.String())
+				p.end(errorf(SIGNAL_EXIT + int(sig.(syscall.Signal)), "%v", sig))
+			case <- p.winchSignal:
+				p.Lock()
+				err := p.resize()
+				p.event(slog.LevelInfo, "resize", "rows", p.termRow, "cols", p.termCol, "err", err)
+				if err == nil && p.playing { p.restart(false) }
+				p.Unlock()
+				if err != nil { p.end(err) }
+
+				select {
+					case p.resized <- struct{}{}:
+					default:
+				}
+		}
 	}
 }
 
-func (p *Playground) destroySprite(){
-	defer p.safeExitPanic("destroySprite")
-
-	var explosionSpriteData = [DESTR_SEQUENCE][SPRITE_ROWS][SPRITE_COLS]rune { 
-           {{ '\U00000020','\U00000020','\U00000020','\U00000020','\U0000002A','\U00002550','\U0000007C','\U00002550','\U0000002A','\U00000020','\U00000020','\U00000020','\U00000020'}, 
-	    { '\U00000020','\U00000020','\U00000020','\U00000020','\U0000002A','\U00002550','\U0000007C','\U00002550','\U0000002A','\U00000020','\U00000020','\U00000020','\U00000020'}, 
-	    { '\U00000020','\U00000020','\U0000002A','\U00002550','\U0000005C','\U00002550','\U0000002A','\U00002550','\U0000002F','\U00002550','\U0000002A','\U00000020','\U00000020'}, 
-	    { '\U0000002A','\U00002550','\U0000002A','\U00002550','\U00002550','\U0000002A','\U00002550','\U00002550','\U0000002A','\U00002550','\U0000002A','\U00002550','\U0000002A'}},
-	   {{ '\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U0000002A','\U00000020','\U0000002A','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'}, 
-	    { '\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U0000002A','\U00000020','\U0000002A','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'}, 
-	    { '\U00000020','\U00000020','\U00000020','\U0000002A','\U0000005C','\U0000002A','\U0000002A','\U00000020','\U0000002F','\U00000020','\U0000002A','\U00000020','\U00000020'}, 
-	    { '\U00000020','\U0000002A','\U00000020','\U00000020','\U00000020','\U0000002A','\U00000020','\U00000020','\U0000002A','\U00000020','\U0000002A','\U00000020','\U0000002A'}},
-	  {{ '\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'}, 
-	    { '\U00000020','\U00000020','\U00000020','\U0000002A','\U0000005C','\U0000002A','\U0000002A','\U00000020','\U0000002F','\U00000020','\U0000002A','\U00000020','\U00000020'}, 
-	    { '\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U0000002A','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'}, 
-	    { '\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U0000002A','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'}}}
-
-	for h := range explosionSpriteData[:] {
-		p.Lock()
-		for i := range explosionSpriteData[h][:] {
-			for j:= range explosionSpriteData[h][i]{
-				p.screen[p.termRow-(SPRITE_BEGIN-i)][j+p.curCol] = explosionSpriteData[h][i][j]
-			}
-		}
-		p.refreshScreenUnlock(TIMER_LEVEL_C)
-	}
+// resize makes the screen anew for the current size of the terminal.
+// The caller must hold the lock.
+func (p *Playground) resize() error {
+	if err := p.getTermDims(); err != nil { return err }
+	p.centTrmRow = p.termRow / 2
+	p.centTrmCol = p.termCol / 2
+	p.makeScreen()
+	p.InitScreen()
+	return nil
 }
 
+// restart stops the round and shows the game over dialog, waiting for
+// the player to start again, or the restart one. The caller must hold
+// the lock.
 func (p *Playground) restart(confirm bool){
-        defer p.safeExitPanic("restart")
-
-	p.Lock()
+	p.event(slog.LevelInfo, "round stopped", "game_over", confirm, "score", p.score, "level", p.level)
 	p.start = true
 	p.stop  = true
+	p.enemy, p.missiles, p.enemyMissiles = nil, nil, nil
 	p.InitScreen()
 
 	var (
-		textScore = []rune {'\U00000053','\U00000043','\U0000004F','\U00000052','\U00000045','\U0000003A'}
-	        textShield = []rune {'\U00000053','\U00000048','\U00000049','\U00000045','\U0000004C','\U00000044','\U0000003A'}
 	        textAdvA = []rune {'\U00002554','\U00002550','\U00002550','\U00002550','\U00002550','\U00002550','\U00002550','\U00002550','\U00002550','\U00002550','\U00002550','\U00002550','\U00002557'}
 	        textAdvB = []rune {'\U00002551','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00002551'}
 	)
-	copy(p.screen[p.termRow-1][(p.termCol - SCORE_TXT_OFFST):], textScore[:])
-	copy(p.screen[p.termRow-1][(p.termCol - SCORE_IST_OFFST):], textShield[:])
 	copy(p.screen[p.centTrmRow][(p.centTrmCol - MSG_OFFSET):], textAdvA[:])
 	copy(p.screen[p.centTrmRow+1][(p.centTrmCol - MSG_OFFSET):], textAdvB[:])
 
@@ -747,89 +494,184 @@ func (p *Playground) restart(confirm bool){
 	copy(p.screen[p.centTrmRow+5][(p.centTrmCol - MSG_OFFSET):], textAdvF[:])
 
 	p.changeScore(STD_ENEM_POINT)
-	p.refreshScreenUnlock(0)
-
-	if confirm { 
-		p.wgConfirm.Add(1) 
-		p.wgConfirm.Wait() 
-	}else {
-		time.Sleep(TIMER_LEVEL_C)
+	if confirm { p.recordScore() }
+
+	switch {
+		case p.replay != nil:
+			p.finish, p.finishAt = FINISH_EXIT, p.ticks + ticks(TIMER_LEVEL_D)
+		case p.rival != nil:
+			if p.diedAt == 0 { p.diedAt = p.ticks }
+			p.finish, p.finishAt = FINISH_LOST, p.ticks + ticks(TIMER_LEVEL_D)
+		case confirm && !p.demo:
+			p.awaitRestart = true
+		default:
+			p.finish, p.finishAt = FINISH_RESTART, p.ticks + ticks(TIMER_LEVEL_C)
 	}
+}
 
-	env := os.Environ()   
-	p.CanonicMode()
-	if(strings.Contains(p.args[0], BINARY_NAME)){
-		binary, lookErr := exec.LookPath(COMPILER_NAME)
-		if lookErr != nil { panic(lookErr) }
-		args := []string{COMPILER_NAME, RUN_PARAMETER, SOURCE_NAME}
-		if execErr := syscall.Exec(binary, args,  env); execErr != nil { panic(execErr) }
-	}else{
-		binary, lookErr := exec.LookPath(p.args[0])
-		if lookErr != nil { binary = p.args[0] }
-		pars := []string{p.args[0]}
-		if execErr := syscall.Exec(binary, pars,  env); execErr != nil { panic(execErr) }
-	}
+// SkipTitle reports whether the game starts at once, as it does when
+// restarting a game, resuming one or playing a replay.
+func (p *Playground) SkipTitle() bool {
+	return p.opts.NoTitle || p.replay != nil || p.saved != nil
 }
 
-func (p *Playground) safeExitPanic(errMsg string){
-	if e := recover(); e != nil {
-		p.CanonicMode()
-		fmt.Fprintf(os.Stderr, "Runtime Error: %s\n", errMsg)
-		os.Exit(RUNTIME_ERROR)	
+// beginRound sets up the playfield for a new round, from the first
+// level with a full shield. The caller must hold the lock.
+func (p *Playground) beginRound(){
+	p.playing = true
+	p.ticks   = 0
+	p.curCol  = p.termCol / 2
+	p.score, p.shield, p.level, p.lives = 0, STD_SHIELD_LEV, 1, STD_LIVES
+	p.mateShot, p.diedAt, p.cause = false, 0, ""
+
+	p.stop, p.start, p.awaitRestart = false, false, false
+	p.finish, p.finishAt            = FINISH_NONE, 0
+	p.endFrame, p.endNext           = 0, 0
+	p.explosions, p.reload          = 0, 0
+	p.input, p.replayPos            = nil, 0
+	p.enemy, p.missiles, p.enemyMissiles = nil, nil, nil
+
+	p.InitScreen()
+	p.MoveSprite(DIR_LEFT)
+	if p.mate != nil { p.placeMate() }
+	p.startWave()
+
+	p.viewer = nil
+	if p.replay != nil { p.startViewer() }
+}
+
+// endRound closes the recording, which only covers the first round,
+// with how it ended. The caller must hold the lock.
+func (p *Playground) endRound(){
+	p.playing = false
+	if p.record == nil { return }
+	fmt.Fprintf(p.record, "%s %d %d %d %s\n", REPLAY_END, p.ticks, p.score, p.level, p.roundCause())
+	p.record.Close()
+	p.record, p.opts.Record = nil, ""
+}
+
+// Run plays the round in real time, a tick every TICK, until it ends
+// or ctx is cancelled, and tells how it ended.
+func (p *Playground) Run(ctx context.Context) int {
+	next  := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		next = next.Add(TICK)
+		timer.Reset(time.Until(next))
+		select {
+			case <- ctx.Done():
+				return FINISH_QUIT
+			case <- timer.C:
+		}
+
+		if finish := p.lockedTick(p.Tick); finish != FINISH_NONE { return finish }
 	}
 }
 
-func (p *Playground) safeExit(){
-	p.CanonicMode()
-	os.Exit(NO_ERROR)	
+// lockedTick runs tick under the lock, which a panic of the tick gives
+// back too, for the crash handler to end the game.
+func (p *Playground) lockedTick(tick func() int) int {
+	p.lock()
+	defer p.Unlock()
+	return tick()
 }
 
-func (p *Playground) RawMode(){
-        defer p.safeExitPanic("RawMode")
+// ReadKeys feeds the keyboard to the menus and to the rounds, until
+// ctx is cancelled, which interrupts the read in progress, or the
+// input ends; the keys channel is then closed.
+func (p *Playground) ReadKeys(ctx context.Context){
+	defer close(p.keys)
+	defer context.AfterFunc(ctx, p.interruptKeys)()
 
-        p.newTerm.Iflag &^= (syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON)
-        p.newTerm.Oflag &^= syscall.OPOST
-        p.newTerm.Lflag &^= (syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN)
-        p.newTerm.Cflag &^= (syscall.CSIZE | syscall.PARENB)
-        p.newTerm.Cflag |= syscall.CS8
+	k := make([]byte, 1)
+	for {
+		n, err := p.in.Read(k)
+		if err != nil || ctx.Err() != nil { return }
+		if n == 1 {
+			p.Lock()
+			p.logInput(k[0])
+			p.Unlock()
+		}
+		switch {
+			case n != 1:
+			case k[0] == SUSPEND_CHARAC:
+				p.requestSuspend()
+			default:
+				select {
+					case p.keys <- k[0]:
+					case <- ctx.Done():
+						return
+				}
+		}
+	}
+}
 
-        p.newTerm.Cc[syscall.VWERASE]  = 1
-        p.newTerm.Cc[syscall.VMIN]     = 1
-        p.newTerm.Cc[syscall.VTIME]    = 0
+// interruptKeys wakes up a pending read of the input: a deadline is
+// enough for the terminal and for connections, other readers are
+// closed.
+func (p *Playground) interruptKeys(){
+	switch in := p.in.(type) {
+		case interface{ SetReadDeadline(time.Time) error }:
+			in.SetReadDeadline(time.Now())
+		case io.Closer:
+			in.Close()
+	}
+}
 
-        file, fileErr  := os.Open(TERMINAL_DEV)
-	if fileErr != nil { panic(fileErr) }
-        fd             := file.Fd()
+// RawMode takes over the terminal of the process for the game; the
+// client of a remote terminal has already put it in raw mode.
+func (p *Playground) RawMode() error {
+        if p.remote { return p.enterScreen() }
 
-        _, _, execErr := syscall.Syscall(syscall.SYS_IOCTL, fd, GET_TERMIOS, uintptr(unsafe.Pointer(&p.oldTerm)))
-	if execErr != 0 { panic("IOCTL Error") }
-        _, _, execErr = syscall.Syscall(syscall.SYS_IOCTL, fd, SET_TERMIOS, uintptr(unsafe.Pointer(&p.newTerm)))
-	if execErr != 0 { panic(execErr) }
+        term, termErr := terminal.Open(TERMINAL_DEV)
+        if termErr != nil { return &Error{ TERM_ERROR, termErr } }
+        p.term = term
+        p.in   = term
 
-        fmt.Fprintf(os.Stderr,"%c[?%dl", 0x1B, 25)      // Disable cursor
+        return p.enterScreen()
 }
 
-func (p *Playground) CanonicMode(){
-        fmt.Fprintf(os.Stderr,"%c[?%dh",   0x1B, 25)    // Enable cursor
-        fmt.Fprintf(os.Stderr,"%c[%d;%dH", 0x1B, 1, 1)  // Tput 1,1
-        fmt.Fprintf(os.Stderr,"%c[%dJ",    0x1B, 2)     // Clear
+// enterScreen puts the terminal in raw mode on the alternate screen,
+// at start and again when the game resumes after a suspension.
+func (p *Playground) enterScreen() error {
+        p.termMu.Lock()
+        defer p.termMu.Unlock()
+
+        if p.term != nil {
+                if rawErr := p.term.MakeRaw(); rawErr != nil { return &Error{ TERM_ERROR, rawErr } }
+        }
+        p.raw = true
+
+        fmt.Fprint(p.out, p.caps.smcup)                 // Alternate screen
+        fmt.Fprint(p.out, p.caps.clear)
+        fmt.Fprint(p.out, p.caps.civis)                 // Disable cursor
+        return nil
+}
 
-        file, fileErr  := os.Open(TERMINAL_DEV)
-	if fileErr != nil { panic(fileErr) }
-        fd             := file.Fd()
+// leaveScreen gives the terminal back as it was found: the user's own
+// screen, the cursor and the exact termios saved by RawMode.
+func (p *Playground) leaveScreen(){
+        p.termMu.Lock()
+        defer p.termMu.Unlock()
 
-        _, _, execErr := syscall.Syscall(syscall.SYS_IOCTL, fd, SET_TERMIOS, uintptr(unsafe.Pointer(&p.oldTerm)))
-	if execErr != 0 { panic("IOCTL Error") }
+        if !p.raw { return }
+        fmt.Fprint(p.out, p.caps.sgr0)
+        fmt.Fprint(p.out, p.caps.clear)
+        fmt.Fprint(p.out, p.caps.cnorm)                 // Enable cursor
+        fmt.Fprint(p.out, p.caps.rmcup)                 // Main screen
+
+        if p.term != nil { p.term.Restore() }
+        p.raw = false
 }
 
+func (p *Playground) CanonicMode(){
+        p.halted.Store(true)
+        p.leaveScreen()
+}
 
 func (p *Playground) refreshScreenUnlock(timeWait time.Duration){
-	defer p.safeExitPanic("refreshScreenUnlock")
-
-	fmt.Fprintf(os.Stderr,"%c[%d;%dH", 0x1B, 1, 1) 
-	for i := range p.screen {
-		fmt.Fprintf(os.Stderr, string(p.screen[i]))
-	}
+	p.dirty = true
 	p.Unlock()
 	if timeWait > 0 {time.Sleep(timeWait)}
 }
@@ -0,0 +1,202 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package space
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"terminfo"
+)
+
+const (
+	SPECTATE_LABEL = " %s "
+	SPECTATE_END   = "The game is over.\r\n"
+)
+
+// A Broadcast hands the frames of a game to its spectators, as many as
+// they are. The frames are drawn for them only while someone watches;
+// one who comes in asks the renderer for a frame at once.
+type Broadcast struct {
+	player     string
+	intro      string
+	outro      string
+
+	mu         sync.Mutex
+	viewers    map[chan []byte]struct{}
+	over       bool
+	ended      chan struct{}
+	waiting    atomic.Bool
+}
+
+func newBroadcast(player string, caps *termCaps) *Broadcast {
+	return &Broadcast{
+		player:  player,
+		intro:   caps.sgr0 + caps.clear + caps.civis,
+		outro:   caps.sgr0 + caps.clear + caps.cnorm + SPECTATE_END,
+		viewers: make(map[chan []byte]struct{}),
+		ended:   make(chan struct{}),
+	}
+}
+
+// Player is the name of the player of the game.
+func (b *Broadcast) Player() string {
+	return b.player
+}
+
+// Viewers is the number of spectators.
+func (b *Broadcast) Viewers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.viewers)
+}
+
+// Watch writes the frames of the game to w until the game is over, ctx
+// is cancelled or w fails. A slow spectator skips frames, never the
+// last one.
+func (b *Broadcast) Watch(ctx context.Context, w io.Writer) error {
+	frames := make(chan []byte, 1)
+	b.mu.Lock()
+	if b.over {
+		b.mu.Unlock()
+		_, err := io.WriteString(w, b.outro)
+		return err
+	}
+	b.viewers[frames] = struct{}{}
+	b.waiting.Store(true)
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		delete(b.viewers, frames)
+		b.mu.Unlock()
+	}()
+
+	if _, err := io.WriteString(w, b.intro); err != nil { return err }
+	for {
+		select {
+			case frame := <- frames:
+				if _, err := w.Write(frame); err != nil { return err }
+			case <- b.ended:
+				_, err := io.WriteString(w, b.outro)
+				return err
+			case <- ctx.Done():
+				return nil
+		}
+	}
+}
+
+// wants tells the renderer that a spectator came in and waits for a
+// frame; the broadcast of a game may be nil.
+func (b *Broadcast) wants() bool {
+	return b != nil && b.waiting.Swap(false)
+}
+
+func (b *Broadcast) watched() bool {
+	return b != nil && b.Viewers() > 0
+}
+
+// publish hands a frame to every spectator, in place of the one they
+// did not take yet.
+func (b *Broadcast) publish(frame []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for frames := range b.viewers {
+		select {
+			case <- frames:
+			default:
+		}
+		frames <- frame
+	}
+}
+
+// end tells the spectators that the game is over.
+func (b *Broadcast) end() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.over { return }
+	b.over = true
+	close(b.ended)
+}
+
+// Spectators is the broadcast of the game, nil when nobody can watch it.
+func (p *Playground) Spectators() *Broadcast {
+	return p.spectators
+}
+
+// spectatorFrame draws the screen for the spectators, whose terminals
+// may be bigger: each row is placed with cup, and the name of the
+// player is shown in the top left corner. The frame is theirs to keep.
+// The caller must hold the lock.
+func (p *Playground) spectatorFrame() []byte {
+	var buf bytes.Buffer
+	p.encode(&buf, p.caps, p.caps.cup != "")
+	if p.caps.cup == "" { return buf.Bytes() }
+
+	label := []rune(fmt.Sprintf(SPECTATE_LABEL, p.spectators.player))
+	if len(label) > p.termCol { label = label[:p.termCol] }
+	buf.WriteString(terminfo.Tparm(p.caps.cup, 0, 0))
+	buf.WriteString(p.caps.label)
+	buf.WriteString(string(label))
+	buf.WriteString(p.caps.sgr0)
+	buf.WriteString(p.caps.themes[p.theme])
+	return buf.Bytes()
+}
+
+// listenSpectators opens the address where anyone can watch the game,
+// with nc or telnet.
+func (p *Playground) listenSpectators(addr string) error {
+	if addr == "" { return nil }
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil { return &Error{ NET_ERROR, err } }
+	p.spectateListener = ln
+	p.log.Info("spectators", "addr", ln.Addr().String())
+	return nil
+}
+
+// acceptSpectators shows the game to each one who connects, until the
+// game is over; what they type is ignored. The game tells them it is
+// over before the session stops, which leaves them a moment to take
+// the news.
+func (p *Playground) acceptSpectators(ctx context.Context) {
+	defer context.AfterFunc(ctx, func() { p.spectateListener.Close() })()
+
+	for {
+		conn, err := p.spectateListener.Accept()
+		if err != nil { return }
+
+		p.log.Info("spectator", "addr", conn.RemoteAddr().String())
+		p.session.Go(func(ctx context.Context) {
+			defer conn.Close()
+			defer context.AfterFunc(ctx, func() { conn.SetWriteDeadline(time.Now().Add(COOP_WRITE_TIMEOUT)) })()
+			p.spectators.Watch(context.Background(), conn)
+		})
+	}
+}
@@ -0,0 +1,91 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package space
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+)
+
+// Every spectator gets the frames of the game with the name of the
+// player over them, and is told when the game is over.
+func TestSpectators(t *testing.T) {
+	p := NewHeadless(35, 100, 1, "EASY")
+	p.opts.NoTitle = true
+	p.spectators = newBroadcast("alice", p.caps)
+	keys, press := io.Pipe()
+	defer press.Close()
+	p.in = keys
+	done := make(chan error, 1)
+	go func() { done <- p.Play() }()
+	waitRounds(t, p, 1)
+
+	var screens [2]screenBuffer
+	watched := make(chan error, len(screens))
+	for i := range screens {
+		go func() { watched <- p.spectators.Watch(context.Background(), struct{ io.Writer }{ &screens[i] }) }()
+	}
+	label := p.caps.label + fmt.Sprintf(SPECTATE_LABEL, "alice")
+	waitFor(t, p, "the frames of the spectators", func() bool {
+		return screens[0].Contains(label) && screens[1].Contains(label) && screens[1].Contains("SCORE")
+	})
+	if n := p.spectators.Viewers(); n != 2 { t.Errorf("%d spectators, want 2", n) }
+
+	press.Write([]byte{ p.keymap.Quit })
+	if err := <-done; err != nil { t.Errorf("the game ended with %v", err) }
+	for i := range screens {
+		if err := <-watched; err != nil { t.Errorf("a spectator ended with %v", err) }
+		if !screens[i].Contains(SPECTATE_END) { t.Errorf("spectator %d was not told the game is over", i) }
+	}
+	if n := p.spectators.Viewers(); n != 0 { t.Errorf("%d spectators left", n) }
+}
+
+// A game played with --spectate takes spectators on its own address.
+func TestSpectateListener(t *testing.T) {
+	p := NewHeadless(35, 100, 1, "EASY")
+	p.opts.NoTitle = true
+	p.spectators = newBroadcast("bob", p.caps)
+	if err := p.listenSpectators("127.0.0.1:0"); err != nil { t.Fatal(err) }
+	keys, press := io.Pipe()
+	defer press.Close()
+	p.in = keys
+	done := make(chan error, 1)
+	go func() { done <- p.Play() }()
+
+	conn, err := net.Dial("tcp", p.spectateListener.Addr().String())
+	if err != nil { t.Fatal(err) }
+	defer conn.Close()
+	var screen screenBuffer
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(struct{ io.Writer }{ &screen }, conn)
+		close(copied)
+	}()
+	waitFor(t, p, "the frames of the spectator", func() bool { return screen.Contains(fmt.Sprintf(SPECTATE_LABEL, "bob")) })
+
+	press.Write([]byte{ p.keymap.Quit })
+	if err := <-done; err != nil { t.Errorf("the game ended with %v", err) }
+	<- copied
+	if !screen.Contains(SPECTATE_END) { t.Error("the spectator was not told the game is over") }
+}
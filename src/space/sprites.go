@@ -0,0 +1,90 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+// The invaders, the boss and the ship exploding, as drawn on the
+// screen, one rune per cell.
+var (
+	    invasorSprite = [INVASOR_ROWS][INVASOR_COLS]rune {
+				 {'\U00002554','\U00002550','\U00002566','\U00002550','\U00002557'}, 
+				 {'\U00002560','\U00002550','\U0000256B','\U00002550','\U00002563'}, 
+				 {'\U0000255D','\U00000020','\U00000020','\U00000020','\U0000255A'}}
+
+	    invasorDestr = [DESTR_SEQUENCE][INVASOR_ROWS][INVASOR_COLS]rune {
+				 {{ '\U0000002A','\U00002550','\U0000002A','\U00002550','\U0000002A'},
+				  { '\U00002560','\U0000002A','\U0000256B','\U0000002A','\U00002563'},
+				  { '\U0000002A','\U00000020','\U0000002A','\U00000020','\U0000002A'}},
+				 {{ '\U0000002A','\U0000002E','\U0000002A','\U0000002E','\U0000002A'}, 
+				  { '\U0000002E','\U0000002A','\U0000256B','\U0000002A','\U0000002E'},
+				  { '\U0000002A','\U00000020','\U0000002A','\U00000020','\U0000002A'}},
+				 {{ '\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'},
+				  { '\U00000020','\U0000002A','\U0000002E','\U0000002A','\U00000020'},
+				  { '\U00000020','\U00000020','\U0000002A','\U00000020','\U00000020'}}}
+
+	    bossSprite = [BOSS_ROWS][BOSS_COLS]rune  {
+	    {'\U0000256D','\U00000020','\U00002501','\U00002501','\U00002501','\U00002501','\U00000020','\U0000256E'},
+	    {'\U00002503','\U00000020','\U0000256F','\U0000256F','\U00002570','\U00002570','\U00000020','\U00002503'},
+	    {'\U00002503','\U000014A1','\U000025EF','\U00001D54','\U00002503','\U000025EF','\U000014A1','\U00002503'},
+	    {'\U00002503','\U00002503','\U00000020','\U00000020','\U0000005F','\U00002503','\U00000020','\U00002503'},
+	    {'\U00002503','\U00000020','\U0000005C','\U0000005F','\U0000005F','\U0000002F','\U00000020','\U00002503'},
+	    {'\U0000255A','\U00002550','\U00002556','\U00002550','\U00002550','\U00002556','\U00002550','\U00002557'},
+	    {'\U00000020','\U00000020','\U0000256C','\U00002550','\U00002550','\U0000256C','\U00000020','\U00000020'},
+	    {'\U00000020','\U00000020','\U0000255D','\U00000020','\U00000020','\U0000255A','\U00000020','\U00000020'} }
+   
+	   bossDestr = [DESTR_SEQUENCE][BOSS_ROWS][BOSS_COLS]rune  {
+	   {{'\U0000002A','\U00002501','\U0000002A','\U00002501','\U00002501','\U0000002A','\U00002501','\U0000002A'},
+	    {'\U00002503','\U00000020','\U0000256F','\U0000256F','\U00002570','\U00002570','\U00000020','\U00002503'},
+	    {'\U0000002A','\U00000020','\U0000002B','\U00000020','\U00002503','\U0000002B','\U00000020','\U0000002A'},
+	    {'\U00000020','\U00002503','\U00000020','\U00000020','\U0000002A','\U00002503','\U00000020','\U00000020'},
+	    {'\U0000002A','\U00000020','\U0000005C','\U0000005F','\U0000005F','\U0000002F','\U00000020','\U0000002A'},
+	    {'\U0000002A','\U00002550','\U00002556','\U00002550','\U00002550','\U00002556','\U00002550','\U0000002A'},
+	    {'\U00000020','\U00000020','\U0000002A','\U00002550','\U00002550','\U0000002A','\U00000020','\U00000020'},
+	    {'\U00000020','\U00000020','\U0000002A','\U00000020','\U00000020','\U0000002A','\U00000020','\U00000020'}},
+	   {{'\U0000002A','\U00000020','\U0000002A','\U00000020','\U00000020','\U0000002A','\U00000020','\U0000002A'},
+	    {'\U00002503','\U00000020','\U0000256F','\U0000256F','\U00002570','\U00002570','\U00000020','\U00002503'},
+	    {'\U0000002A','\U00000020','\U0000002B','\U00000020','\U00000020','\U0000002B','\U00000020','\U0000002A'},
+	    {'\U00000020','\U00002503','\U00000020','\U00000020','\U00000020','\U00002503','\U00000020','\U00000020'},
+	    {'\U0000002A','\U00000020','\U0000005C','\U0000005F','\U0000005F','\U0000002F','\U00000020','\U0000002A'},
+	    {'\U0000002A','\U00000020','\U00002556','\U00002550','\U00002550','\U00002556','\U00000020','\U0000002A'}, 
+	    {'\U00000020','\U00000020','\U0000002A','\U0000002A','\U0000002A','\U0000002A','\U00000020','\U00000020'},
+	    {'\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'}},
+	   {{'\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'},
+	    {'\U00002503','\U00000020','\U0000256F','\U0000256F','\U00002570','\U00002570','\U00000020','\U00002503'},
+	    {'\U00000020','\U00000020','\U0000002A','\U00000020','\U00000020','\U0000002A','\U00000020','\U00000020'},
+	    {'\U00000020','\U0000002A','\U00000020','\U0000002A','\U00000020','\U0000002A','\U00000020','\U00000020'},
+	    {'\U00000020','\U00000020','\U0000002A','\U00000020','\U0000002A','\U00000020','\U00000020','\U00000020'},
+	    {'\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'},
+	    {'\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'},
+	    {'\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'}}}
+
+	    shipDestr = [DESTR_SEQUENCE][SPRITE_ROWS][SPRITE_COLS]rune { 
+           {{ '\U00000020','\U00000020','\U00000020','\U00000020','\U0000002A','\U00002550','\U0000007C','\U00002550','\U0000002A','\U00000020','\U00000020','\U00000020','\U00000020'}, 
+	    { '\U00000020','\U00000020','\U00000020','\U00000020','\U0000002A','\U00002550','\U0000007C','\U00002550','\U0000002A','\U00000020','\U00000020','\U00000020','\U00000020'}, 
+	    { '\U00000020','\U00000020','\U0000002A','\U00002550','\U0000005C','\U00002550','\U0000002A','\U00002550','\U0000002F','\U00002550','\U0000002A','\U00000020','\U00000020'}, 
+	    { '\U0000002A','\U00002550','\U0000002A','\U00002550','\U00002550','\U0000002A','\U00002550','\U00002550','\U0000002A','\U00002550','\U0000002A','\U00002550','\U0000002A'}},
+	   {{ '\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U0000002A','\U00000020','\U0000002A','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'}, 
+	    { '\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U0000002A','\U00000020','\U0000002A','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'}, 
+	    { '\U00000020','\U00000020','\U00000020','\U0000002A','\U0000005C','\U0000002A','\U0000002A','\U00000020','\U0000002F','\U00000020','\U0000002A','\U00000020','\U00000020'}, 
+	    { '\U00000020','\U0000002A','\U00000020','\U00000020','\U00000020','\U0000002A','\U00000020','\U00000020','\U0000002A','\U00000020','\U0000002A','\U00000020','\U0000002A'}},
+	  {{ '\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'}, 
+	    { '\U00000020','\U00000020','\U00000020','\U0000002A','\U0000005C','\U0000002A','\U0000002A','\U00000020','\U0000002F','\U00000020','\U0000002A','\U00000020','\U00000020'}, 
+	    { '\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U0000002A','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'}, 
+	    { '\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U0000002A','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020','\U00000020'}}}
+)
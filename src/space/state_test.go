@@ -0,0 +1,98 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package space
+
+import (
+	"sync"
+	"testing"
+)
+
+const (
+	STATE_TICKS    = 400
+	STATE_KEYS     = "aassxz  aa  sxr"
+	STATE_CHANGES  = 50
+)
+
+// TestConcurrentPlay drives a round from all the goroutines the game
+// runs, the way play does; run it with -race to check that they only
+// meet under the lock.
+func TestConcurrentPlay(t *testing.T) {
+	p := NewHeadless(35, 100, 1, "NORMAL")
+
+	var (
+		wg       sync.WaitGroup
+		rendered = make(chan struct{})
+	)
+	go func() {
+		p.Render(p.session.ctx)
+		close(rendered)
+	}()
+
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < STATE_TICKS; i++ {
+			p.Lock()
+			p.Tick()
+			p.Unlock()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < len(STATE_KEYS); i++ { p.roundKey(STATE_KEYS[i]) }
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < STATE_CHANGES; i++ {
+			for _, s := range settings[:4] { p.changeSetting(s, DIR_RIGHT) }
+			p.Lock()
+			p.restart(false)
+			p.Unlock()
+		}
+	}()
+	wg.Wait()
+
+	p.session.cancel()
+	<- rendered
+
+	p.Lock()
+	defer p.Unlock()
+	if p.Ticks() != STATE_TICKS { t.Errorf("%d ticks, want %d", p.Ticks(), STATE_TICKS) }
+}
+
+// The key bindings are read by the input goroutine while the settings
+// screen changes them.
+func TestConcurrentKeyBinding(t *testing.T) {
+	p := NewHeadless(35, 100, 1, "NORMAL")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < STATE_CHANGES; i++ { p.roundKey('q') }
+	}()
+
+	for i := 0; i < STATE_CHANGES; i++ {
+		p.keys <- byte('b' + i % 2)
+		p.bindKey(&p.keymap.Quit, "quit")
+	}
+	<- done
+
+	if p.roundKey('c') != FINISH_QUIT { t.Errorf("quit is %q, want 'c'", p.keymap.Quit) }
+}
@@ -0,0 +1,85 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package space
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	VERIFY_MAX_TIME  = 2 * time.Hour
+	VERIFY_MAX_ROWS  = 500
+	VERIFY_MAX_COLS  = 1000
+)
+
+// Causes tells what ended a round, for people.
+var Causes = map[string]string{
+	CAUSE_LANDED: "an enemy landed",
+	CAUSE_RAMMED: "an enemy crashed into the ship",
+	CAUSE_SHOT:   "the shield was shot through",
+	CAUSE_QUIT:   "left by the player",
+}
+
+// A Verdict is what a replayed round comes to, and what ended it. Keys
+// counts the keys of the replay that were played; those after them
+// did not matter.
+type Verdict struct {
+	Points     int
+	Level      int
+	Ticks      int64
+	Cause      string
+	Keys       int
+}
+
+// Verify plays the round of a replay again, headless and as fast as it
+// can, until the ship is destroyed or up to where the recording ended,
+// and tells what the round truly came to. A round that lasts more than
+// VERIFY_MAX_TIME is an error.
+func Verify(r *Replay) (Verdict, error) {
+	if r.Rows < MIN_ROWS || r.Cols < MIN_COLS || r.Rows > VERIFY_MAX_ROWS || r.Cols > VERIFY_MAX_COLS {
+		return Verdict{}, fmt.Errorf("a replay of a %dx%d terminal cannot be verified", r.Cols, r.Rows)
+	}
+	if _, ok := DifficultyByName(r.Difficulty); !ok { return Verdict{}, fmt.Errorf("unknown difficulty %q", r.Difficulty) }
+
+	p := NewHeadless(r.Rows, r.Cols, r.Seed, r.Difficulty)
+	p.replay = r
+	for r.End == nil || p.ticks < r.End.Tick {
+		if p.Tick() != FINISH_NONE { break }
+		if p.ticks >= ticks(VERIFY_MAX_TIME) { return Verdict{}, fmt.Errorf("the round lasts more than %v", VERIFY_MAX_TIME) }
+	}
+	return Verdict{ Points: p.score, Level: p.level, Ticks: p.ticks, Cause: p.roundCause(), Keys: p.replayPos }, nil
+}
+
+// Mismatch tells how the verdict differs from the end claimed, as the
+// one a replay tells, if it does.
+func (v Verdict) Mismatch(end *ReplayEnd) error {
+	switch {
+		case end == nil:
+			return nil
+		case v.Points != end.Points || v.Level != end.Level:
+			return fmt.Errorf("%d points at level %d claimed, the round makes %d at level %d",
+			                  end.Points, end.Level, v.Points, v.Level)
+		case v.Cause != end.Cause:
+			return fmt.Errorf("the round claimed to end with %q ends with %q", end.Cause, v.Cause)
+	}
+	return nil
+}
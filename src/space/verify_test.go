@@ -0,0 +1,79 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package space
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// recordRound plays p to the game over, aiming like the demo, with a
+// recording, and reads the replay back.
+func recordRound(t *testing.T, p *Playground) *Replay {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "round.replay")
+	p.opts.Record = path
+	if err := p.startRecording(); err != nil { t.Fatal(err) }
+
+	for !p.awaitRestart {
+		if p.ticks % ticks(DEMO_STEP) == 0 {
+			switch target, gun := p.demoTarget(), p.curCol + COL_START_LIMIT; {
+				case target < 0:
+				case target < gun:
+					p.Press(p.keymap.Left)
+				case target > gun:
+					p.Press(p.keymap.Right)
+				default:
+					p.Press(p.keymap.Fire)
+			}
+		}
+		p.Tick()
+		if p.ticks > ticks(VERIFY_MAX_TIME) { t.Fatal("the round does not end") }
+	}
+	p.endRound()
+	if p.score == 0 { t.Fatal("the round scored nothing") }
+
+	replay, err := LoadReplay(path)
+	if err != nil { t.Fatal(err) }
+	return replay
+}
+
+// A round played on a key map of its own is played again the same by
+// Verify, which finds its score.
+func TestVerify(t *testing.T) {
+	p := NewHeadless(35, 100, 7, "HARD")
+	p.keymap = KeyMap{ Left: 'j', Right: 'k', JumpLeft: 'h', JumpRight: 'l', Fire: 'f', Quit: 'Q', Restart: 'R', Debug: 'D' }
+	replay := recordRound(t, p)
+
+	verdict, err := Verify(replay)
+	if err != nil { t.Fatal(err) }
+	if verdict.Points != p.score || verdict.Level != p.level || verdict.Cause != p.cause || p.cause == "" {
+		t.Errorf("the replay made %+v, the round %d at level %d, %q", verdict, p.score, p.level, p.cause)
+	}
+	if err := verdict.Mismatch(replay.End); err != nil { t.Error(err) }
+
+	replay.Keys = replay.Keys[:len(replay.Keys) / 2]
+	cut, err := Verify(replay)
+	if err != nil { t.Fatal(err) }
+	if cut.Mismatch(replay.End) == nil { t.Errorf("half the keys made %+v too", cut) }
+	replay.Rows = MIN_ROWS - 1
+	if _, err := Verify(replay); err == nil { t.Error("a replay of a small terminal was verified") }
+}
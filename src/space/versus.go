@@ -0,0 +1,395 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package space
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// In a versus match each player plays their own rounds and the two
+// games only tell each other what matters to the match, a line at a
+// time: "READY n" when the player is ready for round n, "SEND n" for n
+// invaders to add to the wave of the rival, VERSUS_SEND or
+// VERSUS_BOSS_SEND and nothing else, "END tick score" when the
+// round is over, tick being when the ship was destroyed, 0 if it was
+// not, and "BYE" once the match is decided. The first ship destroyed
+// loses the round; a connection closed before BYE forfeits the match.
+const (
+	VERSUS_MAGIC     = "SYSTEMINVADERS-VERSUS"
+	VERSUS_VERSION   = 1
+	VERSUS_ROUNDS    = 3
+	VERSUS_SEND      = 1
+	VERSUS_BOSS_SEND = 3
+	VERSUS_LINES     = 64
+	VERSUS_WAIT      = "WAITING FOR THE OTHER PLAYER"
+	VERSUS_LEFT      = "the other player left the match"
+	VERSUS_BROKEN    = "the other player broke the rules of the match"
+)
+
+const (
+	ROUND_DRAW = iota
+	ROUND_WON
+	ROUND_LOST
+)
+
+// A rival is the other player of a versus match. Lines are sent by a
+// goroutine of their own, so that the round never waits on the
+// network. The counts are guarded by the lock of the playground.
+type rival struct {
+	conn                      net.Conn
+	in                        *bufio.Reader
+	out                       chan string
+	ready                     chan int
+	ended                     chan roundEnd
+	seed                      int64
+	rounds                    int
+	wins, losses              int
+	sent, received            int
+	bye                       atomic.Bool
+}
+
+type roundEnd struct {
+	tick                      int64
+	score                     int
+}
+
+func newRival(conn net.Conn, in *bufio.Reader, seed int64, rounds int) *rival {
+	return &rival{ conn: conn, in: in, seed: seed, rounds: rounds,
+	               out: make(chan string, VERSUS_LINES), ready: make(chan int, 1), ended: make(chan roundEnd, 1) }
+}
+
+// post queues a line for the rival; should the connection be that far
+// behind, the line is dropped.
+func (r *rival) post(format string, args ...interface{}) {
+	select {
+		case r.out <- fmt.Sprintf(format, args...) + "\n":
+		default:
+	}
+}
+
+// attack sends invaders for an enemy destroyed. The caller must hold
+// the lock of the playground.
+func (r *rival) attack(boss bool) {
+	n := VERSUS_SEND
+	if boss { n = VERSUS_BOSS_SEND }
+	r.sent += n
+	r.post("SEND %d", n)
+}
+
+// writeLines sends the lines as they are posted. It owns the
+// connection: the lines still queued when ctx is cancelled are sent
+// before it is closed.
+func (r *rival) writeLines(ctx context.Context) {
+	defer r.conn.Close()
+	for {
+		select {
+			case <- ctx.Done():
+				r.conn.SetWriteDeadline(time.Now().Add(COOP_WRITE_TIMEOUT))
+				for len(r.out) > 0 { r.conn.Write([]byte(<- r.out)) }
+				return
+			case line := <- r.out:
+				if _, err := r.conn.Write([]byte(line)); err != nil { return }
+		}
+	}
+}
+
+// Versus plays a best-of-n match against another player, hosting it
+// with opts.Host or joining the one at opts.Rival. Both play the same
+// seeds, the host's, round after round.
+func (p *Playground) Versus() error {
+	defer p.session.crash()
+
+	p.openSounds()
+	p.session.Go(p.Events)
+	p.session.Go(p.JobControl)
+	p.session.Go(p.Render)
+	p.session.Go(p.ReadKeys)
+	defer p.closeSounds()
+	defer p.session.Stop()
+
+	r, err := p.meetRival()
+	if err != nil || r == nil { return err }
+
+	p.Lock()
+	p.rival = r
+	p.Unlock()
+	p.session.Go(r.writeLines)
+	p.session.Go(p.readRival)
+
+	need := r.rounds / 2 + 1
+	for round := 1; r.wins < need && r.losses < need; round++ {
+		if !p.readyRound(round) { return p.Err() }
+
+		finish := p.PlayRound()
+		if finish != FINISH_LOST && finish != FINISH_WON { return p.Err() }
+
+		p.Lock()
+		mine := roundEnd{ p.diedAt, p.score }
+		p.Unlock()
+		r.post("END %d %d", mine.tick, mine.score)
+
+		var theirs roundEnd
+		select {
+			case theirs = <- r.ended:
+			case <- p.session.ctx.Done():
+				return p.Err()
+		}
+
+		result := roundResult(mine.tick, theirs.tick)
+		p.Lock()
+		switch result {
+			case ROUND_WON:  r.wins++
+			case ROUND_LOST: r.losses++
+		}
+		p.Unlock()
+		p.log.Info("versus round", "round", round, "result", result, "wins", r.wins, "losses", r.losses)
+
+		over := r.wins == need || r.losses == need
+		if over { r.post("BYE") }
+		p.showPage(resultTitle(result, over), []string{
+			fmt.Sprintf("MATCH  %d - %d", r.wins, r.losses),
+			"",
+			fmt.Sprintf("YOUR SCORE  %d", mine.score),
+			fmt.Sprintf("THEIR SCORE %d", theirs.score),
+		})
+		if p.session.ctx.Err() != nil { return p.Err() }
+	}
+	return p.Err()
+}
+
+// roundResult compares when the two ships were destroyed, 0 being
+// never: the first one loses, at the same tick it is a draw and the
+// round is played again.
+func roundResult(mine, theirs int64) int {
+	switch {
+		case mine != 0 && (theirs == 0 || mine < theirs):
+			return ROUND_LOST
+		case theirs != 0 && (mine == 0 || theirs < mine):
+			return ROUND_WON
+	}
+	return ROUND_DRAW
+}
+
+func resultTitle(result int, over bool) string {
+	switch {
+		case result == ROUND_DRAW:
+			return "DRAW"
+		case over && result == ROUND_WON:
+			return "YOU WIN THE MATCH"
+		case over:
+			return "YOU LOSE THE MATCH"
+		case result == ROUND_WON:
+			return "YOU WIN THE ROUND"
+	}
+	return "YOU LOSE THE ROUND"
+}
+
+// meetRival waits for the other player on the port of the host, or
+// joins the host; it is nil if the host gave up waiting.
+func (p *Playground) meetRival() (*rival, error) {
+	if p.listener == nil { return p.joinRival() }
+
+	met := make(chan *rival, 1)
+	p.session.Go(func(ctx context.Context) { p.acceptRival(ctx, met) })
+
+	lines := []string{ "Join from another terminal with", "", "systemInvaders versus " + p.joinAddr() }
+	for {
+		p.drawPage(WAIT_TITLE, WAIT_FOOTER, lines)
+		select {
+			case r := <- met:
+				return r, nil
+			case <- p.resized:
+			case <- p.keys:
+				return nil, nil
+			case <- p.session.ctx.Done():
+				return nil, p.Err()
+		}
+	}
+}
+
+// acceptRival takes the first player to say "SYSTEMINVADERS-VERSUS 1",
+// answering "OK ROUNDS SEED DIFFICULTY", and closes the port.
+func (p *Playground) acceptRival(ctx context.Context, met chan<- *rival) {
+	defer context.AfterFunc(ctx, func() { p.listener.Close() })()
+
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil { p.end(&Error{ NET_ERROR, err }) }
+			return
+		}
+
+		var (
+			in             = bufio.NewReader(conn)
+			magic          string
+			version        int
+		)
+		conn.SetDeadline(time.Now().Add(COOP_TIMEOUT))
+		line, err := readLine(in, COOP_LINE)
+		if err == nil { _, err = fmt.Sscanf(line, "%s %d", &magic, &version) }
+		if err != nil || magic != VERSUS_MAGIC || version != VERSUS_VERSION {
+			fmt.Fprintf(conn, "ERROR not a %s %d client\n", VERSUS_MAGIC, VERSUS_VERSION)
+			conn.Close()
+			continue
+		}
+
+		rounds := p.opts.Rounds
+		if rounds <= 0 { rounds = VERSUS_ROUNDS }
+		p.Lock()
+		r := newRival(conn, in, p.seed, rounds)
+		fmt.Fprintf(conn, "OK %d %d %s\n", r.rounds, r.seed, p.Difficulty().Name)
+		p.Unlock()
+		conn.SetDeadline(time.Time{})
+		p.log.Info("rival joined", "addr", conn.RemoteAddr().String(), "rounds", r.rounds)
+
+		p.listener.Close()
+		met <- r
+		return
+	}
+}
+
+// joinRival joins the match hosted at opts.Rival, which sets the
+// rounds, the seed and the difficulty.
+func (p *Playground) joinRival() (*rival, error) {
+	conn, err := net.DialTimeout("tcp", p.opts.Rival, COOP_TIMEOUT)
+	if err != nil { return nil, &Error{ NET_ERROR, err } }
+
+	conn.SetDeadline(time.Now().Add(COOP_TIMEOUT))
+	fmt.Fprintf(conn, "%s %d\n", VERSUS_MAGIC, VERSUS_VERSION)
+	in := bufio.NewReader(conn)
+	answer, err := readLine(in, COOP_LINE)
+
+	var (
+		rounds     int
+		seed       int64
+		difficulty string
+	)
+	if err == nil { _, err = fmt.Sscanf(answer, "OK %d %d %s", &rounds, &seed, &difficulty) }
+	if err != nil {
+		conn.Close()
+		why := strings.Map(printable, strings.TrimSpace(strings.TrimPrefix(answer, "ERROR")))
+		return nil, errorf(NET_ERROR, "the host refused the match: %s", why)
+	}
+	conn.SetDeadline(time.Time{})
+
+	p.Lock()
+	p.seed = seed
+	p.SetDifficulty(difficulty)
+	p.Unlock()
+	p.log.Info("joined the match", "addr", p.opts.Rival, "rounds", rounds)
+	return newRival(conn, in, seed, rounds), nil
+}
+
+// readRival applies the lines of the rival until the connection ends,
+// which ends the game unless the rival said BYE.
+func (p *Playground) readRival(ctx context.Context) {
+	r := p.rival
+	defer context.AfterFunc(ctx, func() { r.conn.SetReadDeadline(time.Now()) })()
+
+	for {
+		line, err := readLine(r.in, COOP_LINE)
+		if err != nil {
+			if ctx.Err() == nil && !r.bye.Load() { p.end(errorf(NET_ERROR, VERSUS_LEFT)) }
+			return
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 1 && fields[0] == "BYE" { r.bye.Store(true) }
+		if len(fields) < 2 { continue }
+		n, _ := strconv.ParseInt(fields[1], 10, 64)
+		switch fields[0] {
+			case "READY":
+				select {
+					case r.ready <- int(n):
+					case <- ctx.Done():
+						return
+				}
+			case "SEND":
+				if n != VERSUS_SEND && n != VERSUS_BOSS_SEND {
+					p.end(errorf(NET_ERROR, "%s: SEND %s", VERSUS_BROKEN, strings.Map(printable, fields[1])))
+					return
+				}
+				p.Lock()
+				p.receiveInvaders(int(n))
+				p.Unlock()
+			case "END":
+				var end roundEnd
+				fmt.Sscanf(line, "END %d %d", &end.tick, &end.score)
+				p.Lock()
+				if p.playing && !p.stop && p.finish == FINISH_NONE { p.finish, p.finishAt = FINISH_WON, p.ticks }
+				p.Unlock()
+				select {
+					case r.ended <- end:
+					case <- ctx.Done():
+						return
+				}
+		}
+	}
+}
+
+// receiveInvaders makes the wave under way longer. The caller must hold
+// the lock.
+func (p *Playground) receiveInvaders(n int) {
+	if !p.playing || p.stop { return }
+	p.wave.enemies += n
+	p.rival.received += n
+	p.event(slog.LevelInfo, "invaders received", "count", n, "enemies", p.wave.enemies)
+	p.drawHud()
+}
+
+// readyRound waits for both players to be ready for the round.
+func (p *Playground) readyRound(round int) bool {
+	r := p.rival
+	title := fmt.Sprintf("ROUND %d", round)
+	lines := []string{ fmt.Sprintf("BEST OF %d", r.rounds), "", fmt.Sprintf("MATCH  %d - %d", r.wins, r.losses) }
+
+	for mine, theirs := false, false; !mine || !theirs; {
+		footer := "Press any key when ready"
+		if mine { footer = VERSUS_WAIT }
+		p.drawPage(title, footer, lines)
+
+		select {
+			case k, ok := <- p.keys:
+				if !ok || k == p.keymap.Quit { return false }
+				if !mine { r.post("READY %d", round) }
+				mine = true
+			case n := <- r.ready:
+				theirs = theirs || n == round
+			case <- p.resized:
+			case <- p.session.ctx.Done():
+				return false
+		}
+	}
+	return true
+}
+
+func (p *Playground) matchScore() string {
+	if p.rival == nil { return "" }
+	return fmt.Sprintf("MATCH: %d-%d SENT: %d", p.rival.wins, p.rival.losses, p.rival.sent)
+}
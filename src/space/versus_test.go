@@ -0,0 +1,152 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package space
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoundResult(t *testing.T) {
+	for _, c := range []struct {
+		mine, theirs int64
+		want         int
+	}{
+		{ 100, 0, ROUND_LOST },
+		{ 0, 100, ROUND_WON },
+		{ 90, 100, ROUND_LOST },
+		{ 100, 90, ROUND_WON },
+		{ 100, 100, ROUND_DRAW },
+		{ 0, 0, ROUND_DRAW },
+	} {
+		if got := roundResult(c.mine, c.theirs); got != c.want { t.Errorf("roundResult(%d, %d) = %d, want %d", c.mine, c.theirs, got, c.want) }
+	}
+}
+
+// versus starts a match of rounds between a host and a player who
+// joins it, each with a keyboard.
+func versus(t *testing.T, rounds int) (host, guest *Playground, hostKeys, guestKeys io.Writer, hostErr, guestErr <-chan error) {
+	t.Helper()
+	start := func(p *Playground) (io.Writer, <-chan error) {
+		in, keys := io.Pipe()
+		p.in = in
+		t.Cleanup(func() { keys.Close() })
+		done := make(chan error, 1)
+		go func() { done <- p.Versus() }()
+		return keys, done
+	}
+
+	host = NewHeadless(35, 100, 1, "EASY")
+	host.opts.Rounds = rounds
+	if err := host.listen("127.0.0.1:0"); err != nil { t.Fatal(err) }
+	guest = NewHeadless(35, 100, 2, "HARD")
+	guest.opts.Rival = host.listener.Addr().String()
+
+	hostKeys, hostErr = start(host)
+	guestKeys, guestErr = start(guest)
+	for _, p := range []*Playground{ host, guest } {
+		waitFor(t, p, "the rival", func() bool { return p.rival != nil })
+	}
+	return
+}
+
+func waitErr(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+		case err := <- done:
+			return err
+		case <- time.After(PLAY_TIMEOUT):
+			t.Fatal("Versus did not return")
+	}
+	return nil
+}
+
+// The guest plays the seeds and the difficulty of the host, sends it
+// invaders, and wins the match when the ship of the host goes first.
+func TestVersusMatch(t *testing.T) {
+	host, guest, hostKeys, guestKeys, hostErr, guestErr := versus(t, 1)
+	hostKeys.Write([]byte(" "))
+	guestKeys.Write([]byte(" "))
+	waitRounds(t, host, 1)
+	waitRounds(t, guest, 1)
+
+	guest.Lock()
+	if guest.seed != host.rival.seed || guest.Difficulty().Name != "EASY" { t.Errorf("the guest plays seed %d at %s", guest.seed, guest.Difficulty().Name) }
+	guest.credit(&enemy{}, STD_ENEM_POINT)
+	guest.Unlock()
+	waitFor(t, host, "the invaders sent by the guest", func() bool {
+		return host.rival.received == VERSUS_SEND && host.wave.enemies == host.Difficulty().EnemyGroup + VERSUS_SEND
+	})
+	waitFor(t, host, "the match in the HUD", func() bool { return strings.Contains(host.Screen()[host.termRow - HUD_ROWS], "MATCH: 0-0") })
+
+	host.Lock()
+	host.critical(CAUSE_SHOT)
+	host.Unlock()
+	waitFor(t, host, "the lost round", func() bool { return host.rival.losses == 1 })
+	waitFor(t, guest, "the won round", func() bool { return guest.rival.wins == 1 })
+	waitFor(t, guest, "the result", func() bool { return strings.Contains(guest.String(), "YOU WIN THE MATCH") })
+
+	hostKeys.Write([]byte(" "))
+	guestKeys.Write([]byte(" "))
+	if err := waitErr(t, hostErr); err != nil { t.Errorf("host: %v", err) }
+	if err := waitErr(t, guestErr); err != nil { t.Errorf("guest: %v", err) }
+}
+
+// Leaving in the middle of a match forfeits it.
+func TestVersusForfeit(t *testing.T) {
+	host, _, hostKeys, guestKeys, hostErr, guestErr := versus(t, 3)
+	hostKeys.Write([]byte(" "))
+	guestKeys.Write([]byte(" "))
+	waitRounds(t, host, 1)
+
+	guestKeys.Write([]byte("q"))
+	if err := waitErr(t, guestErr); err != nil { t.Errorf("guest: %v", err) }
+	if err := waitErr(t, hostErr); ExitCode(err) != NET_ERROR || !strings.Contains(err.Error(), VERSUS_LEFT) { t.Errorf("host: %v", err) }
+}
+
+// A rival can only send the invaders of the rules; anything else ends
+// the match.
+func TestVersusBadSend(t *testing.T) {
+	for _, send := range []string{ "0", "2", "-1", "1000000", "x" } {
+		host := NewHeadless(35, 100, 1, "EASY")
+		if err := host.listen("127.0.0.1:0"); err != nil { t.Fatal(err) }
+		in, keys := io.Pipe()
+		host.in = in
+		done := make(chan error, 1)
+		go func() { done <- host.Versus() }()
+
+		conn, err := net.Dial("tcp", host.listener.Addr().String())
+		if err != nil { t.Fatal(err) }
+		fmt.Fprintf(conn, "%s %d\n", VERSUS_MAGIC, VERSUS_VERSION)
+		if answer, _ := bufio.NewReader(conn).ReadString('\n'); !strings.HasPrefix(answer, "OK") { t.Fatalf("the host answered %q", answer) }
+		fmt.Fprintf(conn, "SEND %s\n", send)
+
+		if err := waitErr(t, done); ExitCode(err) != NET_ERROR || !strings.Contains(err.Error(), VERSUS_BROKEN) { t.Errorf("SEND %s: %v", send, err) }
+		if host.wave.enemies > host.Difficulty().EnemyGroup { t.Errorf("SEND %s: %d invaders in the wave", send, host.wave.enemies) }
+		conn.Close()
+		keys.Close()
+	}
+}
@@ -0,0 +1,234 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package space
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The keys and the pace of the replay viewer; the quit and debug keys
+// keep their use.
+const (
+	VIEW_PAUSE       = 'p'
+	VIEW_PAUSE_ALT   = ' '
+	VIEW_SLOWER      = '-'
+	VIEW_FASTER      = '+'
+	VIEW_FASTER_ALT  = '='
+	VIEW_STEP        = '.'
+	VIEW_BACK        = ','
+	VIEW_REWIND      = '['
+	VIEW_FORWARD     = ']'
+	VIEW_SEEK_STEP   = 10 * time.Second
+	VIEW_SNAPSHOTS   = 200
+	VIEW_KEY_HOLD    = 10
+	VIEW_STD_SPEED   = 2
+	VIEW_HELP        = "p pause  -/+ speed  ,/. step  [/] 0-9 seek"
+)
+
+var ReplaySpeeds = []float64{ 0.25, 0.5, 1, 2, 4, 8 }
+
+// A viewer plays a replay back under the control of the player: at a
+// speed of ReplaySpeeds, paused, a tick at a time, or from any tick,
+// which the round is taken to from the snapshot taken before it, one
+// every VIEW_SNAPSHOTS ticks. At the end of the replay it pauses. The
+// keys of the replay are shown as they are taken.
+type viewer struct {
+	speed       int
+	paused      bool
+	over        bool
+	overAt      int64
+	snapshots   []snapshot
+	key         byte
+	keyAt       int64
+	changed     chan struct{}
+}
+
+// startViewer sets the viewer up at the start of the round. The caller
+// must hold the lock.
+func (p *Playground) startViewer() {
+	p.viewer = &viewer{ speed: VIEW_STD_SPEED, changed: make(chan struct{}, 1) }
+	p.viewer.snapshots = append(p.viewer.snapshots, p.snapshot())
+}
+
+// wake tells the round goroutine that the pace changed.
+func (v *viewer) wake() {
+	select {
+		case v.changed <- struct{}{}:
+		default:
+	}
+}
+
+func (v *viewer) delay() time.Duration {
+	return time.Duration(float64(TICK) / ReplaySpeeds[v.speed])
+}
+
+// replayLength is how many ticks the replay lasts, as far as it is known.
+func (p *Playground) replayLength() int64 {
+	switch v, r := p.viewer, p.replay; {
+		case r.End != nil:
+			return r.End.Tick
+		case v.over:
+			return v.overAt
+		case len(r.Keys) > 0:
+			return r.Keys[len(r.Keys) - 1].Tick
+	}
+	return 0
+}
+
+// runReplay plays the replay back at the pace of the viewer until ctx
+// is cancelled, or the round restarts, as it does when the terminal
+// is resized.
+func (p *Playground) runReplay(ctx context.Context) int {
+	next := time.Now()
+	for {
+		p.lock()
+		v := p.viewer
+		paused, delay := v.paused, v.delay()
+		p.Unlock()
+
+		var tick <-chan time.Time
+		if !paused { tick = time.After(time.Until(next.Add(delay))) }
+		select {
+			case <- ctx.Done():
+				return FINISH_QUIT
+			case <- v.changed:
+				next = time.Now()
+				continue
+			case <- tick:
+				next = next.Add(delay)
+		}
+
+		if finish := p.lockedTick(p.replayTick); finish != FINISH_NONE { return finish }
+	}
+}
+
+// replayTick plays the replay a tick on, unless it is over, taking the
+// snapshots on the way. The caller must hold the lock.
+func (p *Playground) replayTick() int {
+	v := p.viewer
+	if v.over { return FINISH_NONE }
+
+	pos := p.replayPos
+	finish := p.Tick()
+	if p.replayPos > pos { v.key, v.keyAt = p.replay.Keys[p.replayPos - 1].Key, p.ticks }
+
+	switch {
+		case finish == FINISH_RESTART:
+			return finish
+		case finish != FINISH_NONE || p.replay.End != nil && p.ticks >= p.replay.End.Tick:
+			v.over, v.overAt, v.paused = true, p.ticks, true
+			p.event(slog.LevelInfo, "replay over", "tick", p.ticks)
+		case p.ticks == int64(len(v.snapshots)) * VIEW_SNAPSHOTS:
+			v.snapshots = append(v.snapshots, p.snapshot())
+	}
+	return FINISH_NONE
+}
+
+// seek takes the replay to tick, or as near as it goes, from the last
+// snapshot before it when it is behind. The snapshots are of the size
+// of the replay: once the terminal is resized, there is no seeking.
+// The caller must hold the lock.
+func (p *Playground) seek(tick int64) {
+	v := p.viewer
+	if p.termRow != p.replay.Rows || p.termCol != p.replay.Cols { return }
+	if tick < 0 { tick = 0 }
+	if n := p.replayLength(); (v.over || p.replay.End != nil) && tick > n { tick = n }
+
+	i := int(tick / VIEW_SNAPSHOTS)
+	if i >= len(v.snapshots) { i = len(v.snapshots) - 1 }
+	if tick < p.ticks || v.snapshots[i].ticks > p.ticks {
+		p.restore(v.snapshots[i])
+		v.over, v.key = false, 0
+	}
+	for p.ticks < tick && !v.over {
+		p.replayTick()
+	}
+	p.dirty = true
+}
+
+// viewKey is the control of the viewer by the key k. The caller must
+// hold the lock.
+func (p *Playground) viewKey(k byte) {
+	v := p.viewer
+	switch {
+		case k == VIEW_PAUSE || k == VIEW_PAUSE_ALT:
+			v.paused = !v.paused && !v.over
+		case k == VIEW_SLOWER && v.speed > 0:
+			v.speed--
+		case k == VIEW_FASTER || k == VIEW_FASTER_ALT:
+			if v.speed < len(ReplaySpeeds) - 1 { v.speed++ }
+		case k == VIEW_STEP:
+			v.paused = true
+			p.seek(p.ticks + 1)
+		case k == VIEW_BACK:
+			v.paused = true
+			p.seek(p.ticks - 1)
+		case k == VIEW_REWIND:
+			p.seek(p.ticks - ticks(VIEW_SEEK_STEP))
+		case k == VIEW_FORWARD:
+			p.seek(p.ticks + ticks(VIEW_SEEK_STEP))
+		case k >= '0' && k <= '9':
+			p.seek(p.replayLength() * int64(k - '0') / 10)
+		default:
+			return
+	}
+	p.dirty = true
+	v.wake()
+}
+
+// viewerBar is the status of the viewer, drawn over the top row: the
+// state, the speed, the time and the key just taken.
+func (p *Playground) viewerBar() string {
+	v := p.viewer
+	state := "▶"
+	switch {
+		case v.over:
+			state = "■ END"
+		case v.paused:
+			state = "‖ PAUSED"
+	}
+
+	bar := fmt.Sprintf("%s %sx  %s", state, strconv.FormatFloat(ReplaySpeeds[v.speed], 'f', -1, 64), tickTime(p.ticks))
+	if n := p.replayLength(); n > 0 { bar += " / " + tickTime(n) }
+	bar += fmt.Sprintf("  tick %d", p.ticks)
+	if v.key != 0 && p.ticks - v.keyAt < VIEW_KEY_HOLD { bar += "  KEY: " + strings.ToUpper(keyLabel(v.key)) }
+	return bar + "   " + VIEW_HELP
+}
+
+// keyLabel names the action of k, a key of the default key map.
+func keyLabel(k byte) string {
+	defaults := DefaultConfig().Keys
+	for _, action := range keyActions {
+		if *action.key(&defaults) == k { return action.label }
+	}
+	return keyName(k)
+}
+
+// tickTime is the time of the round at tick t, as mm:ss.cc.
+func tickTime(t int64) string {
+	d := time.Duration(t) * TICK
+	return fmt.Sprintf("%02d:%05.2f", int(d / time.Minute), (d % time.Minute).Seconds())
+}
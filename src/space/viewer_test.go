@@ -0,0 +1,97 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package space
+
+import (
+	"strings"
+	"testing"
+)
+
+// watch sets up the replay r in the viewer, as PlayRound does.
+func watch(r *Replay) *Playground {
+	p := &Playground{}
+	p.headless(r.Rows, r.Cols, r.Seed)
+	p.SetDifficulty(r.Difficulty)
+	p.replay = r
+	p.beginRound()
+	return p
+}
+
+// A replay plays to its end and pauses there, and seeking back and
+// forth, from the snapshots or a tick at a time, finds the round as it
+// was at each tick.
+func TestViewerSeek(t *testing.T) {
+	r := recordRound(t, NewHeadless(35, 100, 5, "HARD"))
+	p := watch(r)
+
+	screens := map[int64]string{}
+	for !p.viewer.over {
+		if p.replayTick() != FINISH_NONE { t.Fatal("the replay restarted") }
+		screens[p.ticks] = p.String()
+		if p.ticks > r.End.Tick { t.Fatal("the replay went past its end") }
+	}
+	if p.ticks != r.End.Tick || p.score != r.End.Points || !p.viewer.paused {
+		t.Fatalf("the replay ended at %d with %d points, paused %v, want %+v", p.ticks, p.score, p.viewer.paused, r.End)
+	}
+	if len(p.viewer.snapshots) != int((r.End.Tick - 1) / VIEW_SNAPSHOTS) + 1 { t.Errorf("%d snapshots over %d ticks", len(p.viewer.snapshots), r.End.Tick) }
+
+	for _, tick := range []int64{ r.End.Tick / 2, 1, VIEW_SNAPSHOTS, r.End.Tick - 1, VIEW_SNAPSHOTS + 7 } {
+		p.seek(tick)
+		if p.ticks != tick || p.String() != screens[tick] { t.Fatalf("seeking to tick %d found tick %d, another screen", tick, p.ticks) }
+	}
+	p.viewKey(VIEW_STEP)
+	if p.ticks != VIEW_SNAPSHOTS + 8 || p.String() != screens[p.ticks] { t.Errorf("a step went to tick %d", p.ticks) }
+	p.viewKey(VIEW_BACK)
+	p.viewKey(VIEW_BACK)
+	if p.ticks != VIEW_SNAPSHOTS + 6 || p.String() != screens[p.ticks] { t.Errorf("two steps back went to tick %d", p.ticks) }
+
+	p.viewKey('9')
+	if want := r.End.Tick * 9 / 10; p.ticks != want { t.Errorf("9 went to tick %d, want %d", p.ticks, want) }
+	p.seek(r.End.Tick + 100)
+	if p.ticks != r.End.Tick || p.score != r.End.Points || !p.viewer.over { t.Errorf("seeking past the end went to tick %d", p.ticks) }
+}
+
+// The speed and pause keys set the pace, within the speeds there are,
+// and the bar shows it with the keys of the replay as they are taken.
+func TestViewerControls(t *testing.T) {
+	r := recordRound(t, NewHeadless(35, 100, 5, "HARD"))
+	p := watch(r)
+	v := p.viewer
+
+	for i := 0; i < len(ReplaySpeeds); i++ { p.viewKey(VIEW_FASTER) }
+	if v.speed != len(ReplaySpeeds) - 1 { t.Errorf("speed %d after pressing faster", v.speed) }
+	for i := 0; i < len(ReplaySpeeds); i++ { p.viewKey(VIEW_SLOWER) }
+	if v.speed != 0 || v.delay() != 4 * TICK { t.Errorf("speed %d, a tick every %v after pressing slower", v.speed, v.delay()) }
+	p.viewKey(VIEW_PAUSE)
+	if !v.paused { t.Error("the pause key did not pause") }
+	p.viewKey(VIEW_PAUSE_ALT)
+	if v.paused { t.Error("the pause key did not resume") }
+
+	key := r.Keys[0]
+	p.seek(key.Tick)
+	bar := string(p.overlay()[0])
+	want := "KEY: " + strings.ToUpper(keyLabel(key.Key))
+	if !strings.HasPrefix(bar, "▶ 0.25x  00:") || !strings.Contains(bar, want) { t.Errorf("the bar is %q, want the key %q", bar, want) }
+	if p.screen[0][0] == []rune(bar)[0] { t.Error("the bar was drawn on the screen") }
+
+	p.seek(key.Tick + VIEW_KEY_HOLD)
+	if strings.Contains(string(p.overlay()[0]), "KEY:") && p.viewer.keyAt == key.Tick { t.Error("the key is still shown") }
+}
@@ -0,0 +1,68 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// LoadHostKey reads the host key of the server from the PEM file at
+// path, making a new one the first time: the clients remember it, so
+// it must stay the same from one run to the next.
+func LoadHostKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) { return newHostKey(path) }
+	if err != nil { return nil, err }
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" { return nil, fmt.Errorf("%s: not a PEM private key", path) }
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil { return nil, fmt.Errorf("%s: %v", path, err) }
+	ed, ok := key.(ed25519.PrivateKey)
+	if !ok { return nil, fmt.Errorf("%s: not an Ed25519 key", path) }
+	return ed, nil
+}
+
+func newHostKey(path string) (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil { return nil, err }
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil { return nil, err }
+
+	data := pem.EncodeToMemory(&pem.Block{ Type: "PRIVATE KEY", Bytes: der })
+	if err := os.WriteFile(path, data, 0600); err != nil { return nil, err }
+	return key, nil
+}
+
+// Fingerprint is the fingerprint of the key as ssh-keygen -l prints it.
+func Fingerprint(key ed25519.PrivateKey) string {
+	public, err := gossh.NewPublicKey(key.Public())
+	if err != nil { return "" }
+	return gossh.FingerprintSHA256(public)
+}
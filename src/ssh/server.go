@@ -0,0 +1,337 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+// Package ssh serves the game over SSH, on the transport and channels
+// of golang.org/x/crypto/ssh, vendored under src: a connection carries
+// one shell session, on the pseudo-terminal the client asks for.
+package ssh
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	LOGIN_TIMEOUT   = 30 * time.Second
+	CLOSE_TIMEOUT   = 5 * time.Second
+	INPUT_BUFFER    = 1024
+	MAX_SIZE        = 1000
+)
+
+var errClosed = errors.New("ssh: server closed")
+
+// A Server hands each shell session to Handler, in a goroutine of its
+// own; anybody may log in, with any name and no password. The exit
+// status of the session is what Handler returns.
+type Server struct {
+	HostKey   ed25519.PrivateKey
+	Handler   func(*Session) int
+
+	mu        sync.Mutex
+	config    *gossh.ServerConfig
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// Serve accepts the connections on ln until it is closed.
+func (s *Server) Serve(ln net.Listener) error {
+	signer, err := gossh.NewSignerFromKey(s.HostKey)
+	if err != nil { return err }
+	s.mu.Lock()
+	s.config = &gossh.ServerConfig{ NoClientAuth: true }
+	s.config.AddHostKey(signer)
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil { return err }
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return errClosed
+		}
+		if s.conns == nil { s.conns = make(map[net.Conn]struct{}) }
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serveConn(conn)
+	}
+}
+
+// Close drops every connection and waits for their sessions to end.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// serveConn runs the connection until the client leaves, opening its
+// session and refusing any other channel.
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	conn.SetDeadline(time.Now().Add(LOGIN_TIMEOUT))
+	sconn, channels, requests, err := gossh.NewServerConn(conn, s.config)
+	if err != nil { return }
+	go gossh.DiscardRequests(requests)
+
+	user := sconn.User()
+	if user == "" { user = "player" }
+
+	var sessions sync.WaitGroup
+	defer sessions.Wait()
+	opened := false
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" || opened {
+			newChannel.Reject(gossh.Prohibited, "only one session per connection")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil { return }
+		opened = true
+
+		session := newSession(conn, user, channel)
+		sessions.Add(1)
+		go func() {
+			defer sessions.Done()
+			session.serve(s.Handler, requests)
+		}()
+	}
+}
+
+// A Session is a shell session of a player: its input and output are
+// the keys and the screen of the pseudo-terminal asked by the client,
+// if any, whose type is Term.
+type Session struct {
+	User        string
+	Term        string
+	RemoteAddr  net.Addr
+
+	conn        net.Conn
+	channel     gossh.Channel
+
+	mu          sync.Mutex
+	rows, cols  int
+	deadline    chan struct{}
+	changed     chan struct{}
+	timer       *time.Timer
+
+	data        chan []byte
+	pending     []byte
+	eof         chan struct{}
+	done        chan struct{}
+	resized     chan struct{}
+}
+
+func newSession(conn net.Conn, user string, channel gossh.Channel) *Session {
+	s := &Session{
+		User:       user,
+		conn:       conn,
+		channel:    channel,
+		data:       make(chan []byte, 1),
+		eof:        make(chan struct{}),
+		done:       make(chan struct{}),
+		changed:    make(chan struct{}),
+		resized:    make(chan struct{}, 1),
+	}
+	if conn != nil { s.RemoteAddr = conn.RemoteAddr() }
+	return s
+}
+
+// Size is the size of the terminal, as last told by the client.
+func (s *Session) Size() (rows, cols int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rows, s.cols
+}
+
+// Resized receives a value when the client changes the size.
+func (s *Session) Resized() <-chan struct{} {
+	return s.resized
+}
+
+// Read returns the keys typed by the player, io.EOF once the client
+// closed its end.
+func (s *Session) Read(b []byte) (int, error) {
+	for len(s.pending) == 0 {
+		s.mu.Lock()
+		deadline, changed := s.deadline, s.changed
+		s.mu.Unlock()
+
+		select {
+			case data := <- s.data:
+				s.pending = data
+			case <- s.eof:
+				select {
+					case data := <- s.data:
+						s.pending = data
+					default:
+						return 0, io.EOF
+				}
+			case <- deadline:
+				return 0, os.ErrDeadlineExceeded
+			case <- changed:
+		}
+	}
+
+	n := copy(b, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// SetReadDeadline makes a pending Read, and the following ones, fail
+// at t, as for a net.Conn: changed wakes up the pending one.
+func (s *Session) SetReadDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.timer != nil { s.timer.Stop() }
+	s.timer = nil
+	close(s.changed)
+	s.changed = make(chan struct{})
+	switch {
+		case t.IsZero():
+			s.deadline = nil
+		case time.Until(t) <= 0:
+			s.deadline = make(chan struct{})
+			close(s.deadline)
+		default:
+			deadline := make(chan struct{})
+			s.deadline = deadline
+			s.timer = time.AfterFunc(time.Until(t), func() { close(deadline) })
+	}
+	return nil
+}
+
+// Write sends the output to the terminal, as fast as the client takes
+// it.
+func (s *Session) Write(b []byte) (int, error) {
+	return s.channel.Write(b)
+}
+
+// Close drops the connection of the session.
+func (s *Session) Close() error {
+	return s.conn.Close()
+}
+
+// serve answers the requests of the client for the session: the
+// pseudo-terminal, its size, and the shell, which starts the handler;
+// a size above MAX_SIZE is refused.
+// It returns once the channel and the goroutines of the session are
+// over.
+func (s *Session) serve(handler func(*Session) int, requests <-chan *gossh.Request) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	started := false
+	for req := range requests {
+		ok := true
+		switch req.Type {
+			case "pty-req":
+				var pty struct {
+					Term                       string
+					Cols, Rows, Width, Height  uint32
+					Modes                      string
+				}
+				ok = gossh.Unmarshal(req.Payload, &pty) == nil && pty.Rows <= MAX_SIZE && pty.Cols <= MAX_SIZE
+				if ok {
+					s.mu.Lock()
+					s.Term, s.rows, s.cols = pty.Term, int(pty.Rows), int(pty.Cols)
+					s.mu.Unlock()
+				}
+			case "window-change":
+				var size struct{ Cols, Rows, Width, Height uint32 }
+				ok = gossh.Unmarshal(req.Payload, &size) == nil && size.Rows <= MAX_SIZE && size.Cols <= MAX_SIZE
+				if ok {
+					s.mu.Lock()
+					s.rows, s.cols = int(size.Rows), int(size.Cols)
+					s.mu.Unlock()
+					select {
+						case s.resized <- struct{}{}:
+						default:
+					}
+				}
+			case "env":
+			case "shell", "exec":
+				ok = !started
+				if ok {
+					started = true
+					wg.Add(2)
+					go func() { defer wg.Done(); s.pump() }()
+					go func() { defer wg.Done(); s.run(handler) }()
+				}
+			default:
+				ok = false
+		}
+		if req.WantReply { req.Reply(ok, nil) }
+	}
+}
+
+// run runs the handler; when it returns, the client is given its exit
+// status and the channel is closed.
+func (s *Session) run(handler func(*Session) int) {
+	s.conn.SetDeadline(time.Time{})
+	status := handler(s)
+	close(s.done)
+
+	s.channel.SendRequest("exit-status", false, gossh.Marshal(struct{ Status uint32 }{ uint32(status) }))
+	s.channel.CloseWrite()
+	s.channel.Close()
+	s.conn.SetReadDeadline(time.Now().Add(CLOSE_TIMEOUT))
+}
+
+// pump hands the input of the channel over to Read, whose deadlines
+// the channel does not have; when the game does not keep up, the
+// window of the channel holds the client back.
+func (s *Session) pump() {
+	defer close(s.eof)
+	for {
+		buf := make([]byte, INPUT_BUFFER)
+		n, err := s.channel.Read(buf)
+		if n > 0 {
+			select {
+				case s.data <- buf[:n]:
+				case <- s.done:
+					return
+			}
+		}
+		if err != nil { return }
+	}
+}
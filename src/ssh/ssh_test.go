@@ -0,0 +1,259 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package ssh
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+	"terminal"
+)
+
+const (
+	WAIT_TIMEOUT = 10 * time.Second
+	SESSIONS     = 20
+)
+
+// A screen collects what the client prints.
+type screen struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *screen) Write(b []byte) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.buf.Write(b)
+}
+
+func (s *screen) waitText(t *testing.T, text string) {
+	t.Helper()
+	for deadline := time.Now().Add(WAIT_TIMEOUT); ; time.Sleep(20 * time.Millisecond) {
+		s.Lock()
+		out := s.buf.String()
+		s.Unlock()
+		if strings.Contains(out, text) { return }
+		if time.Now().After(deadline) { t.Fatalf("timed out waiting for %q, the client printed %q", text, out) }
+	}
+}
+
+// TestOpenSSH logs in with the OpenSSH client, on a pty of its own,
+// and checks the terminal, its resizing, the keys and the exit status.
+func TestOpenSSH(t *testing.T) {
+	if testing.Short() { t.Skip("needs the ssh client") }
+	client, err := exec.LookPath("ssh")
+	if err != nil { t.Skip("no ssh client") }
+
+	dir := t.TempDir()
+	key, err := LoadHostKey(filepath.Join(dir, "host_key"))
+	if err != nil { t.Fatal(err) }
+	again, err := LoadHostKey(filepath.Join(dir, "host_key"))
+	if err != nil || Fingerprint(again) != Fingerprint(key) { t.Fatalf("the host key changed: %v", err) }
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatal(err) }
+	server := &Server{ HostKey: key, Handler: func(s *Session) int {
+		rows, cols := s.Size()
+		fmt.Fprintf(s, "hello %s %s %dx%d\r\n", s.User, s.Term, cols, rows)
+		<- s.Resized()
+		rows, cols = s.Size()
+		fmt.Fprintf(s, "resized %dx%d\r\n", cols, rows)
+
+		k := make([]byte, 1)
+		if _, err := s.Read(k); err != nil { return 1 }
+		fmt.Fprintf(s, "key %c\r\n", k[0])
+		return 3
+	}}
+	go server.Serve(ln)
+	defer server.Close()
+	defer ln.Close()
+
+	master, slave, err := terminal.OpenPty()
+	if err != nil { t.Skipf("no pseudo-terminal: %v", err) }
+	defer master.Close()
+	if err := terminal.SetSize(int(master.Fd()), 30, 90); err != nil { t.Fatal(err) }
+
+	port := fmt.Sprint(ln.Addr().(*net.TCPAddr).Port)
+	cmd := exec.Command(client, "-tt", "-F", "/dev/null", "-p", port, "-o", "StrictHostKeyChecking=no",
+	                    "-o", "UserKnownHostsFile=/dev/null", "-o", "LogLevel=ERROR", "alice@127.0.0.1")
+	cmd.Env = []string{ "TERM=xterm", "HOME=" + dir, "PATH=/usr/bin:/bin" }
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{ Setsid: true, Setctty: true, Ctty: 0 }
+	if err := cmd.Start(); err != nil { t.Fatal(err) }
+	slave.Close()
+	defer cmd.Process.Kill()
+
+	var out screen
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := master.Read(buf)
+			out.Write(buf[:n])
+			if err != nil { return }
+		}
+	}()
+
+	out.waitText(t, "hello alice xterm 90x30")
+	if err := terminal.SetSize(int(master.Fd()), 40, 120); err != nil { t.Fatal(err) }
+	out.waitText(t, "resized 120x40")
+	master.Write([]byte("k"))
+	out.waitText(t, "key k")
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+		case err := <- done:
+			exit, ok := err.(*exec.ExitError)
+			if !ok || exit.ExitCode() != 3 { t.Errorf("the client ended with %v, want exit status 3", err) }
+		case <- time.After(WAIT_TIMEOUT):
+			t.Fatal("the client did not exit")
+	}
+}
+
+// A deadline set while a Read waits wakes it up, as the game does to
+// stop reading the keys.
+func TestReadDeadline(t *testing.T) {
+	s := newSession(nil, "alice", nil)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Read(make([]byte, 1))
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	s.SetReadDeadline(time.Now())
+	select {
+		case err := <- done:
+			if !errors.Is(err, os.ErrDeadlineExceeded) { t.Errorf("the read ended with %v", err) }
+		case <- time.After(WAIT_TIMEOUT):
+			t.Fatal("the read was not woken up")
+	}
+
+	s.SetReadDeadline(time.Time{})
+	s.data <- []byte("k")
+	k := make([]byte, 1)
+	if n, err := s.Read(k); n != 1 || err != nil || k[0] != 'k' { t.Errorf("read %q, %v", k[:n], err) }
+}
+
+// Sessions that come and go leave no goroutine behind, whether the
+// client leaves first or the game does.
+func TestNoLeak(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil { t.Fatal(err) }
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatal(err) }
+	defer ln.Close()
+	server := &Server{ HostKey: key, Handler: func(s *Session) int {
+		fmt.Fprintf(s, "hello %s\r\n", s.User)
+		k := make([]byte, 1)
+		if _, err := s.Read(k); err != nil || k[0] == 'q' { return 0 }
+		return 1
+	}}
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(ln) }()
+	before := runtime.NumGoroutine()
+
+	config := &gossh.ClientConfig{ User: "bob", HostKeyCallback: gossh.InsecureIgnoreHostKey() }
+	for i := 0; i < SESSIONS; i++ {
+		client, err := gossh.Dial("tcp", ln.Addr().String(), config)
+		if err != nil { t.Fatal(err) }
+		session, err := client.NewSession()
+		if err != nil { t.Fatal(err) }
+		var out screen
+		session.Stdout = &out
+		keys, err := session.StdinPipe()
+		if err != nil { t.Fatal(err) }
+		if err := session.RequestPty("xterm", 24, 80, nil); err != nil { t.Fatal(err) }
+		if err := session.Shell(); err != nil { t.Fatal(err) }
+		out.waitText(t, "hello bob")
+
+		if i % 2 == 0 {
+			keys.Write([]byte("q"))
+			if err := session.Wait(); err != nil { t.Errorf("session %d: %v", i, err) }
+		}
+		client.Close()
+	}
+
+	for deadline := time.Now().Add(WAIT_TIMEOUT); runtime.NumGoroutine() > before; time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1 << 20)
+			t.Fatalf("%d goroutines before the sessions, %d after:\n%s", before, runtime.NumGoroutine(), buf[:runtime.Stack(buf, true)])
+		}
+	}
+	server.Close()
+	ln.Close()
+	<- served
+}
+
+// A pseudo-terminal or a window larger than MAX_SIZE is refused, and
+// the session keeps the size it had.
+func TestSizeLimit(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil { t.Fatal(err) }
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatal(err) }
+	defer ln.Close()
+	server := &Server{ HostKey: key, Handler: func(s *Session) int {
+		rows, cols := s.Size()
+		fmt.Fprintf(s, "size %dx%d\r\n", cols, rows)
+		select {
+			case <- s.Resized():
+			case <- time.After(WAIT_TIMEOUT):
+				return 1
+		}
+		rows, cols = s.Size()
+		fmt.Fprintf(s, "resized %dx%d\r\n", cols, rows)
+		return 0
+	}}
+	go server.Serve(ln)
+	defer server.Close()
+
+	client, err := gossh.Dial("tcp", ln.Addr().String(), &gossh.ClientConfig{ User: "bob", HostKeyCallback: gossh.InsecureIgnoreHostKey() })
+	if err != nil { t.Fatal(err) }
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil { t.Fatal(err) }
+	var out screen
+	session.Stdout = &out
+
+	if err := session.RequestPty("xterm", 1 << 31, 1 << 31, nil); err == nil { t.Error("a huge pseudo-terminal was taken") }
+	if err := session.RequestPty("xterm", 35, 100, nil); err != nil { t.Fatal(err) }
+	if err := session.Shell(); err != nil { t.Fatal(err) }
+	out.waitText(t, "size 100x35")
+
+	if err := session.WindowChange(MAX_SIZE + 1, 100); err != nil { t.Fatal(err) }
+	if err := session.WindowChange(40, 120); err != nil { t.Fatal(err) }
+	out.waitText(t, "resized 120x40")
+}
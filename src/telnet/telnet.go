@@ -0,0 +1,364 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+// Package telnet is the server side of the TELNET protocol (RFC 854),
+// with the options a full-screen game needs: it echoes nothing, goes
+// character at a time and in 8 bits, and learns the type (RFC 1091)
+// and the size of the window (RFC 1073) of the terminal.
+package telnet
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	IAC   = 255
+	DONT  = 254
+	DO    = 253
+	WONT  = 252
+	WILL  = 251
+	SB    = 250
+	SE    = 240
+
+	OPT_BINARY = 0
+	OPT_ECHO   = 1
+	OPT_SGA    = 3
+	OPT_TTYPE  = 24
+	OPT_NAWS   = 31
+
+	TTYPE_IS   = 0
+	TTYPE_SEND = 1
+
+	DEFAULT_TERM      = "vt100"
+	DEFAULT_ROWS      = 24
+	DEFAULT_COLS      = 80
+	NEGOTIATE_TIMEOUT = 2 * time.Second
+	MAX_SUBOPTION     = 64
+	MAX_SIZE          = 1000
+)
+
+// The options the server does, and the ones it wants the client to do.
+var (
+	localOptions  = map[byte]bool{ OPT_BINARY: true, OPT_ECHO: true, OPT_SGA: true }
+	remoteOptions = map[byte]bool{ OPT_BINARY: true, OPT_SGA: true, OPT_TTYPE: true, OPT_NAWS: true }
+)
+
+// A Server hands each connection to Handler, in a goroutine of its
+// own, once the options are negotiated; the connection is closed when
+// Handler returns.
+type Server struct {
+	Handler   func(*Session)
+
+	mu        sync.Mutex
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// Serve accepts the connections on ln until it is closed.
+func (s *Server) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil { return err }
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return net.ErrClosed
+		}
+		if s.conns == nil { s.conns = make(map[net.Conn]struct{}) }
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serveConn(conn)
+	}
+}
+
+// Close drops every connection and waits for their sessions to end.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	session := newSession(conn)
+	if err := session.negotiate(); err != nil { return }
+	s.Handler(session)
+}
+
+// A Session is the terminal at the other end of a connection, of type
+// Term: its keys are read and its screen written with the protocol
+// taken care of. The state of the protocol belongs to the goroutine
+// that reads, mu guards the size.
+type Session struct {
+	Term        string
+	RemoteAddr  net.Addr
+
+	conn        net.Conn
+	r           *bufio.Reader
+	writeMu     sync.Mutex
+	state       int
+	option      byte
+	suboption   []byte
+	lastCR      bool
+	pending     []byte
+	local       [256]bool
+	remote      [256]bool
+	askedLocal  [256]bool
+	askedRemote [256]bool
+	named       bool
+
+	mu          sync.Mutex
+	rows, cols  int
+	sized       bool
+	resized     chan struct{}
+}
+
+// The states of the parser of the input.
+const (
+	STATE_DATA = iota
+	STATE_IAC
+	STATE_OPTION
+	STATE_SB
+	STATE_SB_DATA
+	STATE_SB_IAC
+)
+
+func newSession(conn net.Conn) *Session {
+	return &Session{
+		RemoteAddr: conn.RemoteAddr(),
+		conn:       conn,
+		r:          bufio.NewReader(conn),
+		rows:       DEFAULT_ROWS,
+		cols:       DEFAULT_COLS,
+		resized:    make(chan struct{}, 1),
+	}
+}
+
+// negotiate asks for the options and waits a little for the type and
+// the size of the terminal; a client that does not answer gets the
+// defaults. The keys typed meanwhile are kept.
+func (s *Session) negotiate() error {
+	var ask []byte
+	for _, opt := range []byte{ OPT_ECHO, OPT_SGA, OPT_BINARY } {
+		s.askedLocal[opt] = true
+		ask = append(ask, IAC, WILL, opt)
+	}
+	for _, opt := range []byte{ OPT_SGA, OPT_BINARY, OPT_TTYPE, OPT_NAWS } {
+		s.askedRemote[opt] = true
+		ask = append(ask, IAC, DO, opt)
+	}
+	if err := s.send(ask...); err != nil { return err }
+
+	s.conn.SetReadDeadline(time.Now().Add(NEGOTIATE_TIMEOUT))
+	defer s.conn.SetReadDeadline(time.Time{})
+	for !s.negotiated() {
+		c, err := s.r.ReadByte()
+		if ne, ok := err.(net.Error); ok && ne.Timeout() { break }
+		if err != nil { return err }
+		s.input(c)
+	}
+
+	// The type is the first one told; the size is known to the game.
+	s.named = true
+	if s.Term == "" { s.Term = DEFAULT_TERM }
+	select {
+		case <- s.resized:
+		default:
+	}
+	return nil
+}
+
+func (s *Session) negotiated() bool {
+	return (s.sized || !s.askedRemote[OPT_NAWS] && !s.remote[OPT_NAWS]) &&
+	       (s.named || !s.askedRemote[OPT_TTYPE] && !s.remote[OPT_TTYPE])
+}
+
+// Size is the size of the terminal, as last told by the client.
+func (s *Session) Size() (rows, cols int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rows, s.cols
+}
+
+// Resized receives a value when the client changes the size.
+func (s *Session) Resized() <-chan struct{} {
+	return s.resized
+}
+
+// Read returns the keys typed by the player.
+func (s *Session) Read(b []byte) (int, error) {
+	for len(s.pending) == 0 {
+		c, err := s.r.ReadByte()
+		if err != nil { return 0, err }
+		s.input(c)
+	}
+
+	n := copy(b, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+func (s *Session) SetReadDeadline(t time.Time) error {
+	return s.conn.SetReadDeadline(t)
+}
+
+// Write sends the output to the terminal, doubling the IAC bytes.
+func (s *Session) Write(b []byte) (int, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if _, err := s.conn.Write([]byte(strings.ReplaceAll(string(b), "\xff", "\xff\xff"))); err != nil { return 0, err }
+	return len(b), nil
+}
+
+// Close drops the connection.
+func (s *Session) Close() error {
+	return s.conn.Close()
+}
+
+func (s *Session) send(b ...byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_, err := s.conn.Write(b)
+	return err
+}
+
+// input takes a byte from the client: the data goes to pending, less
+// the NUL or LF that follows a CR, the commands are answered.
+func (s *Session) input(c byte) {
+	switch s.state {
+		case STATE_DATA:
+			switch {
+				case c == IAC:
+					s.state = STATE_IAC
+				case s.lastCR && (c == 0 || c == '\n'):
+					s.lastCR = false
+				default:
+					s.lastCR = c == '\r'
+					s.pending = append(s.pending, c)
+			}
+		case STATE_IAC:
+			s.state = STATE_DATA
+			switch c {
+				case IAC:
+					s.pending = append(s.pending, c)
+				case DO, DONT, WILL, WONT:
+					s.option = c
+					s.state = STATE_OPTION
+				case SB:
+					s.state = STATE_SB
+			}
+		case STATE_OPTION:
+			s.state = STATE_DATA
+			s.negotiateOption(s.option, c)
+		case STATE_SB:
+			s.option = c
+			s.suboption = s.suboption[:0]
+			s.state = STATE_SB_DATA
+		case STATE_SB_DATA:
+			if c == IAC {
+				s.state = STATE_SB_IAC
+			} else if len(s.suboption) < MAX_SUBOPTION {
+				s.suboption = append(s.suboption, c)
+			}
+		case STATE_SB_IAC:
+			s.state = STATE_SB_DATA
+			switch c {
+				case IAC:
+					if len(s.suboption) < MAX_SUBOPTION { s.suboption = append(s.suboption, c) }
+				case SE:
+					s.state = STATE_DATA
+					s.subnegotiation(s.option, s.suboption)
+			}
+	}
+}
+
+// negotiateOption answers a request of the client, unless it answers
+// one of the server, so that the two never loop (RFC 854, page 3).
+func (s *Session) negotiateOption(verb, opt byte) {
+	switch verb {
+		case DO:
+			if !localOptions[opt] {
+				s.send(IAC, WONT, opt)
+				break
+			}
+			if !s.local[opt] && !s.askedLocal[opt] { s.send(IAC, WILL, opt) }
+			s.local[opt], s.askedLocal[opt] = true, false
+		case DONT:
+			if s.local[opt] && !s.askedLocal[opt] { s.send(IAC, WONT, opt) }
+			s.local[opt], s.askedLocal[opt] = false, false
+		case WILL:
+			if !remoteOptions[opt] {
+				s.send(IAC, DONT, opt)
+				break
+			}
+			if !s.remote[opt] && !s.askedRemote[opt] { s.send(IAC, DO, opt) }
+			enabled := !s.remote[opt]
+			s.remote[opt], s.askedRemote[opt] = true, false
+			if enabled && opt == OPT_TTYPE { s.send(IAC, SB, OPT_TTYPE, TTYPE_SEND, IAC, SE) }
+		case WONT:
+			if s.remote[opt] && !s.askedRemote[opt] { s.send(IAC, DONT, opt) }
+			s.remote[opt], s.askedRemote[opt] = false, false
+	}
+}
+
+// subnegotiation takes the type or the size of the terminal; a size of
+// zero means that the client does not know it, one above MAX_SIZE is
+// ignored.
+func (s *Session) subnegotiation(opt byte, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+		case opt == OPT_TTYPE && len(data) > 1 && data[0] == TTYPE_IS && !s.named:
+			s.Term  = strings.ToLower(string(data[1:]))
+			s.named = true
+		case opt == OPT_NAWS && len(data) == 4:
+			cols := int(data[0]) << 8 | int(data[1])
+			rows := int(data[2]) << 8 | int(data[3])
+			if cols > 0 && cols <= MAX_SIZE { s.cols = cols }
+			if rows > 0 && rows <= MAX_SIZE { s.rows = rows }
+			s.sized = true
+			select {
+				case s.resized <- struct{}{}:
+				default:
+			}
+	}
+}
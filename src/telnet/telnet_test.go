@@ -0,0 +1,120 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package telnet
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+const WAIT_TIMEOUT = 10 * time.Second
+
+// expect reads from the server until it sent want.
+func expect(t *testing.T, r *bufio.Reader, want []byte) {
+	t.Helper()
+	var got []byte
+	for !bytes.Contains(got, want) {
+		c, err := r.ReadByte()
+		if err != nil { t.Fatalf("waiting for %q, got %q: %v", want, got, err) }
+		got = append(got, c)
+	}
+}
+
+// A client that agrees to everything gets a session with its type and
+// size, which follows its changes; the commands are taken out of the
+// keys, the IAC bytes of the output doubled.
+func TestSession(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatal(err) }
+	server := &Server{ Handler: func(s *Session) {
+		rows, cols := s.Size()
+		fmt.Fprintf(s, "hello %s %dx%d\n", s.Term, cols, rows)
+
+		keys := make(chan []byte, 1)
+		go func() {
+			b := make([]byte, 4)
+			io.ReadFull(s, b)
+			keys <- b
+		}()
+		select {
+			case <- s.Resized():
+			case <- time.After(WAIT_TIMEOUT):
+				return
+		}
+		rows, cols = s.Size()
+		fmt.Fprintf(s, "resized %dx%d\n", cols, rows)
+		fmt.Fprintf(s, "keys %q\xff\n", <-keys)
+	}}
+	go server.Serve(ln)
+	defer server.Close()
+	defer ln.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil { t.Fatal(err) }
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(WAIT_TIMEOUT))
+	r := bufio.NewReader(conn)
+
+	expect(t, r, []byte{ IAC, DO, OPT_NAWS })
+	conn.Write([]byte{ IAC, DO, OPT_ECHO, IAC, DO, OPT_SGA, IAC, WILL, OPT_SGA, IAC, WILL, OPT_TTYPE,
+	                   IAC, WILL, OPT_NAWS, IAC, SB, OPT_NAWS, 0, 100, 0, 35, IAC, SE })
+	expect(t, r, []byte{ IAC, SB, OPT_TTYPE, TTYPE_SEND, IAC, SE })
+	conn.Write(append(append([]byte{ IAC, SB, OPT_TTYPE, TTYPE_IS }, "XTERM"...), IAC, SE))
+	expect(t, r, []byte("hello xterm 100x35\n"))
+
+	conn.Write([]byte{ IAC, SB, OPT_NAWS, 0, 120, 0, 40, IAC, SE })
+	expect(t, r, []byte("resized 120x40\n"))
+
+	conn.Write([]byte{ 'a', '\r', 0, IAC, IAC, '\r', '\n', 'b' })
+	expect(t, r, []byte("keys \"a\\r\\xff\\r\"\xff\xff\n"))
+}
+
+// A client that does not speak the protocol gets the defaults.
+func TestDefaults(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	go io.Copy(io.Discard, client)
+
+	s := newSession(conn)
+	start := time.Now()
+	if err := s.negotiate(); err != nil { t.Fatal(err) }
+	if rows, cols := s.Size(); s.Term != DEFAULT_TERM || rows != DEFAULT_ROWS || cols != DEFAULT_COLS {
+		t.Errorf("the defaults are %s %dx%d", s.Term, cols, rows)
+	}
+	if time.Since(start) < NEGOTIATE_TIMEOUT { t.Error("the server did not wait for the client") }
+}
+
+// A size above MAX_SIZE is ignored, the other one of the pair is taken.
+func TestSizeLimit(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := newSession(conn)
+
+	s.subnegotiation(OPT_NAWS, []byte{ 0xff, 0xff, 0xff, 0xff })
+	if rows, cols := s.Size(); rows != DEFAULT_ROWS || cols != DEFAULT_COLS { t.Errorf("a 65535x65535 size made %dx%d", cols, rows) }
+	s.subnegotiation(OPT_NAWS, []byte{ MAX_SIZE >> 8, MAX_SIZE & 0xff + 1, 0, 50 })
+	if rows, cols := s.Size(); rows != 50 || cols != DEFAULT_COLS { t.Errorf("a %dx50 size made %dx%d", MAX_SIZE + 1, cols, rows) }
+}
@@ -0,0 +1,204 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+// Package terminal puts a tty in raw mode and back, and reports its
+// size, with the ioctls of golang.org/x/sys/unix, vendored under src.
+package terminal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	GET_TERMIOS     = unix.TCGETS
+	SET_TERMIOS     = unix.TCSETS
+	PTY_MASTER      = "/dev/ptmx"
+	PTS_DIR         = "/dev/pts/"
+)
+
+var ErrClosed = errors.New("terminal closed")
+
+// State is a saved termios setting, to be given back to Restore.
+type State struct {
+	termios unix.Termios
+}
+
+// IsTerminal reports whether fd refers to a tty.
+func IsTerminal(fd int) bool {
+	_, err := GetState(fd)
+	return err == nil
+}
+
+func GetState(fd int) (*State, error) {
+	termios, err := unix.IoctlGetTermios(fd, GET_TERMIOS)
+	if err != nil { return nil, err }
+	return &State{ *termios }, nil
+}
+
+// Restore puts back a state returned by GetState or MakeRaw.
+func Restore(fd int, s *State) error {
+	return unix.IoctlSetTermios(fd, SET_TERMIOS, &s.termios)
+}
+
+// MakeRaw turns off echo, line editing, signals and output processing,
+// with reads returning each byte as it comes, as cfmakeraw(3) does; it
+// returns the previous state.
+func MakeRaw(fd int) (*State, error) {
+	old, err := GetState(fd)
+	if err != nil { return nil, err }
+
+	raw := *old
+	raw.termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	raw.termios.Oflag &^= unix.OPOST
+	raw.termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.termios.Cflag &^= unix.CSIZE | unix.PARENB
+	raw.termios.Cflag |= unix.CS8
+	raw.termios.Cc[unix.VMIN]  = 1
+	raw.termios.Cc[unix.VTIME] = 0
+
+	if err := Restore(fd, &raw); err != nil { return nil, err }
+	return old, nil
+}
+
+// GetSize returns the window size of the tty, in characters.
+func GetSize(fd int) (rows, cols int, err error) {
+	ws, err := unix.IoctlGetWinsize(fd, unix.TIOCGWINSZ)
+	if err != nil { return 0, 0, err }
+	return int(ws.Row), int(ws.Col), nil
+}
+
+func SetSize(fd int, rows, cols int) error {
+	return unix.IoctlSetWinsize(fd, unix.TIOCSWINSZ, &unix.Winsize{ Row: uint16(rows), Col: uint16(cols) })
+}
+
+// Terminal is an open tty with the state it had before MakeRaw, so
+// that it can be restored as many times as needed until Close.
+type Terminal struct {
+	file     *os.File
+	saved    *State
+	raw      *State
+}
+
+// Open opens the tty at path, usually /dev/tty.
+func Open(path string) (*Terminal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil { return nil, err }
+
+	t := &Terminal{ file: file }
+	if t.control(func(fd int) error { _, err := GetState(fd); return err }) != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: not a terminal", path)
+	}
+	return t, nil
+}
+
+// Fd returns the descriptor of the tty. As with os.File.Fd, the file
+// is put in blocking mode, so that reads can no longer be interrupted.
+func (t *Terminal) Fd() int {
+	if t.file == nil { return -1 }
+	return int(t.file.Fd())
+}
+
+// control runs f on the descriptor of the tty, leaving the file in the
+// non-blocking mode that SetReadDeadline relies on.
+func (t *Terminal) control(f func(fd int) error) error {
+	if t.file == nil { return ErrClosed }
+
+	conn, err := t.file.SyscallConn()
+	if err != nil { return err }
+	if ctlErr := conn.Control(func(fd uintptr) { err = f(int(fd)) }); ctlErr != nil { return ctlErr }
+	return err
+}
+
+// MakeRaw switches to raw mode; the first call saves the state that
+// Restore goes back to, later calls only apply raw mode again.
+func (t *Terminal) MakeRaw() error {
+	return t.control(func(fd int) error {
+		if t.raw != nil { return Restore(fd, t.raw) }
+
+		saved, err := MakeRaw(fd)
+		if err != nil { return err }
+		raw, err := GetState(fd)
+		if err != nil { return err }
+		t.saved, t.raw = saved, raw
+		return nil
+	})
+}
+
+// Restore brings back the state saved by MakeRaw, if any.
+func (t *Terminal) Restore() error {
+	return t.control(func(fd int) error {
+		if t.saved == nil { return nil }
+		return Restore(fd, t.saved)
+	})
+}
+
+// Read reads the input of the tty; a pending read can be interrupted
+// with SetReadDeadline.
+func (t *Terminal) Read(b []byte) (int, error) {
+	if t.file == nil { return 0, ErrClosed }
+	return t.file.Read(b)
+}
+
+func (t *Terminal) SetReadDeadline(deadline time.Time) error {
+	if t.file == nil { return ErrClosed }
+	return t.file.SetReadDeadline(deadline)
+}
+
+func (t *Terminal) Size() (rows, cols int, err error) {
+	ctlErr := t.control(func(fd int) error {
+		rows, cols, err = GetSize(fd)
+		return err
+	})
+	return rows, cols, ctlErr
+}
+
+// Close restores the terminal and releases it.
+func (t *Terminal) Close() error {
+	if t.file == nil { return ErrClosed }
+	err := t.Restore()
+	if closeErr := t.file.Close(); err == nil { err = closeErr }
+	t.file = nil
+	return err
+}
+
+// OpenPty creates a pseudo-terminal pair: the master end drives the
+// program that has the slave end as its tty.
+func OpenPty() (master, slave *os.File, err error) {
+	master, err = os.OpenFile(PTY_MASTER, os.O_RDWR | unix.O_NOCTTY, 0)
+	if err != nil { return nil, nil, err }
+
+	var n uint32
+	if err = unix.IoctlSetPointerInt(int(master.Fd()), unix.TIOCSPTLCK, 0); err == nil {
+		n, err = unix.IoctlGetUint32(int(master.Fd()), unix.TIOCGPTN)
+	}
+	if err == nil {
+		slave, err = os.OpenFile(fmt.Sprintf("%s%d", PTS_DIR, n), os.O_RDWR | unix.O_NOCTTY, 0)
+	}
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
@@ -0,0 +1,136 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package terminal
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func openPty(t *testing.T) (*os.File, *os.File) {
+	master, slave, err := OpenPty()
+	if err != nil { t.Skipf("no pseudo-terminal: %v", err) }
+	t.Cleanup(func() { master.Close(); slave.Close() })
+	return master, slave
+}
+
+func TestIsTerminal(t *testing.T) {
+	_, slave := openPty(t)
+	if !IsTerminal(int(slave.Fd())) { t.Error("the pty slave is not a terminal") }
+
+	r, w, err := os.Pipe()
+	if err != nil { t.Fatal(err) }
+	defer r.Close()
+	defer w.Close()
+	if IsTerminal(int(r.Fd())) { t.Error("a pipe is a terminal") }
+}
+
+func TestMakeRawRestore(t *testing.T) {
+	_, slave := openPty(t)
+	fd := int(slave.Fd())
+
+	before, err := GetState(fd)
+	if err != nil { t.Fatal(err) }
+	if before.termios.Lflag & unix.ICANON == 0 { t.Fatal("a new pty is not in canonical mode") }
+
+	old, err := MakeRaw(fd)
+	if err != nil { t.Fatal(err) }
+	if old.termios != before.termios { t.Error("MakeRaw did not return the previous state") }
+
+	raw, _ := GetState(fd)
+	if raw.termios.Lflag & (unix.ICANON | unix.ECHO | unix.ISIG) != 0 { t.Errorf("lflag %#o still cooked", raw.termios.Lflag) }
+	if raw.termios.Cc[unix.VMIN] != 1 || raw.termios.Cc[unix.VTIME] != 0 {
+		t.Errorf("VMIN %d VTIME %d, want 1 0", raw.termios.Cc[unix.VMIN], raw.termios.Cc[unix.VTIME])
+	}
+
+	if err := Restore(fd, old); err != nil { t.Fatal(err) }
+	after, _ := GetState(fd)
+	if after.termios != before.termios { t.Error("Restore did not bring back the exact state") }
+}
+
+func TestRawRead(t *testing.T) {
+	master, slave := openPty(t)
+	if _, err := MakeRaw(int(slave.Fd())); err != nil { t.Fatal(err) }
+
+	if _, err := master.Write([]byte{ 'a', 0x1A, '\r' }); err != nil { t.Fatal(err) }
+	buf := make([]byte, 3)
+	for n := 0; n < len(buf); {
+		m, err := slave.Read(buf[n:])
+		if err != nil { t.Fatal(err) }
+		n += m
+	}
+	if string(buf) != "a\x1a\r" { t.Errorf("read %q, the input was processed", buf) }
+}
+
+func TestSize(t *testing.T) {
+	master, slave := openPty(t)
+	if err := SetSize(int(master.Fd()), 35, 100); err != nil { t.Fatal(err) }
+
+	rows, cols, err := GetSize(int(slave.Fd()))
+	if err != nil { t.Fatal(err) }
+	if rows != 35 || cols != 100 { t.Errorf("size %dx%d, want 100x35", cols, rows) }
+}
+
+func TestTerminal(t *testing.T) {
+	_, slave := openPty(t)
+
+	term, err := Open(slave.Name())
+	if err != nil { t.Fatal(err) }
+	before, _ := GetState(term.Fd())
+
+	for i := 0; i < 2; i++ {
+		if err := term.MakeRaw(); err != nil { t.Fatal(err) }
+		if err := term.Restore(); err != nil { t.Fatal(err) }
+	}
+	if err := term.MakeRaw(); err != nil { t.Fatal(err) }
+	if err := term.Close(); err != nil { t.Fatal(err) }
+
+	after, _ := GetState(int(slave.Fd()))
+	if after.termios != before.termios { t.Error("Close did not restore the terminal") }
+	if err := term.Close(); err != ErrClosed { t.Errorf("second Close: %v, want ErrClosed", err) }
+}
+
+func TestOpenNotTerminal(t *testing.T) {
+	if _, err := Open(os.DevNull); err == nil { t.Error("opened /dev/null as a terminal") }
+}
+
+// A read waiting for a key gives up at the deadline, which is how the
+// game stops its input goroutine.
+func TestReadDeadline(t *testing.T) {
+	master, slave := openPty(t)
+
+	term, err := Open(slave.Name())
+	if err != nil { t.Fatal(err) }
+	defer term.Close()
+	if err := term.MakeRaw(); err != nil { t.Fatal(err) }
+
+	master.Write([]byte("k"))
+	b := make([]byte, 1)
+	if n, err := term.Read(b); n != 1 || b[0] != 'k' { t.Fatalf("read %q, %v", b[:n], err) }
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		term.SetReadDeadline(time.Now())
+	}()
+	if _, err := term.Read(b); !os.IsTimeout(err) { t.Errorf("read after the deadline: %v, want a timeout", err) }
+}
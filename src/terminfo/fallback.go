@@ -0,0 +1,84 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package terminfo
+
+import (
+	"errors"
+	"strings"
+)
+
+var ansiStrings = map[string]string{
+	"bel": "\x07", "cr": "\r", "clear": "\x1b[H\x1b[2J", "el": "\x1b[K", "ed": "\x1b[J",
+	"cup": "\x1b[%i%p1%d;%p2%dH", "home": "\x1b[H", "civis": "\x1b[?25l", "cnorm": "\x1b[?25h",
+	"bold": "\x1b[1m", "rev": "\x1b[7m", "sgr0": "\x1b[0m",
+	"setaf": "\x1b[3%p1%dm", "setab": "\x1b[4%p1%dm",
+}
+
+// Built-in descriptions for the families of terminals the game is
+// known to run on, used when the database has no entry for them.
+var fallbacks = []struct {
+	prefix   string
+	alt      bool
+}{
+	{ "xterm",  true },
+	{ "screen", true },
+	{ "tmux",   true },
+	{ "rxvt",   true },
+	{ "linux",  false },
+	{ "vt100",  false },
+	{ "vt220",  false },
+	{ "ansi",   false },
+}
+
+// Fallback returns the built-in description for term, if its family
+// is known.
+func Fallback(term string) (*Terminfo, bool) {
+	for _, f := range fallbacks {
+		if !strings.HasPrefix(term, f.prefix) { continue }
+
+		strs := map[string]string{}
+		for name, s := range ansiStrings {
+			strs[name] = s
+		}
+		if f.alt {
+			strs["smcup"] = "\x1b[?1049h"
+			strs["rmcup"] = "\x1b[?1049l"
+		}
+		colors := 8
+		if f.prefix == "vt100" || f.prefix == "vt220" {
+			colors = ABSENT
+			delete(strs, "setaf")
+			delete(strs, "setab")
+		}
+		return New([]string{ term }, []string{ "am", "xenl" }, map[string]int{ "colors": colors }, strs), true
+	}
+	return nil, false
+}
+
+// LoadOrFallback looks term up in the database, then among the
+// built-in descriptions. An empty term is taken as a vt100.
+func LoadOrFallback(term string) (*Terminfo, error) {
+	if term == "" { term = "vt100" }
+
+	t, err := Load(term)
+	if err == nil { return t, nil }
+	if fallback, ok := Fallback(term); ok && errors.Is(err, ErrNotFound) { return fallback, nil }
+	return nil, err
+}
@@ -0,0 +1,228 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+// Package terminfo reads terminal descriptions from the compiled
+// terminfo database, as written by tic(1), and expands their
+// parameterized strings.
+package terminfo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	MAGIC_LEGACY    = 0432
+	MAGIC_32BIT     = 01036
+	HEADER_LEN      = 12
+	MAX_ENTRY_LEN   = 32768
+	ABSENT          = -1
+	CANCELLED       = -2
+)
+
+var ErrNotFound = errors.New("no terminfo entry")
+
+// Only the capabilities the game may use are named, by their position
+// in the compiled entry; see term(5).
+var boolCaps = map[string]int{
+	"bw": 0, "am": 1, "xenl": 4, "bce": 28,
+}
+
+var numCaps = map[string]int{
+	"cols": 0, "lines": 2, "colors": 13, "pairs": 14,
+}
+
+var stringCaps = map[string]int{
+	"bel": 1, "cr": 2, "clear": 5, "el": 6, "ed": 7, "cup": 10, "home": 12,
+	"civis": 13, "cnorm": 16, "bold": 27, "smcup": 28, "rev": 34, "sgr0": 39,
+	"rmcup": 40, "flash": 45, "setaf": 359, "setab": 360,
+}
+
+// Terminfo is the description of one terminal.
+type Terminfo struct {
+	Names    []string
+	bools    []bool
+	numbers  []int
+	strings  []string
+}
+
+// Load finds the entry for term in the usual places: $TERMINFO,
+// ~/.terminfo, $TERMINFO_DIRS and the system directories.
+func Load(term string) (*Terminfo, error) {
+	if term == "" || strings.ContainsAny(term, "/\x00") || term[0] == '.' {
+		return nil, fmt.Errorf("bad terminal name %q", term)
+	}
+
+	for _, dir := range searchPath() {
+		for _, sub := range []string{ term[:1], fmt.Sprintf("%02x", term[0]) } {
+			data, err := ioutil.ReadFile(filepath.Join(dir, sub, term))
+			if err != nil { continue }
+			if len(data) > MAX_ENTRY_LEN { return nil, fmt.Errorf("%s: terminfo entry too large", term) }
+			return Parse(data)
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", term, ErrNotFound)
+}
+
+func searchPath() []string {
+	var dirs []string
+
+	if dir := os.Getenv("TERMINFO"); dir != "" { dirs = append(dirs, dir) }
+	if home, err := os.UserHomeDir(); err == nil { dirs = append(dirs, filepath.Join(home, ".terminfo")) }
+	for _, dir := range filepath.SplitList(os.Getenv("TERMINFO_DIRS")) {
+		if dir == "" { dir = "/usr/share/terminfo" }
+		dirs = append(dirs, dir)
+	}
+	return append(dirs, "/etc/terminfo", "/lib/terminfo", "/usr/share/terminfo", "/usr/lib/terminfo")
+}
+
+// Parse decodes a compiled entry, legacy or 32 bit numbers format.
+// The extended capabilities that may follow are ignored.
+func Parse(data []byte) (*Terminfo, error) {
+	if len(data) < HEADER_LEN { return nil, errors.New("terminfo entry too short") }
+
+	var header [6]int
+	for i := range header {
+		header[i] = int(int16(binary.LittleEndian.Uint16(data[2 * i:])))
+	}
+
+	numLen := 2
+	switch header[0] {
+		case MAGIC_LEGACY:
+		case MAGIC_32BIT:  numLen = 4
+		default:           return nil, errors.New("bad terminfo magic number")
+	}
+
+	namesLen, boolCount, numCount, strCount, tableLen := header[1], header[2], header[3], header[4], header[5]
+	if namesLen < 0 || boolCount < 0 || numCount < 0 || strCount < 0 || tableLen < 0 {
+		return nil, errors.New("bad terminfo header")
+	}
+
+	pos := HEADER_LEN
+	next := func(n int) ([]byte, error) {
+		if pos + n > len(data) { return nil, errors.New("truncated terminfo entry") }
+		chunk := data[pos:pos + n]
+		pos  += n
+		return chunk, nil
+	}
+
+	t := &Terminfo{}
+
+	names, err := next(namesLen)
+	if err != nil { return nil, err }
+	t.Names = strings.Split(strings.TrimRight(string(names), "\x00"), "|")
+
+	bools, err := next(boolCount)
+	if err != nil { return nil, err }
+	for _, b := range bools {
+		t.bools = append(t.bools, b == 1)
+	}
+	if pos % 2 == 1 { pos++ }
+
+	numbers, err := next(numCount * numLen)
+	if err != nil { return nil, err }
+	for i := 0; i < numCount; i++ {
+		if numLen == 2 {
+			t.numbers = append(t.numbers, int(int16(binary.LittleEndian.Uint16(numbers[2 * i:]))))
+		} else {
+			t.numbers = append(t.numbers, int(int32(binary.LittleEndian.Uint32(numbers[4 * i:]))))
+		}
+	}
+
+	offsets, err := next(strCount * 2)
+	if err != nil { return nil, err }
+	table, err := next(tableLen)
+	if err != nil { return nil, err }
+
+	for i := 0; i < strCount; i++ {
+		offset := int(int16(binary.LittleEndian.Uint16(offsets[2 * i:])))
+		if offset < 0 || offset >= len(table) {
+			t.strings = append(t.strings, "")
+			continue
+		}
+		end := strings.IndexByte(string(table[offset:]), 0)
+		if end < 0 { return nil, errors.New("unterminated terminfo string") }
+		t.strings = append(t.strings, stripPadding(string(table[offset:offset + end])))
+	}
+
+	return t, nil
+}
+
+// stripPadding drops the $<ms> delays: terminals that need them are
+// long gone, and the output is never slow enough to care.
+func stripPadding(s string) string {
+	for {
+		start := strings.Index(s, "$<")
+		if start < 0 { return s }
+		end := strings.IndexByte(s[start:], '>')
+		if end < 0 { return s }
+		s = s[:start] + s[start + end + 1:]
+	}
+}
+
+func (t *Terminfo) Name() string {
+	if len(t.Names) == 0 { return "" }
+	return t.Names[0]
+}
+
+// Bool reports a boolean capability, false when unknown or absent.
+func (t *Terminfo) Bool(name string) bool {
+	i, ok := boolCaps[name]
+	return ok && i < len(t.bools) && t.bools[i]
+}
+
+// Number returns a numeric capability, ABSENT when unknown or absent.
+func (t *Terminfo) Number(name string) int {
+	i, ok := numCaps[name]
+	if !ok || i >= len(t.numbers) || t.numbers[i] < 0 { return ABSENT }
+	return t.numbers[i]
+}
+
+// String returns a string capability, empty when unknown or absent.
+func (t *Terminfo) String(name string) string {
+	i, ok := stringCaps[name]
+	if !ok || i >= len(t.strings) { return "" }
+	return t.strings[i]
+}
+
+// New builds a description by hand, for the built-in fallbacks.
+func New(names []string, bools []string, numbers map[string]int, strs map[string]string) *Terminfo {
+	t := &Terminfo{ Names: names }
+	for _, name := range bools {
+		i := boolCaps[name]
+		for len(t.bools) <= i { t.bools = append(t.bools, false) }
+		t.bools[i] = true
+	}
+	for name, n := range numbers {
+		i := numCaps[name]
+		for len(t.numbers) <= i { t.numbers = append(t.numbers, ABSENT) }
+		t.numbers[i] = n
+	}
+	for name, s := range strs {
+		i := stringCaps[name]
+		for len(t.strings) <= i { t.strings = append(t.strings, "") }
+		t.strings[i] = s
+	}
+	return t
+}
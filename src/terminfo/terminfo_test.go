@@ -0,0 +1,150 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package terminfo
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// compile writes an entry as tic(1) does, in the legacy format for
+// MAGIC_LEGACY and with 32 bit numbers for MAGIC_32BIT. The strings
+// missing from strs up to count are absent, those set to "\x00" are
+// cancelled.
+func compile(magic int, names string, bools []bool, numbers []int, strs map[int]string, count int) []byte {
+	numLen := 2
+	if magic == MAGIC_32BIT { numLen = 4 }
+
+	var offsets, table []byte
+	for i := 0; i < count; i++ {
+		s, ok := strs[i]
+		offset := len(table)
+		switch {
+			case !ok:         offset = ABSENT
+			case s == "\x00": offset = CANCELLED
+			default:          table = append(append(table, s...), 0)
+		}
+		offsets = binary.LittleEndian.AppendUint16(offsets, uint16(int16(offset)))
+	}
+
+	data := []byte{}
+	for _, n := range []int{ magic, len(names) + 1, len(bools), len(numbers), count, len(table) } {
+		data = binary.LittleEndian.AppendUint16(data, uint16(int16(n)))
+	}
+	data = append(append(data, names...), 0)
+	for _, b := range bools {
+		data = append(data, byte(boolInt(b)))
+	}
+	if len(data) % 2 == 1 { data = append(data, 0) }
+	for _, n := range numbers {
+		if numLen == 2 {
+			data = binary.LittleEndian.AppendUint16(data, uint16(int16(n)))
+		} else {
+			data = binary.LittleEndian.AppendUint32(data, uint32(int32(n)))
+		}
+	}
+	return append(append(data, offsets...), table...)
+}
+
+const (
+	CUP   = "\x1b[%i%p1%d;%p2%dH"
+	SETAF = "\x1b[%?%p1%{8}%<%t3%p1%d%e%p1%{16}%<%t9%p1%{8}%-%d%e38;5;%p1%d%;m"
+)
+
+// testEntry is a small terminal: automatic margins, 80 columns, 256
+// colors unless told otherwise, and a few strings, flash with padding.
+func testEntry(magic int, colors int) []byte {
+	return compile(magic, "test|a test terminal",
+	               []bool{ false, true },
+	               []int{ 80, ABSENT, 24, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, colors, CANCELLED },
+	               map[int]string{ 1: "\a", 5: "\x1b[H\x1b[2J", 10: CUP, 13: "\x00", 45: "\x1b[?5h$<100/>\x1b[?5l", 359: SETAF },
+	               361)
+}
+
+func TestParse(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		data    []byte
+		colors  int
+	}{
+		{ "legacy", testEntry(MAGIC_LEGACY, 256), 256 },
+		{ "32 bit", testEntry(MAGIC_32BIT, 1 << 24), 1 << 24 },
+		{ "extended", append(testEntry(MAGIC_LEGACY, 8), 1, 0, 2, 0, 3, 0), 8 },
+	} {
+		ti, err := Parse(c.data)
+		if err != nil { t.Fatalf("%s: %v", c.name, err) }
+		if ti.Name() != "test" || len(ti.Names) != 2 { t.Errorf("%s: names %q", c.name, ti.Names) }
+		if ti.Bool("bw") || !ti.Bool("am") || ti.Bool("bce") || ti.Bool("nope") { t.Errorf("%s: wrong booleans", c.name) }
+		for cap, want := range map[string]int{ "cols": 80, "lines": 24, "colors": c.colors, "pairs": ABSENT, "nope": ABSENT } {
+			if got := ti.Number(cap); got != want { t.Errorf("%s: %s is %d, want %d", c.name, cap, got, want) }
+		}
+		for cap, want := range map[string]string{
+			"bel": "\a", "clear": "\x1b[H\x1b[2J", "cup": CUP, "civis": "", "cr": "", "flash": "\x1b[?5h\x1b[?5l",
+			"setaf": SETAF, "setab": "", "nope": "",
+		} {
+			if got := ti.String(cap); got != want { t.Errorf("%s: %s is %q, want %q", c.name, cap, got, want) }
+		}
+	}
+}
+
+// Every entry cut short is refused, as are broken headers and strings.
+func TestParseBad(t *testing.T) {
+	for _, magic := range []int{ MAGIC_LEGACY, MAGIC_32BIT } {
+		data := testEntry(magic, 256)
+		for n := 0; n < len(data); n++ {
+			if _, err := Parse(data[:n]); err == nil { t.Errorf("%o cut at %d of %d bytes was taken", magic, n, len(data)) }
+		}
+	}
+
+	bad := testEntry(MAGIC_LEGACY, 256)
+	bad[0] = 0
+	unterminated := compile(MAGIC_LEGACY, "test", nil, nil, map[int]string{ 0: "\x1b[H" }, 1)
+	unterminated = unterminated[:len(unterminated) - 1]
+	binary.LittleEndian.PutUint16(unterminated[10:], 3)
+	for _, c := range []struct {
+		data    []byte
+		err     string
+	}{
+		{ bad, "bad terminfo magic number" },
+		{ compile(MAGIC_LEGACY, "test", nil, make([]int, 1), nil, 0)[:HEADER_LEN - 1], "terminfo entry too short" },
+		{ append(binary.LittleEndian.AppendUint16(nil, MAGIC_LEGACY), 5, 0, 0xff, 0xff, 0, 0, 0, 0, 0, 0), "bad terminfo header" },
+		{ unterminated, "unterminated terminfo string" },
+	} {
+		if _, err := Parse(c.data); err == nil || err.Error() != c.err { t.Errorf("got %v, want %q", err, c.err) }
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TERMINFO", dir)
+	t.Setenv("TERMINFO_DIRS", "")
+	if err := os.MkdirAll(filepath.Join(dir, "7a"), 0755); err != nil { t.Fatal(err) }
+	if err := os.WriteFile(filepath.Join(dir, "7a", "zz-test"), testEntry(MAGIC_32BIT, 256), 0644); err != nil { t.Fatal(err) }
+
+	ti, err := Load("zz-test")
+	if err != nil || ti.Name() != "test" { t.Fatalf("got %v, %v", ti, err) }
+	if _, err := Load("zz-missing"); err == nil || !strings.Contains(err.Error(), ErrNotFound.Error()) { t.Errorf("a missing entry: %v", err) }
+	for _, name := range []string{ "", "../zz-test", ".zz", "a/b" } {
+		if _, err := Load(name); err == nil { t.Errorf("%q was loaded", name) }
+	}
+}
@@ -0,0 +1,176 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package terminfo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const MAX_PARAMS = 9
+
+type tparmStack []int
+
+func (s *tparmStack) push(v int) { *s = append(*s, v) }
+
+func (s *tparmStack) pop() int {
+	if len(*s) == 0 { return 0 }
+	v := (*s)[len(*s) - 1]
+	*s = (*s)[:len(*s) - 1]
+	return v
+}
+
+func boolInt(b bool) int {
+	if b { return 1 }
+	return 0
+}
+
+// Tparm expands the % escapes of a parameterized capability such as
+// cup or setaf, as tparm(3) does; only numeric parameters are used.
+func Tparm(format string, args ...int) string {
+	var (
+		out      strings.Builder
+		stack    tparmStack
+		params   [MAX_PARAMS]int
+		dynamic  [26]int
+	)
+	copy(params[:], args)
+
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' || i + 1 == len(format) {
+			out.WriteByte(c)
+			continue
+		}
+		i++
+
+		switch c = format[i]; c {
+			case '%':
+				out.WriteByte('%')
+			case 'c':
+				out.WriteByte(byte(stack.pop()))
+			case 's':
+				out.WriteString(strconv.Itoa(stack.pop()))
+			case 'p':
+				if i + 1 < len(format) && format[i + 1] >= '1' && format[i + 1] <= '9' {
+					i++
+					stack.push(params[format[i] - '1'])
+				}
+			case 'P', 'g':
+				if i + 1 < len(format) && format[i + 1] >= 'a' && format[i + 1] <= 'z' {
+					i++
+					if c == 'P' { dynamic[format[i] - 'a'] = stack.pop() } else { stack.push(dynamic[format[i] - 'a']) }
+				} else if i + 1 < len(format) {
+					i++
+				}
+			case '\'':
+				if i + 2 < len(format) {
+					stack.push(int(format[i + 1]))
+					i += 2
+				}
+			case '{':
+				end := strings.IndexByte(format[i:], '}')
+				if end < 0 { return out.String() }
+				n, _ := strconv.Atoi(format[i + 1:i + end])
+				stack.push(n)
+				i += end
+			case 'l':
+				stack.push(len(strconv.Itoa(stack.pop())))
+			case 'i':
+				params[0]++
+				params[1]++
+			case '+', '-', '*', '/', 'm', '&', '|', '^', '=', '>', '<', 'A', 'O':
+				b, a := stack.pop(), stack.pop()
+				stack.push(arith(c, a, b))
+			case '!':
+				stack.push(boolInt(stack.pop() == 0))
+			case '~':
+				stack.push(^stack.pop())
+			case '?', ';':
+			case 't':
+				if stack.pop() == 0 { i = skipBranch(format, i + 1, true) }
+			case 'e':
+				i = skipBranch(format, i + 1, false)
+			default:
+				i = printf(&out, format, i, stack.pop)
+		}
+	}
+	return out.String()
+}
+
+func arith(op byte, a, b int) int {
+	switch op {
+		case '+': return a + b
+		case '-': return a - b
+		case '*': return a * b
+		case '/': if b != 0 { return a / b }
+		case 'm': if b != 0 { return a % b }
+		case '&': return a & b
+		case '|': return a | b
+		case '^': return a ^ b
+		case '=': return boolInt(a == b)
+		case '>': return boolInt(a > b)
+		case '<': return boolInt(a < b)
+		case 'A': return boolInt(a != 0 && b != 0)
+		case 'O': return boolInt(a != 0 || b != 0)
+	}
+	return 0
+}
+
+// skipBranch moves past a false %t branch, to its %e when elseToo is
+// set, or to the %; closing the conditional; it returns the index of
+// the last character skipped.
+func skipBranch(format string, i int, elseToo bool) int {
+	depth := 0
+	for ; i + 1 < len(format); i++ {
+		if format[i] != '%' { continue }
+		i++
+		switch format[i] {
+			case '?':
+				depth++
+			case ';':
+				if depth == 0 { return i }
+				depth--
+			case 'e':
+				if depth == 0 && elseToo { return i }
+		}
+	}
+	return len(format)
+}
+
+// printf handles %[[:]flags][width[.precision]][doxXs]; i is on the
+// first character after the %.
+func printf(out *strings.Builder, format string, i int, pop func() int) int {
+	start := i
+	if format[i] == ':' { i++ }
+	for i < len(format) && strings.IndexByte("-+# 0123456789.", format[i]) >= 0 { i++ }
+	if i == len(format) { return i }
+
+	spec := "%" + strings.TrimPrefix(format[start:i], ":")
+
+	switch verb := format[i]; verb {
+		case 'd', 'o', 'x', 'X':
+			out.WriteString(fmt.Sprintf(spec + string(verb), pop()))
+		case 's':
+			out.WriteString(fmt.Sprintf(spec + "s", strconv.Itoa(pop())))
+	}
+	return i
+}
@@ -0,0 +1,60 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package terminfo
+
+import "testing"
+
+func TestTparm(t *testing.T) {
+	for _, c := range []struct {
+		format  string
+		args    []int
+		want    string
+	}{
+		{ CUP, []int{ 0, 0 }, "\x1b[1;1H" },
+		{ CUP, []int{ 5, 10 }, "\x1b[6;11H" },
+		{ "\x1b[%p1%d;%p2%dH", []int{ 5, 10 }, "\x1b[5;10H" },
+		{ "\x1b[%i%p2%d;%p1%dH", []int{ 5, 10 }, "\x1b[11;6H" },
+		{ SETAF, []int{ 1 }, "\x1b[31m" },
+		{ SETAF, []int{ 9 }, "\x1b[91m" },
+		{ SETAF, []int{ 200 }, "\x1b[38;5;200m" },
+		{ "\x1b[%?%p1%{8}%<%t4%p1%d%e%p1%{16}%<%t10%p1%{8}%-%d%e48;5;%p1%d%;m", []int{ 4 }, "\x1b[44m" },
+		{ "\x1b[%?%p1%{8}%<%t4%p1%d%e%p1%{16}%<%t10%p1%{8}%-%d%e48;5;%p1%d%;m", []int{ 12 }, "\x1b[104m" },
+		{ "\x1b[3%p1%dm", []int{ 7 }, "\x1b[37m" },
+		{ "%?%p1%t1%;x", []int{ 0 }, "x" },
+		{ "%?%p1%tyes%eno%;", []int{ 1 }, "yes" },
+		{ "%?%p1%tyes%eno%;", []int{ 0 }, "no" },
+		{ "%?%p1%t%?%p2%ta%eb%;%ec%;", []int{ 1, 0 }, "b" },
+		{ "%?%p1%t%?%p2%ta%eb%;%ec%;", []int{ 0, 1 }, "c" },
+		{ "%p1%p2%+%d %p1%p2%*%d %p2%p1%-%d %p2%p1%/%d %p2%p1%m%d", []int{ 3, 7 }, "10 21 4 2 1" },
+		{ "%p1%{0}%/%d", []int{ 3 }, "0" },
+		{ "%p1%Pa%ga%ga%+%d", []int{ 4 }, "8" },
+		{ "%'x'%c%p1%c", []int{ 'y' }, "xy" },
+		{ "%p1%3d|%p1%:-3d|%p1%03d|%p1%x|%p1%:-4X|", []int{ 42 }, " 42|42 |042|2a|2A  |" },
+		{ "%p1%-3d", []int{ 42 }, "3d" }, // %- subtracts, %:- aligns
+		{ "%p1%l%d %p1%s", []int{ 12345 }, "5 12345" },
+		{ "100%% %p1%!%d%p1%~%d", []int{ 0 }, "100% 1-1" },
+		{ "%p1%d%p9%d", []int{ 1, 2, 3, 4, 5, 6, 7, 8, 9 }, "19" },
+		{ "%d%d", nil, "00" },
+		{ "end%", nil, "end%" },
+		{ "%{12", nil, "" },
+	} {
+		if got := Tparm(c.format, c.args...); got != c.want { t.Errorf("Tparm(%q, %v) = %q, want %q", c.format, c.args, got, c.want) }
+	}
+}
@@ -0,0 +1,370 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+// Package vt100 is a small terminal emulator: it interprets the output
+// of a program, as a VT100 or xterm would, into a grid of characters
+// that tests can look at.
+package vt100
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	ESC             = 0x1B
+	TAB_STOP        = 8
+	BLANK           = ' '
+)
+
+const (
+	stateGround = iota
+	stateEscape
+	stateCSI
+	stateCharset
+	stateOSC
+	stateOSCEscape
+)
+
+// Screen is the state of the emulated terminal. It can be written to
+// and looked at from different goroutines.
+type Screen struct {
+	mu                        sync.Mutex
+
+	rows, cols                int
+	grid, main, alt           [][]rune
+	row, col                  int
+	savedRow, savedCol        int
+	wrapNext                  bool
+	cursorHidden, altScreen   bool
+	bells                     int
+
+	state                     int
+	params                    []byte
+	partial                   []byte
+}
+
+func New(rows, cols int) *Screen {
+	s := &Screen{ rows: rows, cols: cols }
+	s.main = newGrid(rows, cols)
+	s.alt  = newGrid(rows, cols)
+	s.grid = s.main
+	return s
+}
+
+func newGrid(rows, cols int) [][]rune {
+	grid := make([][]rune, rows)
+	for i := range grid {
+		grid[i] = make([]rune, cols)
+		clearRow(grid[i])
+	}
+	return grid
+}
+
+func clearRow(row []rune) {
+	for i := range row {
+		row[i] = BLANK
+	}
+}
+
+// Write interprets p; a UTF-8 sequence may be split between writes.
+func (s *Screen) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := append(s.partial, p...)
+	s.partial = nil
+	for i := 0; i < len(data); {
+		c := data[i]
+		if s.state != stateGround || c < utf8.RuneSelf {
+			s.feed(c)
+			i++
+			continue
+		}
+		if !utf8.FullRune(data[i:]) {
+			s.partial = append([]byte(nil), data[i:]...)
+			break
+		}
+		r, n := utf8.DecodeRune(data[i:])
+		s.put(r)
+		i += n
+	}
+	return len(p), nil
+}
+
+func (s *Screen) feed(c byte) {
+	switch s.state {
+		case stateGround:
+			s.control(c)
+		case stateEscape:
+			s.escape(c)
+		case stateCSI:
+			if c >= 0x40 && c <= 0x7E {
+				s.csi(c)
+				s.state = stateGround
+			} else {
+				s.params = append(s.params, c)
+			}
+		case stateCharset:
+			s.state = stateGround
+		case stateOSC:
+			switch c {
+				case 0x07: s.state = stateGround
+				case ESC:  s.state = stateOSCEscape
+			}
+		case stateOSCEscape:
+			s.state = stateGround
+	}
+}
+
+func (s *Screen) control(c byte) {
+	switch c {
+		case ESC:
+			s.state = stateEscape
+		case '\r':
+			s.col, s.wrapNext = 0, false
+		case '\n', '\v', '\f':
+			s.lineFeed()
+		case '\b':
+			if s.col > 0 { s.col-- }
+			s.wrapNext = false
+		case '\t':
+			s.col = min(s.cols - 1, (s.col / TAB_STOP + 1) * TAB_STOP)
+		case 0x07:
+			s.bells++
+		default:
+			if c >= ' ' && c != 0x7F { s.put(rune(c)) }
+	}
+}
+
+func (s *Screen) escape(c byte) {
+	s.state = stateGround
+	switch c {
+		case '[':
+			s.state, s.params = stateCSI, s.params[:0]
+		case ']':
+			s.state = stateOSC
+		case '(', ')', '*', '+':
+			s.state = stateCharset
+		case '7':
+			s.savedRow, s.savedCol = s.row, s.col
+		case '8':
+			s.row, s.col = s.savedRow, s.savedCol
+		case 'D':
+			s.lineFeed()
+		case 'E':
+			s.col = 0
+			s.lineFeed()
+		case 'M':
+			if s.row > 0 { s.row-- } else { s.scrollDown() }
+		case 'c':
+			s.reset()
+	}
+}
+
+func (s *Screen) put(r rune) {
+	if s.wrapNext {
+		s.col = 0
+		s.lineFeed()
+	}
+	s.grid[s.row][s.col] = r
+	if s.col == s.cols - 1 {
+		s.wrapNext = true
+	} else {
+		s.col++
+	}
+}
+
+func (s *Screen) lineFeed() {
+	s.wrapNext = false
+	if s.row < s.rows - 1 {
+		s.row++
+		return
+	}
+	copy(s.grid, s.grid[1:])
+	s.grid[s.rows - 1] = make([]rune, s.cols)
+	clearRow(s.grid[s.rows - 1])
+}
+
+func (s *Screen) scrollDown() {
+	copy(s.grid[1:], s.grid[:s.rows - 1])
+	s.grid[0] = make([]rune, s.cols)
+	clearRow(s.grid[0])
+}
+
+func (s *Screen) reset() {
+	s.main, s.alt = newGrid(s.rows, s.cols), newGrid(s.rows, s.cols)
+	s.grid = s.main
+	s.row, s.col, s.wrapNext = 0, 0, false
+	s.cursorHidden, s.altScreen = false, false
+}
+
+// csi runs a control sequence; the ones a game never sends, like
+// scrolling regions, are ignored.
+func (s *Screen) csi(final byte) {
+	private := len(s.params) > 0 && s.params[0] == '?'
+	params  := s.numbers(private)
+	arg     := func(i, def int) int {
+		if i < len(params) && params[i] > 0 { return params[i] }
+		return def
+	}
+	s.wrapNext = false
+
+	switch final {
+		case 'A': s.row = max(0, s.row - arg(0, 1))
+		case 'B': s.row = min(s.rows - 1, s.row + arg(0, 1))
+		case 'C': s.col = min(s.cols - 1, s.col + arg(0, 1))
+		case 'D': s.col = max(0, s.col - arg(0, 1))
+		case 'G': s.col = min(s.cols, arg(0, 1)) - 1
+		case 'd': s.row = min(s.rows, arg(0, 1)) - 1
+		case 'H', 'f':
+			s.row = min(s.rows, arg(0, 1)) - 1
+			s.col = min(s.cols, arg(1, 1)) - 1
+		case 'J':
+			s.erase(params, true)
+		case 'K':
+			s.erase(params, false)
+		case 'X':
+			for i := s.col; i < min(s.cols, s.col + arg(0, 1)); i++ { s.grid[s.row][i] = BLANK }
+		case 'h', 'l':
+			if private { s.mode(params, final == 'h') }
+	}
+}
+
+func (s *Screen) numbers(private bool) []int {
+	text := string(s.params)
+	if private { text = text[1:] }
+	if text == "" { return nil }
+
+	var params []int
+	for _, field := range strings.Split(text, ";") {
+		n, _ := strconv.Atoi(field)
+		params = append(params, n)
+	}
+	return params
+}
+
+// erase clears after the cursor, before it or everything, on the
+// screen or only on the cursor line.
+func (s *Screen) erase(params []int, screen bool) {
+	how := 0
+	if len(params) > 0 { how = params[0] }
+
+	from, to := s.col, s.cols
+	switch how {
+		case 1: from, to = 0, s.col + 1
+		case 2: from, to = 0, s.cols
+	}
+	for i := from; i < to; i++ {
+		s.grid[s.row][i] = BLANK
+	}
+	if !screen { return }
+
+	for r := range s.grid {
+		if (how == 0 && r > s.row) || (how == 1 && r < s.row) || how >= 2 { clearRow(s.grid[r]) }
+	}
+}
+
+func (s *Screen) mode(params []int, set bool) {
+	for _, m := range params {
+		switch m {
+			case 25:
+				s.cursorHidden = !set
+			case 47, 1047, 1049:
+				if set == s.altScreen { continue }
+				if m == 1049 && set { s.savedRow, s.savedCol = s.row, s.col }
+				s.altScreen = set
+				if set {
+					s.grid = s.alt
+					if m != 47 { for _, row := range s.grid { clearRow(row) } }
+				} else {
+					s.grid = s.main
+					if m == 1049 { s.row, s.col = s.savedRow, s.savedCol }
+				}
+		}
+	}
+}
+
+// Lines returns the rows of the screen, trailing blanks removed.
+func (s *Screen) Lines() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lines := make([]string, s.rows)
+	for i, row := range s.grid {
+		lines[i] = strings.TrimRight(string(row), " ")
+	}
+	return lines
+}
+
+// Line returns row i in full, with the blanks.
+func (s *Screen) Line(i int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i < 0 || i >= s.rows { return "" }
+	return string(s.grid[i])
+}
+
+func (s *Screen) String() string {
+	return strings.Join(s.Lines(), "\n")
+}
+
+// Find returns the position of the first occurrence of text, counted
+// in characters, scanning the rows from the top.
+func (s *Screen) Find(text string) (row, col int, ok bool) {
+	for i, line := range s.Lines() {
+		if at := strings.Index(line, text); at >= 0 {
+			return i, utf8.RuneCountInString(line[:at]), true
+		}
+	}
+	return -1, -1, false
+}
+
+func (s *Screen) Contains(text string) bool {
+	_, _, ok := s.Find(text)
+	return ok
+}
+
+func (s *Screen) Cursor() (row, col int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.row, s.col
+}
+
+func (s *Screen) CursorVisible() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.cursorHidden
+}
+
+func (s *Screen) AltScreen() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.altScreen
+}
+
+// Bells counts the BEL characters received.
+func (s *Screen) Bells() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bells
+}
@@ -0,0 +1,90 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+// +build linux
+
+package vt100
+
+import (
+	"testing"
+)
+
+func TestPrintAndWrap(t *testing.T) {
+	s := New(3, 5)
+	s.Write([]byte("abcdefgh\r\nxy"))
+
+	want := []string{ "abcde", "fgh", "xy" }
+	for i, line := range s.Lines() {
+		if line != want[i] { t.Errorf("row %d: %q, want %q", i, line, want[i]) }
+	}
+}
+
+func TestPendingWrap(t *testing.T) {
+	s := New(2, 3)
+	s.Write([]byte("abc\rX"))
+	if s.Lines()[0] != "Xbc" { t.Errorf("row 0: %q, a full line wrapped before the carriage return", s.Lines()[0]) }
+}
+
+func TestScroll(t *testing.T) {
+	s := New(2, 4)
+	s.Write([]byte("one\r\ntwo\r\nsix"))
+	if s.String() != "two\nsix" { t.Errorf("screen %q", s.String()) }
+}
+
+func TestCursorAndErase(t *testing.T) {
+	s := New(3, 6)
+	s.Write([]byte("xxxxxx\r\nxxxxxx\r\nxxxxxx"))
+	s.Write([]byte("\x1b[2;3H\x1b[K!\x1b[1;1H\x1b[2C\x1b[1K"))
+
+	want := []string{ "   xxx", "xx!", "xxxxxx" }
+	for i, line := range s.Lines() {
+		if line != want[i] { t.Errorf("row %d: %q, want %q", i, line, want[i]) }
+	}
+
+	s.Write([]byte("\x1b[H\x1b[2J"))
+	if s.String() != "\n\n" { t.Errorf("screen %q after clear", s.String()) }
+	if row, col := s.Cursor(); row != 0 || col != 0 { t.Errorf("cursor %d,%d after home", row, col) }
+}
+
+func TestUTF8AcrossWrites(t *testing.T) {
+	s := New(1, 4)
+	ship := []byte("╔═╗")
+	s.Write(ship[:4])
+	s.Write(ship[4:])
+	if s.Lines()[0] != "╔═╗" { t.Errorf("row %q", s.Lines()[0]) }
+	if _, col, ok := s.Find("╗"); !ok || col != 2 { t.Errorf("found at %d, want column 2", col) }
+}
+
+func TestModes(t *testing.T) {
+	s := New(2, 4)
+	s.Write([]byte("sh$ "))
+	s.Write([]byte("\x1b[?1049h\x1b[22;0;0t\x1b[?25l\x1b(B\x1b[H\x1b[1;32mgame\a"))
+
+	if !s.AltScreen() || s.CursorVisible() { t.Error("alternate screen or hidden cursor not set") }
+	if s.Lines()[0] != "game" || s.Bells() != 1 { t.Errorf("row %q, %d bells", s.Lines()[0], s.Bells()) }
+
+	s.Write([]byte("\x1b[?25h\x1b[?1049l"))
+	if s.AltScreen() || !s.CursorVisible() { t.Error("alternate screen or hidden cursor not reset") }
+	if s.Lines()[0] != "sh$" { t.Errorf("row %q, the main screen was not kept", s.Lines()[0]) }
+	if row, col := s.Cursor(); row != 0 || col != 3 { t.Errorf("cursor %d,%d, want 0,3", row, col) }
+}
+
+func TestOSCIgnored(t *testing.T) {
+	s := New(1, 8)
+	s.Write([]byte("\x1b]0;title\aok\x1b]2;x\x1b\\!"))
+	if s.Lines()[0] != "ok!" { t.Errorf("row %q", s.Lines()[0]) }
+}
@@ -0,0 +1,256 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+// Package web serves the game to browsers: a page runs xterm.js, the
+// terminal emulator in JavaScript, and bridges it over a WebSocket to
+// a session of the server, the screen going one way and the keys and
+// the size of the terminal the other.
+package web
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	TERM            = "xterm-256color"
+	DEFAULT_ROWS    = 24
+	DEFAULT_COLS    = 80
+	MAX_SIZE        = 1000
+	HEADER_TIMEOUT  = 10 * time.Second
+	PLAY_PATH       = "/play"
+	XTERM_PATH      = "/xterm/"
+)
+
+//go:embed index.html
+var page []byte
+
+// The files of xterm.js that the page loads: those that `make xterm`
+// put in the xterm directory are built in, the others are on jsDelivr,
+// at the same versions. The tree itself holds none of them.
+var (
+	//go:embed xterm
+	xtermFiles embed.FS
+	xtermUpstream = map[string]string{
+		"xterm.js":     "https://cdn.jsdelivr.net/npm/@xterm/xterm@5.5.0/lib/xterm.js",
+		"xterm.css":    "https://cdn.jsdelivr.net/npm/@xterm/xterm@5.5.0/css/xterm.css",
+		"addon-fit.js": "https://cdn.jsdelivr.net/npm/@xterm/addon-fit@0.10.0/lib/addon-fit.js",
+	}
+)
+
+// A Server serves the page and hands each WebSocket of a page to
+// Handler, in a goroutine of its own; the WebSocket is closed when
+// Handler returns.
+type Server struct {
+	Handler   func(*Session)
+
+	once      sync.Once
+	http      *http.Server
+	mu        sync.Mutex
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+func (s *Server) init() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.servePage)
+	mux.HandleFunc(PLAY_PATH, s.servePlay)
+	mux.HandleFunc(XTERM_PATH, serveXterm)
+	s.http = &http.Server{ Handler: mux, ReadHeaderTimeout: HEADER_TIMEOUT }
+}
+
+// Serve accepts the connections on ln until it is closed.
+func (s *Server) Serve(ln net.Listener) error {
+	s.once.Do(s.init)
+	return s.http.Serve(ln)
+}
+
+// Close stops the HTTP server, drops every WebSocket and waits for
+// their sessions to end.
+func (s *Server) Close() {
+	s.once.Do(s.init)
+	s.http.Close()
+
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) servePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
+
+// serveXterm serves a file of xterm.js if it was built in, or sends
+// the browser to its copy on jsDelivr.
+func serveXterm(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	upstream, ok := xtermUpstream[name]
+	if !ok || r.URL.Path != XTERM_PATH + name {
+		http.NotFound(w, r)
+		return
+	}
+	if _, err := fs.Stat(xtermFiles, "xterm/" + name); err != nil {
+		http.Redirect(w, r, upstream, http.StatusFound)
+		return
+	}
+	http.ServeFileFS(w, r, xtermFiles, "xterm/" + name)
+}
+
+// servePlay opens the WebSocket of a page, which tells the size of its
+// terminal and the name of the player in the query.
+func (s *Server) servePlay(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	rows, cols := DEFAULT_ROWS, DEFAULT_COLS
+	if n, err := strconv.Atoi(query.Get("rows")); err == nil && n > 0 && n <= MAX_SIZE { rows = n }
+	if n, err := strconv.Atoi(query.Get("cols")); err == nil && n > 0 && n <= MAX_SIZE { cols = n }
+
+	c, err := upgrade(w, r)
+	if err != nil { return }
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		c.Close()
+		return
+	}
+	if s.conns == nil { s.conns = make(map[net.Conn]struct{}) }
+	s.conns[c.Conn] = struct{}{}
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			c.close(CLOSE_NORMAL)
+			c.Close()
+			s.mu.Lock()
+			delete(s.conns, c.Conn)
+			s.mu.Unlock()
+		}()
+
+		session := &Session{
+			Player:     query.Get("name"),
+			Term:       TERM,
+			RemoteAddr: c.RemoteAddr(),
+			conn:       c,
+			rows:       rows,
+			cols:       cols,
+			resized:    make(chan struct{}, 1),
+		}
+		s.Handler(session)
+	}()
+}
+
+// A Session is the terminal of a page: the binary messages of the page
+// are the keys, its text messages tell the new size of the terminal,
+// as {"rows":24,"cols":80}; the screen goes in binary messages.
+type Session struct {
+	Player      string
+	Term        string
+	RemoteAddr  net.Addr
+
+	conn        *conn
+	pending     []byte
+
+	mu          sync.Mutex
+	rows, cols  int
+	resized     chan struct{}
+}
+
+// Size is the size of the terminal, as last told by the page.
+func (s *Session) Size() (rows, cols int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rows, s.cols
+}
+
+// Resized receives a value when the page changes the size.
+func (s *Session) Resized() <-chan struct{} {
+	return s.resized
+}
+
+// Read returns the keys typed by the player, io.EOF once the page
+// closed the WebSocket.
+func (s *Session) Read(b []byte) (int, error) {
+	for len(s.pending) == 0 {
+		op, message, err := s.conn.readMessage()
+		if err != nil { return 0, err }
+		if op == OP_BINARY {
+			s.pending = message
+			continue
+		}
+		s.resize(message)
+	}
+
+	n := copy(b, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// resize takes a size told by the page, unless it is not one.
+func (s *Session) resize(message []byte) {
+	var size struct {
+		Rows, Cols  int
+	}
+	if json.Unmarshal(message, &size) != nil { return }
+	if size.Rows <= 0 || size.Cols <= 0 || size.Rows > MAX_SIZE || size.Cols > MAX_SIZE { return }
+
+	s.mu.Lock()
+	s.rows, s.cols = size.Rows, size.Cols
+	s.mu.Unlock()
+	select {
+		case s.resized <- struct{}{}:
+		default:
+	}
+}
+
+// SetReadDeadline makes Read fail at t; a message cut by the deadline
+// is lost, as the rest of the WebSocket.
+func (s *Session) SetReadDeadline(t time.Time) error {
+	return s.conn.SetReadDeadline(t)
+}
+
+// Write sends the output to the terminal in a binary message.
+func (s *Session) Write(b []byte) (int, error) {
+	if err := s.conn.writeFrame(OP_BINARY, b); err != nil { return 0, err }
+	return len(b), nil
+}
+
+// Close drops the WebSocket.
+func (s *Session) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,251 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	WAIT_TIMEOUT = 10 * time.Second
+	CLIENT_KEY   = "dGhlIHNhbXBsZSBub25jZQ=="
+)
+
+// A client is the browser end of a WebSocket.
+type client struct {
+	t     *testing.T
+	conn  net.Conn
+	r     *bufio.Reader
+}
+
+// dial opens a WebSocket on the server at addr for the request uri.
+func dial(t *testing.T, addr, uri string) *client {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil { t.Fatal(err) }
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(WAIT_TIMEOUT))
+
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n" +
+	            "Sec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", uri, addr, CLIENT_KEY)
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil { t.Fatal(err) }
+	if resp.StatusCode != http.StatusSwitchingProtocols { t.Fatalf("the server answered %s", resp.Status) }
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("the accept key is %q", accept)
+	}
+	return &client{ t: t, conn: conn, r: r }
+}
+
+// send sends a masked frame, as a browser does.
+func (c *client) send(fin bool, opcode byte, payload []byte) {
+	c.t.Helper()
+	head := opcode
+	if fin { head |= 0x80 }
+	frame := []byte{ head }
+	switch n := len(payload); {
+		case n < 126:
+			frame = append(frame, 0x80 | byte(n))
+		default:
+			frame = binary.BigEndian.AppendUint16(append(frame, 0x80 | 126), uint16(n))
+	}
+	mask := []byte{ 1, 2, 3, 4 }
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b ^ mask[i % 4])
+	}
+	if _, err := c.conn.Write(frame); err != nil { c.t.Fatal(err) }
+}
+
+// receive reads a frame of the server.
+func (c *client) receive() (byte, []byte) {
+	c.t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(c.r, head[:]); err != nil { c.t.Fatal(err) }
+	if head[1] & 0x80 != 0 { c.t.Fatal("the server masked a frame") }
+
+	size := int(head[1] & 0x7f)
+	switch size {
+		case 126:
+			var ext [2]byte
+			io.ReadFull(c.r, ext[:])
+			size = int(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			io.ReadFull(c.r, ext[:])
+			size = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(c.r, payload); err != nil { c.t.Fatal(err) }
+	return head[0] & 0x0f, payload
+}
+
+// expect reads the screen until the server sent want.
+func (c *client) expect(want string) {
+	c.t.Helper()
+	var got []byte
+	for !strings.Contains(string(got), want) {
+		op, payload := c.receive()
+		if op != OP_BINARY { c.t.Fatalf("waiting for %q, got the frame %d %q", want, op, payload) }
+		got = append(got, payload...)
+	}
+}
+
+func startServer(t *testing.T, handler func(*Session)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatal(err) }
+	server := &Server{ Handler: handler }
+	go server.Serve(ln)
+	t.Cleanup(func() {
+		ln.Close()
+		server.Close()
+	})
+	return ln.Addr().String()
+}
+
+// The page with the terminal is served, the WebSocket of another site
+// and the requests that are not handshakes are refused.
+func TestPage(t *testing.T) {
+	addr := startServer(t, func(*Session) { t.Error("a session was started") })
+
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil { t.Fatal(err) }
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "xterm.js") {
+		t.Errorf("the page is %s %.80q", resp.Status, body)
+	}
+
+	for _, c := range []struct {
+		header  string
+		status  int
+	}{
+		{ "", http.StatusBadRequest },
+		{ "Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: " + CLIENT_KEY + "\r\nSec-WebSocket-Version: 8\r\n",
+		  http.StatusUpgradeRequired },
+		{ "Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: " + CLIENT_KEY + "\r\nSec-WebSocket-Version: 13\r\n" +
+		  "Origin: http://evil.example\r\n", http.StatusForbidden },
+	} {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil { t.Fatal(err) }
+		fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\n%s\r\n", PLAY_PATH, addr, c.header)
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		conn.Close()
+		if err != nil { t.Fatal(err) }
+		if resp.StatusCode != c.status { t.Errorf("%q got %s, want %d", c.header, resp.Status, c.status) }
+	}
+}
+
+// The files of xterm.js are served when they were built in, sent to
+// jsDelivr otherwise; nothing else is served there.
+func TestXterm(t *testing.T) {
+	addr := startServer(t, func(*Session) { t.Error("a session was started") })
+	client := &http.Client{ CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse } }
+
+	for name, upstream := range xtermUpstream {
+		resp, err := client.Get("http://" + addr + XTERM_PATH + name)
+		if err != nil { t.Fatal(err) }
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		data, err := xtermFiles.ReadFile("xterm/" + name)
+		switch {
+			case err == nil:
+				if resp.StatusCode != http.StatusOK || !bytes.Equal(body, data) { t.Errorf("%s is %s, %d bytes", name, resp.Status, len(body)) }
+			case resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != upstream:
+				t.Errorf("%s is %s to %q, want it from %s", name, resp.Status, resp.Header.Get("Location"), upstream)
+		}
+	}
+	for _, path := range []string{ "README", "other.js", "x/xterm.js" } {
+		resp, err := client.Get("http://" + addr + XTERM_PATH + path)
+		if err != nil { t.Fatal(err) }
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound { t.Errorf("%s got %s", path, resp.Status) }
+	}
+}
+
+// A session has the size and the name given by the page and follows
+// the resizes; the keys may come in fragments, between pings, and the
+// end of the WebSocket is the end of the keys.
+func TestSession(t *testing.T) {
+	ended, result := make(chan error, 1), make(chan error, 1)
+	addr  := startServer(t, func(s *Session) {
+		rows, cols := s.Size()
+		fmt.Fprintf(s, "hello %s %s %dx%d\n", s.Player, s.Term, cols, rows)
+
+		keys := make(chan []byte, 1)
+		go func() {
+			b := make([]byte, 5)
+			io.ReadFull(s, b)
+			keys <- b
+			_, err := io.Copy(io.Discard, s)
+			ended <- err
+		}()
+		select {
+			case <- s.Resized():
+			case <- time.After(WAIT_TIMEOUT):
+				return
+		}
+		rows, cols = s.Size()
+		fmt.Fprintf(s, "resized %dx%d\n", cols, rows)
+		fmt.Fprintf(s, "keys %q\n", <-keys)
+		fmt.Fprintf(s, "%s", strings.Repeat("x", 200))
+		result <- <-ended
+	})
+
+	c := dial(t, addr, PLAY_PATH + "?rows=35&cols=100&name=alice")
+	c.expect("hello alice " + TERM + " 100x35\n")
+
+	c.send(true, OP_TEXT, []byte(`{"rows":40,"cols":120}`))
+	c.expect("resized 120x40\n")
+
+	c.send(false, OP_BINARY, []byte("ab"))
+	c.send(true, OP_PING, []byte("ping"))
+	if op, payload := c.receive(); op != OP_PONG || string(payload) != "ping" {
+		t.Errorf("the answer to a ping is %d %q", op, payload)
+	}
+	c.send(true, OP_CONTINUATION, []byte("c\x1b["))
+	c.send(true, OP_BINARY, []byte("A"))
+	c.expect("keys \"abc\\x1b[\"\n")
+	if op, payload := c.receive(); op != OP_BINARY || len(payload) != 200 {
+		t.Errorf("a long message came as %d, %d bytes", op, len(payload))
+	}
+
+	c.send(true, OP_CLOSE, binary.BigEndian.AppendUint16(nil, CLOSE_NORMAL))
+	if op, _ := c.receive(); op != OP_CLOSE { t.Errorf("the answer to a close is %d", op) }
+	select {
+		case err := <- result:
+			if err != nil { t.Errorf("the keys ended with %v, want EOF", err) }
+		case <- time.After(WAIT_TIMEOUT):
+			t.Fatal("the session did not see the close")
+	}
+}
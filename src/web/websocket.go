@@ -0,0 +1,244 @@
+// -----------------------------------------------------------------
+// SystemInvaders - A tty game.
+// Copyright (C) 2016  Gabriele Bonacini
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 3 of the License, or
+// (at your option) any later version.
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the Free Software Foundation,
+// Inc., 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301  USA
+// -----------------------------------------------------------------
+
+
+// +build linux
+
+package web
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// The WebSocket protocol, RFC 6455, as far as a server needs it.
+const (
+	WS_GUID        = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	WS_VERSION     = "13"
+
+	OP_CONTINUATION = 0x0
+	OP_TEXT         = 0x1
+	OP_BINARY       = 0x2
+	OP_CLOSE        = 0x8
+	OP_PING         = 0x9
+	OP_PONG         = 0xa
+
+	CLOSE_NORMAL    = 1000
+	CLOSE_PROTOCOL  = 1002
+	CLOSE_TOO_BIG   = 1009
+
+	MAX_MESSAGE     = 4096
+)
+
+var (
+	errProtocol = errors.New("websocket: protocol error")
+	errTooBig   = errors.New("websocket: message too big")
+)
+
+// A conn is the server end of a WebSocket: messages are read whole,
+// the pings answered and the close handshake done by readMessage, the
+// only reader; the writers take writeMu.
+type conn struct {
+	net.Conn
+	r        *bufio.Reader
+	writeMu  sync.Mutex
+	closed   bool
+}
+
+// upgrade answers the opening handshake of a WebSocket and takes the
+// connection over from the HTTP server. A page of another site may not
+// open one.
+func upgrade(w http.ResponseWriter, r *http.Request) (*conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	switch {
+		case r.Method != http.MethodGet:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return nil, errProtocol
+		case !headerHas(r.Header, "Connection", "upgrade") || !headerHas(r.Header, "Upgrade", "websocket") || key == "":
+			http.Error(w, "not a WebSocket handshake", http.StatusBadRequest)
+			return nil, errProtocol
+		case r.Header.Get("Sec-WebSocket-Version") != WS_VERSION:
+			w.Header().Set("Sec-WebSocket-Version", WS_VERSION)
+			http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+			return nil, errProtocol
+		case !sameOrigin(r):
+			http.Error(w, "cross-origin WebSocket", http.StatusForbidden)
+			return nil, errProtocol
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "cannot upgrade the connection", http.StatusInternalServerError)
+		return nil, errProtocol
+	}
+	nc, rw, err := hijacker.Hijack()
+	if err != nil { return nil, err }
+
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return &conn{ Conn: nc, r: rw.Reader }, nil
+}
+
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + WS_GUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerHas tells whether one of the comma separated tokens of the
+// header is token.
+func headerHas(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) { return true }
+		}
+	}
+	return false
+}
+
+// sameOrigin lets in the clients that are not browsers, which send no
+// origin, and the pages of the server itself.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" { return true }
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// readMessage returns the next text or binary message, joining its
+// fragments; io.EOF tells that the client closed the WebSocket.
+func (c *conn) readMessage() (byte, []byte, error) {
+	var (
+		op       byte
+		message  []byte
+	)
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil { return 0, nil, err }
+
+		switch opcode {
+			case OP_PING:
+				if err := c.writeFrame(OP_PONG, payload); err != nil { return 0, nil, err }
+				continue
+			case OP_PONG:
+				continue
+			case OP_CLOSE:
+				c.close(CLOSE_NORMAL)
+				return 0, nil, io.EOF
+			case OP_TEXT, OP_BINARY:
+				if op != 0 { return 0, nil, c.fail(CLOSE_PROTOCOL, errProtocol) }
+				op = opcode
+			case OP_CONTINUATION:
+				if op == 0 { return 0, nil, c.fail(CLOSE_PROTOCOL, errProtocol) }
+			default:
+				return 0, nil, c.fail(CLOSE_PROTOCOL, errProtocol)
+		}
+
+		if len(message) + len(payload) > MAX_MESSAGE { return 0, nil, c.fail(CLOSE_TOO_BIG, errTooBig) }
+		message = append(message, payload...)
+		if fin { return op, message, nil }
+	}
+}
+
+// readFrame reads a frame of the client, which must be masked; the
+// control frames must be whole and short.
+func (c *conn) readFrame() (bool, byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.r, head[:]); err != nil { return false, 0, nil, err }
+
+	fin    := head[0] & 0x80 != 0
+	opcode := head[0] & 0x0f
+	masked := head[1] & 0x80 != 0
+	size   := uint64(head[1] & 0x7f)
+	switch {
+		case head[0] & 0x70 != 0 || !masked:
+			return false, 0, nil, c.fail(CLOSE_PROTOCOL, errProtocol)
+		case opcode >= OP_CLOSE && (!fin || size > 125):
+			return false, 0, nil, c.fail(CLOSE_PROTOCOL, errProtocol)
+	}
+
+	switch size {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(c.r, ext[:]); err != nil { return false, 0, nil, err }
+			size = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(c.r, ext[:]); err != nil { return false, 0, nil, err }
+			size = binary.BigEndian.Uint64(ext[:])
+	}
+	if size > MAX_MESSAGE { return false, 0, nil, c.fail(CLOSE_TOO_BIG, errTooBig) }
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.r, mask[:]); err != nil { return false, 0, nil, err }
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(c.r, payload); err != nil { return false, 0, nil, err }
+	for i := range payload {
+		payload[i] ^= mask[i % 4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// writeFrame sends a whole, unmasked frame, as a server does.
+func (c *conn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed { return net.ErrClosed }
+	return c.writeLocked(opcode, payload)
+}
+
+func (c *conn) writeLocked(opcode byte, payload []byte) error {
+	frame := []byte{ 0x80 | opcode }
+	switch n := len(payload); {
+		case n < 126:
+			frame = append(frame, byte(n))
+		case n <= 0xffff:
+			frame = binary.BigEndian.AppendUint16(append(frame, 126), uint16(n))
+		default:
+			frame = binary.BigEndian.AppendUint64(append(frame, 127), uint64(n))
+	}
+	_, err := c.Conn.Write(append(frame, payload...))
+	return err
+}
+
+// close sends the close frame with code, once; nothing can be written
+// after it.
+func (c *conn) close(code uint16) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed { return }
+	c.closed = true
+	c.writeLocked(OP_CLOSE, binary.BigEndian.AppendUint16(nil, code))
+}
+
+// fail closes the WebSocket on an error of the client.
+func (c *conn) fail(code uint16, err error) error {
+	c.close(code)
+	return err
+}